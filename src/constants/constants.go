@@ -15,24 +15,32 @@ var (
 // The names of the accepted ENV variables
 const (
 	// General
-	EnvConsoleURL           = "CONSOLE_URL"            // e.g. https://console.ownstak.com
-	EnvSupportURL           = "SUPPORT_URL"            // e.g. https://ownstak.com/support
-	EnvProvider             = "PROVIDER"               // aws
-	EnvLogLevel             = "LOG_LEVEL"              // debug, info, warn, error
-	EnvHost                 = "HOST"                   // e.g. 0.0.0.0
-	EnvHttpPort             = "HTTP_PORT"              // e.g. 80
-	EnvHttpsPort            = "HTTPS_PORT"             // e.g. 443
-	EnvHttpsCert            = "HTTPS_CERT"             // e.g. /etc/certs/ownstak.com/wildcard-ownstak-link.pem
-	EnvHttpsCertKey         = "HTTPS_CERT_KEY"         // e.g. /etc/certs/ownstak.com/wildcard-ownstak-link.key
-	EnvHttpsCertCa          = "HTTPS_CERT_CA"          // e.g. /etc/certs/ownstak.com/wildcard-ownstak-link.ca
-	EnvResWriteTimeout      = "RES_WRITE_TIMEOUT"      // max waiting time for client to receive the response
-	EnvReqReadTimeout       = "REQ_READ_TIMEOUT"       // max waiting time for client to send the request
-	EnvReqIdleTimeout       = "REQ_IDLE_TIMEOUT"       // max waiting time for client to send anything
-	EnvReqMaxHeadersSize    = "REQ_MAX_HEADERS_SIZE"   // the max total size of accepted request headers in bytes
-	EnvReqMaxBodySize       = "REQ_MAX_BODY_SIZE"      // the max size of the request body in bytes
-	EnvMaxMemory            = "MAX_MEMORY"             // max memory in bytes that the proxy server can use
-	EnvLambdaFunctionPrefix = "LAMBDA_FUNCTION_PREFIX" // unique prefix for each cloud backend. e.g. "ownstak-1skda"
-	EnvLambdaStreamingMode  = "LAMBDA_STREAMING_MODE"  // true by default, set to false to invoke lambda in legacy buffered mode
+	EnvConsoleURL              = "CONSOLE_URL"               // e.g. https://console.ownstak.com
+	EnvSupportURL              = "SUPPORT_URL"               // e.g. https://ownstak.com/support
+	EnvProvider                = "PROVIDER"                  // aws
+	EnvLogLevel                = "LOG_LEVEL"                 // debug, info, warn, error
+	EnvHost                    = "HOST"                      // e.g. 0.0.0.0
+	EnvHttpPort                = "HTTP_PORT"                 // e.g. 80
+	EnvHttpsPort               = "HTTPS_PORT"                // e.g. 443
+	EnvHttpsCert               = "HTTPS_CERT"                // e.g. /etc/certs/ownstak.com/wildcard-ownstak-link.pem
+	EnvHttpsCertKey            = "HTTPS_CERT_KEY"            // e.g. /etc/certs/ownstak.com/wildcard-ownstak-link.key
+	EnvHttpsCertCa             = "HTTPS_CERT_CA"             // e.g. /etc/certs/ownstak.com/wildcard-ownstak-link.ca
+	EnvResWriteTimeout         = "RES_WRITE_TIMEOUT"         // max waiting time for client to receive the response
+	EnvReqReadTimeout          = "REQ_READ_TIMEOUT"          // max waiting time for client to send the request
+	EnvReqIdleTimeout          = "REQ_IDLE_TIMEOUT"          // max waiting time for client to send anything
+	EnvReqMaxHeadersSize       = "REQ_MAX_HEADERS_SIZE"      // the max total size of accepted request headers in bytes
+	EnvReqMaxBodySize          = "REQ_MAX_BODY_SIZE"         // the max size of the request body in bytes
+	EnvMaxMemory               = "MAX_MEMORY"                // max memory in bytes that the proxy server can use
+	EnvLambdaFunctionPrefix    = "LAMBDA_FUNCTION_PREFIX"    // unique prefix for each cloud backend. e.g. "ownstak-1skda"
+	EnvLambdaStreamingMode     = "LAMBDA_STREAMING_MODE"     // true by default, set to false to invoke lambda in legacy buffered mode
+	EnvLambdaCacheTTL          = "LAMBDA_CACHE_TTL"          // e.g. 5m, how long to remember existing lambda functions, 0 disables the cache
+	EnvLambdaNotFoundTTL       = "LAMBDA_NOT_FOUND_TTL"      // e.g. 30s, how long to remember non-existing lambda functions, 0 disables the cache
+	EnvLambdaAsyncRoutes       = "LAMBDA_ASYNC_ROUTES"       // JSON with routes that invoke lambda asynchronously per host pattern, e.g. {"*.ownstak.link": [{"path": "/api/webhooks/**"}]}
+	EnvLambdaMaxResponseSize   = "LAMBDA_MAX_RESPONSE_SIZE"  // JSON with max lambda response size per host pattern, e.g. {"*": "200MB", "*.aws-primary.my-org.ownstak.link": "500MB"}
+	EnvLambdaWarmupFunctions   = "LAMBDA_WARMUP_FUNCTIONS"   // comma separated list of lambda functions to keep warm, e.g. ownstak-myproject-prod:current,ownstak-other-prod
+	EnvLambdaWarmupInterval    = "LAMBDA_WARMUP_INTERVAL"    // e.g. 5m, how often to send the warm-up ping invocations
+	EnvLambdaWarmupConcurrency = "LAMBDA_WARMUP_CONCURRENCY" // e.g. 5, how many warm-up ping invocations can run at the same time
+	EnvInternalApiToken        = "INTERNAL_API_TOKEN"        // secret token required by internal management endpoints, endpoints are disabled when not set
 
 	// Go GC
 	EnvGoMemLimit = "GOMEMLIMIT" // e.g. 1024MiB, heap allocated memory size that Golang garbage collector will try to reach if possible
@@ -44,6 +52,17 @@ const (
 	EnvAWSOrganizationsEndpoint = "AWS_ORGANIZATIONS_ENDPOINT"
 	EnvAWSStSEndpoint           = "AWS_STS_ENDPOINT"
 
+	// Image Optimizer
+	EnvImageOptimizerDefaultFormat  = "IMAGE_OPTIMIZER_DEFAULT_FORMAT"  // e.g. auto, webp (default), avif, png, jpeg, gif
+	EnvImageOptimizerCacheDir       = "IMAGE_OPTIMIZER_CACHE_DIR"       // e.g. /tmp/ownstak-image-cache, directory of the disk cache for optimized images, the cache is disabled when not set
+	EnvImageOptimizerCacheSize      = "IMAGE_OPTIMIZER_CACHE_SIZE"      // e.g. 1GB, max size of the disk cache, the least recently used images are evicted first
+	EnvImageOptimizerCacheTTL       = "IMAGE_OPTIMIZER_CACHE_TTL"       // e.g. 1h, how long to serve cached images without revalidating the source image, capped by its Cache-Control max-age or Expires
+	EnvImageOptimizerSigningSecrets = "IMAGE_OPTIMIZER_SIGNING_SECRETS" // JSON with secrets for signed image URLs per host pattern, e.g. {"*.aws-primary.my-org.ownstak.link": "my-secret"}, unsigned requests are rejected for these hosts
+	EnvImageOptimizerRemotePatterns = "IMAGE_OPTIMIZER_REMOTE_PATTERNS" // JSON with allowed remote images per host pattern, e.g. {"*.ownstak.link": [{"protocol": "https", "hostname": "**.amazonaws.com", "pathname": "/my-bucket/**"}]}
+	EnvImageOptimizerPresets        = "IMAGE_OPTIMIZER_PRESETS"         // JSON with named presets per host pattern, e.g. {"*.ownstak.link": {"presets": {"thumbnail": {"w": 200, "h": 200}}, "presetsOnly": true}}
+	EnvImageOptimizerMaxPixels      = "IMAGE_OPTIMIZER_MAX_PIXELS"      // e.g. 40000000 (default), max number of pixels of the source image (width x height x frames), larger images are rejected with 400
+	EnvImageOptimizerProcessTimeout = "IMAGE_OPTIMIZER_PROCESS_TIMEOUT" // e.g. 20s (default), max duration of the image processing, slower requests fail with 503
+
 	// VIPS
 	EnvVipsDebug        = "VIPS_DEBUG"
 	EnvMallocArenaMax   = "MALLOC_ARENA_MAX"
@@ -52,6 +71,7 @@ const (
 	EnvVipsMaxCacheMem  = "VIPS_MAX_CACHE_MEM"
 	EnvVipsLeak         = "VIPS_LEAK"
 	EnvVipsTrace        = "VIPS_TRACE"
+	EnvVipsFailOn       = "VIPS_FAIL_ON" // e.g. none, truncated, error (default), warning
 )
 
 // Accepted providers
@@ -2,22 +2,27 @@ package middlewares
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"ownstak-proxy/src/constants"
 	"ownstak-proxy/src/logger"
 	"ownstak-proxy/src/server"
 	"ownstak-proxy/src/utils"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 	"unicode/utf8"
 
+	"github.com/andybalholm/brotli"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/lambda"
@@ -79,6 +84,17 @@ type ClientCert struct {
 	} `json:"validity"`
 }
 
+// AsyncRoute defines the route that invokes the lambda function asynchronously (fire-and-forget)
+// and immediately returns the configured response without waiting for the function result.
+// This is useful for webhooks, analytics beacons etc... that don't need the function's response.
+type AsyncRoute struct {
+	Path        string   `json:"path"`                  // e.g: /api/webhooks/**
+	Methods     []string `json:"methods,omitempty"`     // e.g: ["POST"], all methods by default
+	Status      int      `json:"status,omitempty"`      // e.g: 202 (default)
+	Body        string   `json:"body,omitempty"`        // e.g: {"accepted":true}
+	ContentType string   `json:"contentType,omitempty"` // e.g: application/json, defaults to text/plain
+}
+
 // AWSLambdaMiddleware handles AWS Lambda invocations
 type AWSLambdaMiddleware struct {
 	server.DefaultMiddleware
@@ -97,14 +113,135 @@ type AWSLambdaMiddleware struct {
 	lowPriorityQueueConcurrency    int
 
 	streamingMode bool
+	functionCache *lambdaFunctionCache
+	asyncRoutes   map[string][]AsyncRoute // host pattern => async routes
+
+	maxResponseSizes map[string]int // host pattern => max response size in bytes
+
+	warmupFunctions   []string // e.g: ownstak-myproject-prod:current
+	warmupInterval    time.Duration
+	warmupConcurrency int
+	warmupCancel      context.CancelFunc
+	warmupWaitGroup   sync.WaitGroup
 }
 
 const (
 	defaultHighPriorityQueueConcurrency   = 1000
 	defaultMediumPriorityQueueConcurrency = 20
 	defaultLowPriorityQueueConcurrency    = 10
+
+	defaultLambdaCacheTTL    = 5 * time.Minute
+	defaultLambdaNotFoundTTL = 30 * time.Second
+	// Maximum number of remembered lambda functions.
+	// Protects us from bots generating random hostnames.
+	maxLambdaCacheEntries = 10000
+
+	// AWS Lambda allows returning up to 200MB of response body in streaming mode.
+	defaultLambdaMaxResponseSize = 200 * 1024 * 1024 // 200MB
+
+	defaultLambdaWarmupInterval    = 5 * time.Minute
+	defaultLambdaWarmupConcurrency = 5
+	lambdaWarmupTimeout            = 30 * time.Second
 )
 
+// lambdaFunctionCache remembers which Lambda functions exist and which don't,
+// so the requests to retired projects (mostly bot traffic to dead hosts)
+// are redirected to revive page without calling the AWS Lambda API every time.
+type lambdaFunctionCache struct {
+	mutex       sync.RWMutex
+	entries     map[string]lambdaFunctionCacheEntry
+	foundTTL    time.Duration
+	notFoundTTL time.Duration
+}
+
+type lambdaFunctionCacheEntry struct {
+	found     bool
+	expiresAt time.Time
+}
+
+func newLambdaFunctionCache(foundTTL, notFoundTTL time.Duration) *lambdaFunctionCache {
+	return &lambdaFunctionCache{
+		entries:     make(map[string]lambdaFunctionCacheEntry),
+		foundTTL:    foundTTL,
+		notFoundTTL: notFoundTTL,
+	}
+}
+
+// Get returns whether the lambda function with given ARN exists
+// and true as second value if the result was found in the cache and isn't expired yet.
+func (c *lambdaFunctionCache) Get(lambdaArn string) (bool, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	entry, ok := c.entries[lambdaArn]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return false, false
+	}
+	return entry.found, true
+}
+
+// Set remembers whether the lambda function with given ARN exists for the configured TTL.
+func (c *lambdaFunctionCache) Set(lambdaArn string, found bool) {
+	ttl := c.notFoundTTL
+	if found {
+		ttl = c.foundTTL
+	}
+	if ttl <= 0 {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// Remove expired entries first when the cache is full
+	// and start from scratch if all of them are still valid.
+	if len(c.entries) >= maxLambdaCacheEntries {
+		now := time.Now()
+		for key, entry := range c.entries {
+			if now.After(entry.expiresAt) {
+				delete(c.entries, key)
+			}
+		}
+		if len(c.entries) >= maxLambdaCacheEntries {
+			c.entries = make(map[string]lambdaFunctionCacheEntry)
+		}
+	}
+
+	c.entries[lambdaArn] = lambdaFunctionCacheEntry{
+		found:     found,
+		expiresAt: time.Now().Add(ttl),
+	}
+}
+
+// Flush removes the entries ending with given suffix from the cache
+// or all entries if the suffix is empty. Returns the number of removed entries.
+// e.g: ":function:ownstak-myproject-prod:current"
+func (c *lambdaFunctionCache) Flush(suffix string) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if suffix == "" {
+		count := len(c.entries)
+		c.entries = make(map[string]lambdaFunctionCacheEntry)
+		return count
+	}
+
+	count := 0
+	for key := range c.entries {
+		if strings.HasSuffix(key, suffix) {
+			delete(c.entries, key)
+			count++
+		}
+	}
+	return count
+}
+
+// The compressions of the response body that the lambda function can flag in the response head.
+// e.g: {"statusCode": 200, "headers": {...}, "compression": "gzip"}
+var lambdaResponseCompressions = []string{"gzip", "br"}
+
+var errLambdaResponseTooLarge = errors.New("lambda response exceeds size limit")
+
 var (
 	// IMPORTANT:
 	// Do not change this variable without knowing what you're doing.
@@ -238,6 +375,81 @@ func NewAWSLambdaMiddleware() *AWSLambdaMiddleware {
 	// There's no reason for setting the streamingMode to false except for debugging and troubleshooting in production.
 	streamingMode := utils.GetEnvWithDefault(constants.EnvLambdaStreamingMode, "true") == "true"
 
+	// Configure how long we remember existing and non-existing lambda functions.
+	// The non-existing ones should have short TTL, so the revived projects start to work quickly
+	// even if nobody calls the cache flush endpoint.
+	lambdaCacheTTL := defaultLambdaCacheTTL
+	if lambdaCacheTTLStr := utils.GetEnv(constants.EnvLambdaCacheTTL); lambdaCacheTTLStr != "" {
+		if ttl, err := time.ParseDuration(lambdaCacheTTLStr); err == nil {
+			lambdaCacheTTL = ttl
+		} else {
+			logger.Warn("Invalid LAMBDA_CACHE_TTL format, using default: %v", lambdaCacheTTL)
+		}
+	}
+	lambdaNotFoundTTL := defaultLambdaNotFoundTTL
+	if lambdaNotFoundTTLStr := utils.GetEnv(constants.EnvLambdaNotFoundTTL); lambdaNotFoundTTLStr != "" {
+		if ttl, err := time.ParseDuration(lambdaNotFoundTTLStr); err == nil {
+			lambdaNotFoundTTL = ttl
+		} else {
+			logger.Warn("Invalid LAMBDA_NOT_FOUND_TTL format, using default: %v", lambdaNotFoundTTL)
+		}
+	}
+
+	// Load the routes that should be invoked asynchronously for each host pattern
+	// e.g: {"*.aws-primary.my-org.ownstak.link": [{"path": "/api/webhooks/**", "methods": ["POST"]}]}
+	asyncRoutes := map[string][]AsyncRoute{}
+	if err := utils.GetEnvJSON(constants.EnvLambdaAsyncRoutes, &asyncRoutes); err != nil {
+		logger.Warn("Invalid LAMBDA_ASYNC_ROUTES format, async invocations are disabled: %v", err)
+		asyncRoutes = map[string][]AsyncRoute{}
+	}
+
+	// Load the max response size for each host pattern.
+	// e.g: {"*": "200MB", "*.aws-primary.my-org.ownstak.link": "500MB"}
+	maxResponseSizesConfig := map[string]string{}
+	if err := utils.GetEnvJSON(constants.EnvLambdaMaxResponseSize, &maxResponseSizesConfig); err != nil {
+		logger.Warn("Invalid LAMBDA_MAX_RESPONSE_SIZE format, using default: %d bytes", defaultLambdaMaxResponseSize)
+	}
+	maxResponseSizes := map[string]int{}
+	for hostPattern, maxResponseSizeStr := range maxResponseSizesConfig {
+		maxResponseSize, err := utils.ParseMemorySize(maxResponseSizeStr)
+		if err != nil || maxResponseSize == 0 {
+			logger.Warn("Invalid LAMBDA_MAX_RESPONSE_SIZE value '%s' for host '%s', using default: %d bytes", maxResponseSizeStr, hostPattern, defaultLambdaMaxResponseSize)
+			continue
+		}
+		maxResponseSizes[hostPattern] = int(maxResponseSize)
+	}
+
+	// Load the lambda functions that should be kept warm.
+	// The alias defaults to "current" when not specified.
+	// e.g: ownstak-myproject-prod,ownstak-other-prod:deployment-12
+	warmupFunctions := []string{}
+	for _, warmupFunction := range strings.Split(utils.GetEnv(constants.EnvLambdaWarmupFunctions), ",") {
+		warmupFunction = strings.TrimSpace(warmupFunction)
+		if warmupFunction == "" {
+			continue
+		}
+		if !strings.HasPrefix(warmupFunction, "arn:") && !strings.Contains(warmupFunction, ":") {
+			warmupFunction += ":current"
+		}
+		warmupFunctions = append(warmupFunctions, warmupFunction)
+	}
+	warmupInterval := defaultLambdaWarmupInterval
+	if warmupIntervalStr := utils.GetEnv(constants.EnvLambdaWarmupInterval); warmupIntervalStr != "" {
+		if interval, err := time.ParseDuration(warmupIntervalStr); err == nil && interval > 0 {
+			warmupInterval = interval
+		} else {
+			logger.Warn("Invalid LAMBDA_WARMUP_INTERVAL format, using default: %v", warmupInterval)
+		}
+	}
+	warmupConcurrency := defaultLambdaWarmupConcurrency
+	if warmupConcurrencyStr := utils.GetEnv(constants.EnvLambdaWarmupConcurrency); warmupConcurrencyStr != "" {
+		if concurrency, err := strconv.Atoi(warmupConcurrencyStr); err == nil && concurrency > 0 {
+			warmupConcurrency = concurrency
+		} else {
+			logger.Warn("Invalid LAMBDA_WARMUP_CONCURRENCY format, using default: %d", warmupConcurrency)
+		}
+	}
+
 	return &AWSLambdaMiddleware{
 		awsConfig:                      &awsConfig,
 		lambdaClient:                   lambdaClient,
@@ -251,6 +463,12 @@ func NewAWSLambdaMiddleware() *AWSLambdaMiddleware {
 		mediumPriorityQueue:            make(chan struct{}, defaultMediumPriorityQueueConcurrency),
 		lowPriorityQueue:               make(chan struct{}, defaultLowPriorityQueueConcurrency),
 		streamingMode:                  streamingMode,
+		functionCache:                  newLambdaFunctionCache(lambdaCacheTTL, lambdaNotFoundTTL),
+		asyncRoutes:                    asyncRoutes,
+		maxResponseSizes:               maxResponseSizes,
+		warmupFunctions:                warmupFunctions,
+		warmupInterval:                 warmupInterval,
+		warmupConcurrency:              warmupConcurrency,
 	}
 }
 
@@ -292,10 +510,217 @@ func (m *AWSLambdaMiddleware) OnStart(server *server.Server) {
 	m.lowPriorityQueue = make(chan struct{}, m.lowPriorityQueueConcurrency)
 
 	logger.Info("AWS Lambda middleware initialized with throttling concurrency (high: %d, medium: %d, low: %d)", m.highPriorityQueueConcurrency, m.mediumPriorityQueueConcurrency, m.lowPriorityQueueConcurrency)
+
+	m.startWarmup()
+}
+
+// OnStop is called when the server stops
+func (m *AWSLambdaMiddleware) OnStop(server *server.Server) {
+	m.stopWarmup()
+}
+
+// startWarmup starts the background worker that periodically
+// sends ping invocations to the configured lambda functions to keep them warm
+// and reduce the cold starts of low-traffic projects.
+func (m *AWSLambdaMiddleware) startWarmup() {
+	if len(m.warmupFunctions) == 0 || m.warmupCancel != nil {
+		return
+	}
+
+	// Resolve the account ID before the worker starts and pass it to the worker,
+	// so it doesn't read the field that is lazily written by OnRequest.
+	if m.accountId == "" {
+		accountCtx, accountCancel := context.WithTimeout(context.Background(), lambdaWarmupTimeout)
+		accountId, err := m.getAccountIdFromCaller(accountCtx)
+		accountCancel()
+		if err != nil {
+			logger.Warn("Failed to get AWS account ID for Lambda warm-up: %v", err)
+		} else {
+			m.accountId = accountId
+		}
+	}
+	accountId := m.accountId
+
+	warmupCtx, warmupCancel := context.WithCancel(context.Background())
+	m.warmupCancel = warmupCancel
+	m.warmupWaitGroup.Add(1)
+
+	go func() {
+		defer m.warmupWaitGroup.Done()
+
+		ticker := time.NewTicker(m.warmupInterval)
+		defer ticker.Stop()
+
+		for {
+			m.warmupFunctionsOnce(warmupCtx, accountId)
+			select {
+			case <-warmupCtx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	logger.Info("AWS Lambda warm-up started for %d functions (interval: %s, concurrency: %d)", len(m.warmupFunctions), m.warmupInterval, m.warmupConcurrency)
+}
+
+// stopWarmup stops the warm-up worker and waits for the running ping invocations to finish
+func (m *AWSLambdaMiddleware) stopWarmup() {
+	if m.warmupCancel == nil {
+		return
+	}
+	m.warmupCancel()
+	m.warmupWaitGroup.Wait()
+	m.warmupCancel = nil
+	logger.Info("AWS Lambda warm-up stopped")
+}
+
+// warmupFunctionsOnce sends the ping invocation to all configured lambda functions
+// with at most warmupConcurrency invocations running at the same time.
+func (m *AWSLambdaMiddleware) warmupFunctionsOnce(warmupCtx context.Context, accountId string) {
+	semaphore := make(chan struct{}, m.warmupConcurrency)
+	var waitGroup sync.WaitGroup
+
+	for _, functionName := range m.warmupFunctions {
+		select {
+		case semaphore <- struct{}{}:
+		case <-warmupCtx.Done():
+			waitGroup.Wait()
+			return
+		}
+
+		waitGroup.Add(1)
+		go func(functionName string) {
+			defer waitGroup.Done()
+			defer func() { <-semaphore }()
+
+			if err := m.invokeLambdaWarmup(warmupCtx, functionName, accountId); err != nil && warmupCtx.Err() == nil {
+				logger.Warn("Failed to warm up Lambda function %s: %v", functionName, err)
+			}
+		}(functionName)
+	}
+
+	waitGroup.Wait()
+}
+
+// invokeLambdaWarmup sends the lightweight ping invocation to the lambda function.
+// The request is marked with the x-own-warmup header, so the function can return right away.
+func (m *AWSLambdaMiddleware) invokeLambdaWarmup(warmupCtx context.Context, functionName, accountId string) error {
+	invokeCtx, invokeCancel := context.WithTimeout(warmupCtx, lambdaWarmupTimeout)
+	defer invokeCancel()
+
+	now := time.Now()
+	event, err := json.Marshal(ApiGatewayV2Event{
+		Version:  "2.0",
+		RouteKey: "$default",
+		RawPath:  "/",
+		Cookies:  []string{},
+		Headers: map[string]string{
+			strings.ToLower(server.HeaderXOwnWarmup):    "true",
+			strings.ToLower(server.HeaderXOwnStreaming): "false",
+			strings.ToLower(server.HeaderXOwnProxy):     "true",
+		},
+		RequestContext: EventRequestContext{
+			AccountId: accountId,
+			ApiId:     constants.AppName,
+			Http: HttpDetails{
+				Method: "GET",
+				Path:   "/",
+			},
+			RouteKey:  "$default",
+			Stage:     "$default",
+			Time:      now.Format(time.RFC3339),
+			TimeEpoch: now.UnixNano() / int64(time.Millisecond),
+		},
+		PathParameters: map[string]string{},
+		StageVariables: map[string]string{},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal warm-up event: %w", err)
+	}
+
+	logger.Debug("Sending warm-up invocation to Lambda function: %s", functionName)
+	_, err = m.lambdaClient.Invoke(invokeCtx, &lambda.InvokeInput{
+		FunctionName: aws.String(functionName),
+		Payload:      event,
+	})
+	return err
 }
 
 // OnRequest processes the request to invoke Lambda if appropriate
 func (m *AWSLambdaMiddleware) OnRequest(ctx *server.RequestContext, next func()) {
+	// Handle the internal endpoint that flushes the lambda function cache.
+	// The OwnStak Console calls it after the project is revived.
+	if ctx.Request.Path == constants.InternalPathPrefix+"/lambda/cache/flush" {
+		m.handleCacheFlush(ctx)
+		return
+	}
+
+	// Check the host header
+	if strings.TrimSpace(ctx.Request.Host) == "" {
+		errorMessage := fmt.Sprintf("The host header or %s header is required.\r\n", server.HeaderXOwnHost)
+		ctx.Error(errorMessage, server.StatusBadRequest)
+		return
+	}
+
+	// Parse hostname parts
+	// e.g: site-125.aws-2-account.ownstak.link
+	// site-125 is the AWS Lambda function readable name
+	// aws-2-account is the AWS account name
+	// ownstak.link is the domain name
+	hostParts := strings.Split(ctx.Request.Host, ".")
+	if len(hostParts) < 3 {
+		errorMessage := fmt.Sprintf("Invalid hostname format '%s': ", ctx.Request.Host)
+		errorMessage += "The expected format is '{project-slug}-{environment-slug}-{optional-deployment-id}.{cloudbackend-slug}.{organization-slug}.{domain-name}.'\r\n"
+		errorMessage += "e.g: nextjs-app-prod-123.aws-primary.my-org.ownstak.link\r\n"
+		errorMessage += "e.g: nextjs-app-prod.aws-primary.my-org.ownstak.link\r\n"
+		ctx.Error(errorMessage, server.StatusBadRequest)
+		return
+	}
+
+	// Get the lambda function name and alias from the host header
+	lambdaName, lambdaAlias := m.getLambdaNameAndAlias(ctx.Request.Host)
+
+	// Get the AWS account ID from caller identity
+	// if not set through AWS_ACCOUNT_ID environment variable
+	if m.accountId == "" {
+		// Get the AWS account ID from caller identity
+		accountId, err := m.getAccountIdFromCaller(ctx.Request.Context())
+		if err != nil {
+			errorMessage := fmt.Sprintf("Failed to get AWS account ID: %v", err)
+			ctx.Error(errorMessage, server.StatusInternalError)
+			return
+		}
+
+		// Store the account ID for all other invocations
+		m.accountId = accountId
+	}
+
+	// Construct the Lambda ARN
+	lambdaArn := fmt.Sprintf("arn:aws:lambda:%s:%s:function:%s:%s", m.awsConfig.Region, m.accountId, lambdaName, lambdaAlias)
+
+	// Store debug information about the lambda invocation
+	ctx.Debug("lambda-name=" + lambdaName)
+	ctx.Debug("lambda-alias=" + lambdaAlias)
+	ctx.Debug("lambda-region=" + m.awsConfig.Region)
+	ctx.Debug("lambda-streaming-mode=" + strconv.FormatBool(m.streamingMode))
+
+	// If we already know the lambda function doesn't exist,
+	// redirect the user to the OwnStak Console right away without calling the AWS Lambda API.
+	// This happens before the request takes the queue slot,
+	// so the requests to non-existing projects don't compete for the slots with the live projects.
+	found, cached := m.functionCache.Get(lambdaArn)
+	if cached && !found {
+		ctx.Debug("lambda-cache=not-found")
+		m.redirectToRevive(ctx)
+		return
+	}
+	if cached {
+		ctx.Debug("lambda-cache=hit")
+	} else {
+		ctx.Debug("lambda-cache=miss")
+	}
+
 	transferEncoding := ctx.Request.Headers.Get(server.HeaderTransferEncoding)
 	contentLength, _ := ctx.Request.ContentLength()
 
@@ -361,28 +786,97 @@ func (m *AWSLambdaMiddleware) OnRequest(ctx *server.RequestContext, next func())
 	}
 	ctx.Debug("lambda-queue-duration=" + queueWaitDuration.String())
 
-	// Check the host header
-	if strings.TrimSpace(ctx.Request.Host) == "" {
-		errorMessage := fmt.Sprintf("The host header or %s header is required.\r\n", server.HeaderXOwnHost)
-		ctx.Error(errorMessage, server.StatusBadRequest)
-		return
+	// Check if the route should be invoked asynchronously
+	asyncRoute := m.getAsyncRoute(ctx)
+
+	// Set x-own-streaming header to the request if not set yet.
+	// This header tells the ownstak-cli that the used proxy version and invocation mode
+	// supports the streaming and it can return response in streaming format.
+	// Older proxy versions don't send this header => ownstak-cli handler will return response in buffered mode.
+	// The async invocations never return the response, so there's nothing to stream.
+	ctx.Request.Headers.Set(server.HeaderXOwnStreaming, strconv.FormatBool(m.streamingMode && asyncRoute == nil))
+	// Tell the ownstak-cli which compressions of the response body we can handle.
+	// The function can compress the body to fit more data into the 6MB limit of buffered mode.
+	ctx.Request.Headers.Set(server.HeaderXOwnCompression, strings.Join(lambdaResponseCompressions, ","))
+
+	// NOTE: AWS Lambda invocation operation is quite memory intensive.
+	// The issue is that the whole invocation is sync blocking operation,
+	// so we need to hold the whole req payload including up to 6MB body
+	// in memory until we receive the response from Lambda even though it's needed only for the actual invocation.
+	var invocationErr error
+	if asyncRoute != nil {
+		invocationErr = m.invokeLambdaInAsyncMode(ctx, lambdaArn, releaseQueueSlot, asyncRoute)
+	} else {
+		invocationErr = m.invokeLambda(ctx, lambdaArn, releaseQueueSlot)
 	}
 
-	// Parse hostname parts
-	// e.g: site-125.aws-2-account.ownstak.link
-	// site-125 is the AWS Lambda function readable name
-	// aws-2-account is the AWS account name
-	// ownstak.link is the domain name
-	hostParts := strings.Split(ctx.Request.Host, ".")
-	if len(hostParts) < 3 {
-		errorMessage := fmt.Sprintf("Invalid hostname format '%s': ", ctx.Request.Host)
-		errorMessage += "The expected format is '{project-slug}-{environment-slug}-{optional-deployment-id}.{cloudbackend-slug}.{organization-slug}.{domain-name}.'\r\n"
-		errorMessage += "e.g: nextjs-app-prod-123.aws-primary.my-org.ownstak.link\r\n"
-		errorMessage += "e.g: nextjs-app-prod.aws-primary.my-org.ownstak.link\r\n"
-		ctx.Error(errorMessage, server.StatusBadRequest)
+	// Handle invocation errors
+	if invocationErr != nil {
+		// Default error
+		errorStatus := server.StatusInternalError
+		errorMessage := fmt.Sprintf("Failed to invoke Lambda function: %v", invocationErr)
+
+		if errors.Is(invocationErr, errLambdaResponseTooLarge) {
+			errorStatus = server.StatusProjectResponseTooLarge
+		}
+
+		// If the Lambda function was not found, it was probably retired.
+		// In this case, we will redirect the user to the OwnStak Console with host passed as a query parameter.
+		if strings.Contains(errorMessage, "ResourceNotFoundException") {
+			m.functionCache.Set(lambdaArn, false)
+			m.redirectToRevive(ctx)
+			return
+		}
+
+		ctx.Error(errorMessage, errorStatus)
 		return
 	}
 
+	// Remember the lambda function exists
+	if !cached {
+		m.functionCache.Set(lambdaArn, true)
+	}
+
+	// No need to call next() as we've fully handled the request
+}
+
+// getAsyncRoute returns the async route configured for the request host and path
+// or nil if the request should be invoked synchronously.
+func (m *AWSLambdaMiddleware) getAsyncRoute(ctx *server.RequestContext) *AsyncRoute {
+	routes, ok := utils.GetHostConfig(m.asyncRoutes, ctx.Request.Host)
+	if !ok {
+		return nil
+	}
+
+	for i := range routes {
+		route := &routes[i]
+		if !utils.MatchPattern(route.Path, ctx.Request.Path, '/') {
+			continue
+		}
+		if len(route.Methods) == 0 {
+			return route
+		}
+		for _, method := range route.Methods {
+			if strings.EqualFold(method, ctx.Request.Method) {
+				return route
+			}
+		}
+	}
+
+	return nil
+}
+
+// getMaxResponseSize returns the max lambda response size in bytes for the given host
+func (m *AWSLambdaMiddleware) getMaxResponseSize(host string) int {
+	if maxResponseSize, ok := utils.GetHostConfig(m.maxResponseSizes, host); ok {
+		return maxResponseSize
+	}
+	return defaultLambdaMaxResponseSize
+}
+
+// getLambdaNameAndAlias returns the lambda function name and alias for the given host
+// e.g: nextjs-app-prod-123.aws-primary.my-org.ownstak.link => ownstak-nextjs-app-prod, deployment-123
+func (m *AWSLambdaMiddleware) getLambdaNameAndAlias(host string) (string, string) {
 	// Parse lambda name from the host header
 	// IMPORTANT:
 	// The below code and logic needs to be in sync with the OwnStak Console.
@@ -390,7 +884,7 @@ func (m *AWSLambdaMiddleware) OnRequest(ctx *server.RequestContext, next func())
 	// We need to do this parsing/transformation because the host/lambda name limit is 63/64 characters
 	// and we need to fit deployment id into it and still keep it readable and nice looking.
 	// See: https://github.com/OwnStak/ownstak-console/blob/main/api/app/services/deployments/aws_deployer.rb#L312
-	lambdaHost := hostParts[0] // e.g: myproject-prod, myproject-prod-125 etc...
+	lambdaHost := strings.Split(host, ".")[0] // e.g: myproject-prod, myproject-prod-125 etc...
 
 	// We need to extract lambda name and optional deployment id
 	// from the first host segment using regex ^(.*?)(?:-(\d+))?$
@@ -419,73 +913,60 @@ func (m *AWSLambdaMiddleware) OnRequest(ctx *server.RequestContext, next func())
 		lambdaAlias = "deployment-" + deploymentId
 	}
 
-	// Get the AWS account ID from caller identity
-	// if not set through AWS_ACCOUNT_ID environment variable
-	if m.accountId == "" {
-		// Get the AWS account ID from caller identity
-		accountId, err := m.getAccountIdFromCaller(ctx)
-		if err != nil {
-			errorMessage := fmt.Sprintf("Failed to get AWS account ID: %v", err)
-			ctx.Error(errorMessage, server.StatusInternalError)
-			return
-		}
-
-		// Store the account ID for all other invocations
-		m.accountId = accountId
-	}
-
-	// Construct the Lambda ARN
-	lambdaArn := fmt.Sprintf("arn:aws:lambda:%s:%s:function:%s:%s", m.awsConfig.Region, m.accountId, lambdaName, lambdaAlias)
-
-	// Store debug information about the lambda invocation
-	ctx.Debug("lambda-name=" + lambdaName)
-	ctx.Debug("lambda-alias=" + lambdaAlias)
-	ctx.Debug("lambda-region=" + m.awsConfig.Region)
-	ctx.Debug("lambda-streaming-mode=" + strconv.FormatBool(m.streamingMode))
-
-	// Set x-own-streaming header to the request if not set yet.
-	// This header tells the ownstak-cli that the used proxy version and invocation mode
-	// supports the streaming and it can return response in streaming format.
-	// Older proxy versions don't send this header => ownstak-cli handler will return response in buffered mode.
-	ctx.Request.Headers.Set(server.HeaderXOwnStreaming, strconv.FormatBool(m.streamingMode))
+	return lambdaName, lambdaAlias
+}
 
-	// NOTE: AWS Lambda invocation operation is quite memory intensive.
-	// The issue is that the whole invocation is sync blocking operation,
-	// so we need to hold the whole req payload including up to 6MB body
-	// in memory until we receive the response from Lambda even though it's needed only for the actual invocation.
-	invocationErr := m.invokeLambda(ctx, lambdaArn, releaseQueueSlot)
+// redirectToRevive redirects the user to the OwnStak Console revive page
+// with host and original URL passed as query parameters.
+func (m *AWSLambdaMiddleware) redirectToRevive(ctx *server.RequestContext) {
+	consoleUrl := utils.GetEnvWithDefault(constants.EnvConsoleURL, "https://console.ownstak.com")
+	originalUrl := ctx.Request.OriginalURL // e.g: https://ecommerce.com/products/123
+	host := ctx.Request.Host               // e.g: ecommerce-default-123.aws-primary.org.ownstak.link
 
-	// Handle invocation errors
-	if invocationErr != nil {
-		// Default error
-		errorStatus := server.StatusInternalError
-		errorMessage := fmt.Sprintf("Failed to invoke Lambda function: %v", invocationErr)
+	redirectURL := fmt.Sprintf("%s/revive?host=%s&originalUrl=%s", consoleUrl, host, originalUrl)
+	ctx.Response.Headers.Set(server.HeaderLocation, redirectURL)
+	ctx.Response.Status = server.StatusTemporaryRedirect
+}
 
-		// If the Lambda function was not found, it was probably retired.
-		// In this case, we will redirect the user to the OwnStak Console with host passed as a query parameter.
-		if strings.Contains(errorMessage, "ResourceNotFoundException") {
-			consoleUrl := utils.GetEnvWithDefault(constants.EnvConsoleURL, "https://console.ownstak.com")
-			originalUrl := ctx.Request.OriginalURL // e.g: https://ecommerce.com/products/123
-			host := ctx.Request.Host               // e.g: ecommerce-default-123.aws-primary.org.ownstak.link
+// handleCacheFlush removes the lambda functions from the cache.
+// When the host query param is provided, only the function for given host is removed.
+// e.g: POST /__ownstak__/lambda/cache/flush?host=nextjs-app-prod-123.aws-primary.my-org.ownstak.link
+func (m *AWSLambdaMiddleware) handleCacheFlush(ctx *server.RequestContext) {
+	if ctx.Request.Method != "POST" {
+		ctx.Error("Failed to flush lambda cache: Method not allowed", server.StatusMethodNotAllowed)
+		return
+	}
+	if !ctx.IsAuthorized() {
+		ctx.Error(fmt.Sprintf("Failed to flush lambda cache: Unauthorized. The valid %s header is required.", server.HeaderXOwnApiToken), server.StatusUnauthorized)
+		return
+	}
 
-			redirectURL := fmt.Sprintf("%s/revive?host=%s&originalUrl=%s", consoleUrl, host, originalUrl)
-			ctx.Response.Headers.Set(server.HeaderLocation, redirectURL)
-			ctx.Response.Status = server.StatusTemporaryRedirect
+	suffix := ""
+	if host := strings.TrimSpace(ctx.Request.Query.Get("host")); host != "" {
+		if len(strings.Split(host, ".")) < 3 {
+			ctx.Error(fmt.Sprintf("Failed to flush lambda cache: Invalid hostname format '%s'", host), server.StatusBadRequest)
 			return
 		}
-
-		ctx.Error(errorMessage, errorStatus)
-		return
+		lambdaName, lambdaAlias := m.getLambdaNameAndAlias(host)
+		suffix = fmt.Sprintf(":function:%s:%s", lambdaName, lambdaAlias)
 	}
 
-	// No need to call next() as we've fully handled the request
+	flushed := m.functionCache.Flush(suffix)
+	logger.Info("Flushed %d lambda functions from the cache", flushed)
+
+	jsonData, _ := json.Marshal(map[string]interface{}{
+		"flushed": flushed,
+	})
+	ctx.Response.Status = server.StatusOK
+	ctx.Response.Headers.Set(server.HeaderContentType, server.ContentTypeJSON)
+	ctx.Response.Body = jsonData
 }
 
 // getAccountIdFromCaller retrieves the AWS account ID from the caller identity
-func (m *AWSLambdaMiddleware) getAccountIdFromCaller(ctx *server.RequestContext) (string, error) {
+func (m *AWSLambdaMiddleware) getAccountIdFromCaller(ctx context.Context) (string, error) {
 	// Get the caller identity using STS
 	input := &sts.GetCallerIdentityInput{}
-	result, err := m.stsClient.GetCallerIdentity(ctx.Request.Context(), input)
+	result, err := m.stsClient.GetCallerIdentity(ctx, input)
 	if err != nil {
 		return "", fmt.Errorf("failed to get AWS caller identity: %v", err)
 	}
@@ -674,12 +1155,15 @@ func (m *AWSLambdaMiddleware) invokeLambdaInStreamingMode(ctx *server.RequestCon
 	eventStream := streamOutput.GetStream()
 	defer eventStream.Close()
 
-	// Define a maximum response size limit (200MB - AWS Lambda's maximum)
-	const maxResponseSize = 200 * 1024 * 1024 // 200MB
+	// Get the maximum response size limit for the host (200MB - AWS Lambda's maximum by default)
+	maxResponseSize := m.getMaxResponseSize(ctx.Request.Host)
 	var responseSize int
 	var responseHead []byte
 	var responseHeadReceived bool
 	var responseLastChunk []byte
+	var bodyWriter *lambdaBodyWriter
+	// Always stop the body decompression when we are done
+	defer func() { bodyWriter.Close() }()
 
 	// Read the streaming response
 	for event := range eventStream.Events() {
@@ -707,9 +1191,7 @@ func (m *AWSLambdaMiddleware) invokeLambdaInStreamingMode(ctx *server.RequestCon
 			// and for cases where response with corrupted body delimiter is returned,
 			// so we just don't blindly buffer it into memory.
 			if responseSize > maxResponseSize {
-				errorMessage := fmt.Sprintf("Lambda response exceeds size limit of %d bytes", maxResponseSize)
-				ctx.Error(errorMessage, server.StatusProjectResponseTooLarge)
-				return errors.New(errorMessage)
+				return fmt.Errorf("%w of %d bytes", errLambdaResponseTooLarge, maxResponseSize)
 			}
 
 			// Store last chunk for error handling but don't accumulate all chunks
@@ -745,7 +1227,8 @@ func (m *AWSLambdaMiddleware) invokeLambdaInStreamingMode(ctx *server.RequestCon
 					logger.Debug("Lambda response head: %s", string(headPart))
 
 					// Process Lambda response and set to context
-					invocationResponseErr := m.processLambdaResponse(ctx, responsePayload)
+					var invocationResponseErr error
+					bodyWriter, invocationResponseErr = m.processLambdaResponse(ctx, responsePayload)
 					if invocationResponseErr != nil {
 						errorMessage := fmt.Sprintf("Failed to process streaming lambda response: %v", invocationResponseErr)
 						ctx.Error(errorMessage, server.StatusInternalError)
@@ -756,13 +1239,17 @@ func (m *AWSLambdaMiddleware) invokeLambdaInStreamingMode(ctx *server.RequestCon
 					responseHead = nil
 
 					// Write the body part and release memory immediately
-					ctx.Response.Write(bodyPart)
+					if err := bodyWriter.Write(bodyPart); err != nil {
+						return err
+					}
 					continue
 				}
 			} else {
 				// All remaining chunks are part of the response body
 				// Stream them directly to the client and don't accumulate in memory
-				ctx.Response.Write(chunk)
+				if err := bodyWriter.Write(chunk); err != nil {
+					return err
+				}
 				// chunk is automatically garbage collected as it goes out of scope
 			}
 		case *types.InvokeWithResponseStreamResponseEventMemberInvokeComplete:
@@ -792,7 +1279,7 @@ func (m *AWSLambdaMiddleware) invokeLambdaInStreamingMode(ctx *server.RequestCon
 				}
 
 				logger.Debug("Processing streaming lambda error response")
-				invocationResponseErr := m.processLambdaResponse(ctx, invocationResponse)
+				_, invocationResponseErr := m.processLambdaResponse(ctx, invocationResponse)
 				if invocationResponseErr != nil {
 					errorMessage := fmt.Sprintf("Failed to process streaming lambda response: %v", invocationResponseErr)
 					ctx.Error(errorMessage, server.StatusInternalError)
@@ -823,7 +1310,8 @@ func (m *AWSLambdaMiddleware) invokeLambdaInStreamingMode(ctx *server.RequestCon
 
 		// Process Lambda response and set to context
 		//logger.Debug("Processing streaming lambda response")
-		invocationResponseErr := m.processLambdaResponse(ctx, responsePayload)
+		var invocationResponseErr error
+		bodyWriter, invocationResponseErr = m.processLambdaResponse(ctx, responsePayload)
 		if invocationResponseErr != nil {
 			errorMessage := fmt.Sprintf("Failed to process streaming lambda response: %v", invocationResponseErr)
 			ctx.Error(errorMessage, server.StatusInternalError)
@@ -831,7 +1319,8 @@ func (m *AWSLambdaMiddleware) invokeLambdaInStreamingMode(ctx *server.RequestCon
 		}
 	}
 
-	return nil
+	// Wait until the rest of the compressed body is decompressed
+	return bodyWriter.Close()
 }
 
 // invokeLambdaSync invokes the specified Lambda function with the given payload using standard synchronous mode
@@ -863,18 +1352,70 @@ func (m *AWSLambdaMiddleware) invokeLambdaInBufferedMode(ctx *server.RequestCont
 	}
 
 	// Process Lambda response and set to context
-	invocationResponseErr := m.processLambdaResponse(ctx, invocationResponse)
+	bodyWriter, invocationResponseErr := m.processLambdaResponse(ctx, invocationResponse)
 	if invocationResponseErr != nil {
 		errorMessage := fmt.Sprintf("Failed to process buffered lambda response: %v", invocationResponseErr)
 		ctx.Error(errorMessage, server.StatusInternalError)
 		return invocationResponseErr
 	}
 
+	return bodyWriter.Close()
+}
+
+// invokeLambdaInAsyncMode invokes the specified Lambda function with InvocationType: Event
+// and returns the configured response right away without waiting for the function result.
+// The function timeouts and errors are never returned to the client in this mode.
+func (m *AWSLambdaMiddleware) invokeLambdaInAsyncMode(ctx *server.RequestContext, lambdaArn string, releaseQueueSlot func(), asyncRoute *AsyncRoute) error {
+	// Create API Gateway v2 JSON event
+	event, eventErr := m.createInvocationEvent(ctx, m.accountId)
+	// Free the request body from memory immediately after creating the event
+	ctx.Request.ClearBody()
+
+	if eventErr != nil {
+		errorMessage := fmt.Sprintf("Failed to create API Gateway event: %v", eventErr)
+		ctx.Error(errorMessage, server.StatusInternalError)
+		return errors.New(errorMessage)
+	}
+
+	// Use async Lambda invocation.
+	// AWS Lambda just puts the event into its internal queue and returns 202 status code.
+	input := &lambda.InvokeInput{
+		FunctionName:   aws.String(lambdaArn),
+		InvocationType: types.InvocationTypeEvent,
+		Payload:        event,
+	}
+
+	logger.Debug("Invoking Lambda function in async mode: %s", lambdaArn)
+	ctx.Debug("lambda-invocation-type=event")
+	_, invocationErr := m.lambdaClient.Invoke(ctx.Request.Context(), input)
+
+	// Free event from memory when we finish invocation and release the queue slot
+	event = nil
+	releaseQueueSlot()
+
+	if invocationErr != nil {
+		return invocationErr
+	}
+
+	status := asyncRoute.Status
+	if status == 0 {
+		status = server.StatusAccepted
+	}
+	contentType := asyncRoute.ContentType
+	if contentType == "" {
+		contentType = server.ContentTypePlain
+	}
+
+	ctx.Response.Status = status
+	ctx.Response.Headers.Set(server.HeaderContentType, contentType)
+	ctx.Response.Body = []byte(asyncRoute.Body)
 	return nil
 }
 
-// processLambdaResponse processes the Lambda response and updates the RequestContext
-func (m *AWSLambdaMiddleware) processLambdaResponse(ctx *server.RequestContext, lambdaResponse *lambda.InvokeOutput) error {
+// processLambdaResponse processes the Lambda response and updates the RequestContext.
+// It returns the writer for the rest of the response body that needs to be closed when the body ends.
+// The writer is nil for the error responses.
+func (m *AWSLambdaMiddleware) processLambdaResponse(ctx *server.RequestContext, lambdaResponse *lambda.InvokeOutput) (*lambdaBodyWriter, error) {
 	// Handle errors from the Lambda function payload
 	if lambdaResponse.FunctionError != nil {
 		var parsedPayload map[string]interface{}
@@ -882,7 +1423,7 @@ func (m *AWSLambdaMiddleware) processLambdaResponse(ctx *server.RequestContext,
 		if err != nil {
 			errorMessage := fmt.Sprintf("Failed to parse Lambda function error payload: %v, payload: %s", err, string(lambdaResponse.Payload))
 			ctx.Error(errorMessage, server.StatusInternalError)
-			return nil
+			return nil, nil
 		}
 
 		payloadErrorType := parsedPayload["errorType"].(string)
@@ -910,7 +1451,7 @@ func (m *AWSLambdaMiddleware) processLambdaResponse(ctx *server.RequestContext,
 		}
 
 		ctx.Error(errorMessage, errorStatus)
-		return nil
+		return nil, nil
 	}
 
 	// Parse the API Gateway response format
@@ -920,11 +1461,12 @@ func (m *AWSLambdaMiddleware) processLambdaResponse(ctx *server.RequestContext,
 		MultiValueHeaders map[string][]string `json:"multiValueHeaders,omitempty"`
 		Body              string              `json:"body,omitempty"`
 		IsBase64Encoded   bool                `json:"isBase64Encoded,omitempty"`
+		Compression       string              `json:"compression,omitempty"`
 	}
 
 	err := json.Unmarshal(lambdaResponse.Payload, &response)
 	if err != nil {
-		return fmt.Errorf("failed to parse lambda response: %v, response: %s", err, string(lambdaResponse.Payload))
+		return nil, fmt.Errorf("failed to parse lambda response: %v, response: %s", err, string(lambdaResponse.Payload))
 	}
 
 	// Set status code
@@ -957,20 +1499,159 @@ func (m *AWSLambdaMiddleware) processLambdaResponse(ctx *server.RequestContext,
 	// Otherwise, stream the response directly to the client.
 	ctx.Response.EnableStreaming(ctx.Response.Headers.Get(server.HeaderLocation) == "")
 
+	// Handle the body compressed by the lambda function.
+	// If the client accepts the compression, pass the compressed body through as it is,
+	// otherwise decompress it on the fly.
+	compression := strings.ToLower(response.Compression)
+	if compression != "" {
+		if !slices.Contains(lambdaResponseCompressions, compression) {
+			return nil, fmt.Errorf("unsupported lambda response compression '%s'", response.Compression)
+		}
+
+		// The content-length from lambda (if any) doesn't need to match the body we send
+		ctx.Response.Headers.Del(server.HeaderContentLength)
+		if !strings.Contains(strings.ToLower(strings.Join(ctx.Response.Headers.Values(server.HeaderVary), ",")), strings.ToLower(server.HeaderAcceptEncoding)) {
+			ctx.Response.Headers.Add(server.HeaderVary, server.HeaderAcceptEncoding)
+		}
+
+		if ctx.Request.AcceptsEncoding(compression) {
+			ctx.Debug("lambda-compression=" + compression)
+			ctx.Response.Headers.Set(server.HeaderContentEncoding, compression)
+			compression = ""
+		} else {
+			ctx.Debug("lambda-compression=" + compression + "-decompressed")
+		}
+	}
+
+	bodyWriter := newLambdaBodyWriter(ctx, compression, m.getMaxResponseSize(ctx.Request.Host))
+
 	// Set body if present
 	// e.g raw string: "<html><body><h1>Hello, World!</h1></body></html>"
 	// e.g base64 encoded: "PGh0bWw+PGJvZHk+PGgxPkV4YW1wbGUgYm9keTwvaDE+PC9ib2R5PjwvaHRtbD4="
 	if response.Body != "" {
+		bodyBytes := []byte(response.Body)
 		if response.IsBase64Encoded {
-			bodyBytes, err := base64.StdEncoding.DecodeString(response.Body)
+			bodyBytes, err = base64.StdEncoding.DecodeString(response.Body)
 			if err != nil {
-				return fmt.Errorf("failed to decode base64 response body: %v", err)
+				bodyWriter.Close()
+				return nil, fmt.Errorf("failed to decode base64 response body: %v", err)
 			}
-			ctx.Response.Write(bodyBytes)
-		} else {
-			ctx.Response.Write([]byte(response.Body))
+		}
+		if err := bodyWriter.Write(bodyBytes); err != nil {
+			bodyWriter.Close()
+			return nil, err
 		}
 	}
 
+	return bodyWriter, nil
+}
+
+// lambdaBodyWriter writes the lambda response body to the client
+// and enforces the max response size. When the lambda function returns
+// compressed body that the client doesn't accept, the body is decompressed on the fly.
+type lambdaBodyWriter struct {
+	ctx         *server.RequestContext
+	maxSize     int
+	size        int
+	pipeWriter  *io.PipeWriter
+	decoderDone chan error
+	decoderErr  error
+	closed      bool
+}
+
+// newLambdaBodyWriter creates the body writer.
+// The compression should be empty when the body doesn't need to be decompressed.
+func newLambdaBodyWriter(ctx *server.RequestContext, compression string, maxSize int) *lambdaBodyWriter {
+	bodyWriter := &lambdaBodyWriter{
+		ctx:     ctx,
+		maxSize: maxSize,
+	}
+	if compression == "" {
+		return bodyWriter
+	}
+
+	// Decompress the chunks in separate goroutine, so we can stream them
+	// to the client without buffering the whole compressed body in memory.
+	pipeReader, pipeWriter := io.Pipe()
+	bodyWriter.pipeWriter = pipeWriter
+	bodyWriter.decoderDone = make(chan error, 1)
+	go func() {
+		err := bodyWriter.decode(pipeReader, compression)
+		pipeReader.CloseWithError(err)
+		bodyWriter.decoderDone <- err
+	}()
+
+	return bodyWriter
+}
+
+// Write writes the body chunk to the response
+func (w *lambdaBodyWriter) Write(chunk []byte) error {
+	if w.pipeWriter == nil {
+		return w.write(chunk)
+	}
+	// The decoder finished before the end of the data, ignore the rest
+	if _, err := w.pipeWriter.Write(chunk); err != nil && !errors.Is(err, io.ErrClosedPipe) {
+		return err
+	}
 	return nil
 }
+
+// Close finishes the body decompression and returns the decompression error if any.
+// It's safe to call it multiple times and on nil writer.
+func (w *lambdaBodyWriter) Close() error {
+	if w == nil || w.pipeWriter == nil {
+		return nil
+	}
+	if !w.closed {
+		w.closed = true
+		w.pipeWriter.Close()
+		w.decoderErr = <-w.decoderDone
+	}
+	return w.decoderErr
+}
+
+func (w *lambdaBodyWriter) write(chunk []byte) error {
+	w.size += len(chunk)
+	if w.size > w.maxSize {
+		return fmt.Errorf("%w of %d bytes", errLambdaResponseTooLarge, w.maxSize)
+	}
+	w.ctx.Response.Write(chunk)
+	return nil
+}
+
+func (w *lambdaBodyWriter) decode(reader io.Reader, compression string) error {
+	var decoder io.Reader
+	switch compression {
+	case "gzip":
+		gzipReader, err := gzip.NewReader(reader)
+		if errors.Is(err, io.EOF) {
+			// Empty body
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to decompress gzip response body: %v", err)
+		}
+		defer gzipReader.Close()
+		decoder = gzipReader
+	case "br":
+		decoder = brotli.NewReader(reader)
+	default:
+		return fmt.Errorf("unsupported lambda response compression '%s'", compression)
+	}
+
+	buffer := make([]byte, 32*1024)
+	for {
+		n, err := decoder.Read(buffer)
+		if n > 0 {
+			if writeErr := w.write(buffer[:n]); writeErr != nil {
+				return writeErr
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to decompress %s response body: %v", compression, err)
+		}
+	}
+}
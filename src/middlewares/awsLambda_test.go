@@ -2,10 +2,12 @@ package middlewares
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -14,8 +16,12 @@ import (
 	"ownstak-proxy/src/server"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/andybalholm/brotli"
 	"github.com/aws/aws-sdk-go-v2/aws/protocol/eventstream"
 	"github.com/jarcoal/httpmock"
 	"github.com/stretchr/testify/assert"
@@ -58,6 +64,37 @@ func TestNewAWSLambdaMiddleware(t *testing.T) {
 		assert.Equal(t, "123456789012", middleware.accountId, "should set account ID from environment")
 	})
 
+	t.Run("should parse max response size configuration", func(t *testing.T) {
+		os.Setenv(constants.EnvProvider, constants.ProviderAWS)
+		t.Setenv(constants.EnvLambdaMaxResponseSize, `{"*": "100MB", "big.*.my-org.ownstak.link": "500MB", "invalid.ownstak.link": "lots"}`)
+
+		middleware := NewAWSLambdaMiddleware()
+		require.NotNil(t, middleware)
+		assert.Equal(t, map[string]int{
+			"*":                         100 * 1024 * 1024,
+			"big.*.my-org.ownstak.link": 500 * 1024 * 1024,
+		}, middleware.maxResponseSizes)
+		assert.Equal(t, 500*1024*1024, middleware.getMaxResponseSize("big.aws-primary.my-org.ownstak.link"))
+		assert.Equal(t, 100*1024*1024, middleware.getMaxResponseSize("small.aws-primary.my-org.ownstak.link"))
+	})
+
+	t.Run("should parse warm-up configuration", func(t *testing.T) {
+		os.Setenv(constants.EnvProvider, constants.ProviderAWS)
+		t.Setenv(constants.EnvLambdaWarmupFunctions, "ownstak-app-prod, ownstak-app-prod:deployment-12,,arn:aws:lambda:us-east-1:123456789012:function:ownstak-other-prod")
+		t.Setenv(constants.EnvLambdaWarmupInterval, "1m")
+		t.Setenv(constants.EnvLambdaWarmupConcurrency, "invalid")
+
+		middleware := NewAWSLambdaMiddleware()
+		require.NotNil(t, middleware)
+		assert.Equal(t, []string{
+			"ownstak-app-prod:current",
+			"ownstak-app-prod:deployment-12",
+			"arn:aws:lambda:us-east-1:123456789012:function:ownstak-other-prod",
+		}, middleware.warmupFunctions)
+		assert.Equal(t, time.Minute, middleware.warmupInterval)
+		assert.Equal(t, defaultLambdaWarmupConcurrency, middleware.warmupConcurrency)
+	})
+
 	t.Run("should support custom endpoints", func(t *testing.T) {
 		os.Setenv(constants.EnvProvider, constants.ProviderAWS)
 		os.Setenv(constants.EnvAWSLambdaEndpoint, "http://localhost:4566")
@@ -2156,6 +2193,708 @@ func TestAWSLambdaMiddleware(t *testing.T) {
 			})
 		})
 	})
+
+	t.Run("function cache", func(t *testing.T) {
+		middleware.streamingMode = false
+		middleware.OnStart(createTestServer())
+
+		// Helper that registers not found mock and counts the lambda API invocations
+		registerNotFoundLambdaMock := func() *int {
+			invocations := 0
+			httpmock.RegisterResponder("POST", `=~^http://localhost:4566/2015-03-31/functions/.*?/invocations$`,
+				func(req *http.Request) (*http.Response, error) {
+					invocations++
+					return httpmock.NewStringResponse(404, `{"__type":"ResourceNotFoundException","message":"The resource you requested does not exist."}`), nil
+				},
+			)
+			return &invocations
+		}
+
+		// Helper that sends request to given host and returns the request context
+		sendRequest := func(host string, path ...string) *server.RequestContext {
+			reqPath := "/test"
+			if len(path) > 0 {
+				reqPath = path[0]
+			}
+			req := httptest.NewRequest("GET", reqPath, nil)
+			req.Host = "example.com"
+			req.Header.Set(server.HeaderXOwnHost, host)
+			req.Header.Set(server.HeaderXOwnDebug, "true")
+			res := httptest.NewRecorder()
+
+			serverReq, err := server.NewRequest(req)
+			require.NoError(t, err)
+			serverRes := server.NewResponse(res)
+			ctx := server.NewRequestContext(serverReq, serverRes, createTestServer())
+			middleware.OnRequest(ctx, func() {})
+			return ctx
+		}
+
+		t.Run("should not invoke lambda again when function is known to not exist", func(t *testing.T) {
+			middleware.functionCache.Flush("")
+			invocations := registerNotFoundLambdaMock()
+
+			ctx := sendRequest("cache-notfound.aws-primary.org.ownstak.link")
+			assert.Equal(t, server.StatusTemporaryRedirect, ctx.Response.Status)
+			assert.Contains(t, ctx.Response.Headers.Get(server.HeaderXOwnProxyDebug), "lambda-cache=miss")
+
+			ctx = sendRequest("cache-notfound.aws-primary.org.ownstak.link", "/other-page")
+			assert.Equal(t, server.StatusTemporaryRedirect, ctx.Response.Status)
+			assert.Contains(t, ctx.Response.Headers.Get(server.HeaderLocation), "revive")
+			assert.Contains(t, ctx.Response.Headers.Get(server.HeaderLocation), "/other-page")
+			assert.Contains(t, ctx.Response.Headers.Get(server.HeaderXOwnProxyDebug), "lambda-cache=not-found")
+
+			assert.Equal(t, 1, *invocations)
+		})
+
+		t.Run("should redirect known not found functions without taking the queue slot", func(t *testing.T) {
+			middleware.functionCache.Flush("")
+			invocations := registerNotFoundLambdaMock()
+			sendRequest("cache-queue-full.aws-primary.org.ownstak.link")
+
+			for i := 0; i < middleware.highPriorityQueueConcurrency; i++ {
+				middleware.highPriorityQueue <- struct{}{}
+			}
+			defer func() {
+				for i := 0; i < middleware.highPriorityQueueConcurrency; i++ {
+					<-middleware.highPriorityQueue
+				}
+			}()
+
+			ctx := sendRequest("cache-queue-full.aws-primary.org.ownstak.link")
+			assert.Equal(t, server.StatusTemporaryRedirect, ctx.Response.Status)
+			assert.Contains(t, ctx.Response.Headers.Get(server.HeaderXOwnProxyDebug), "lambda-cache=not-found")
+			assert.Equal(t, 1, *invocations)
+		})
+
+		t.Run("should invoke lambda again after the not found entry expires", func(t *testing.T) {
+			middleware.functionCache.Flush("")
+			originalNotFoundTTL := middleware.functionCache.notFoundTTL
+			middleware.functionCache.notFoundTTL = time.Millisecond
+			defer func() { middleware.functionCache.notFoundTTL = originalNotFoundTTL }()
+			invocations := registerNotFoundLambdaMock()
+
+			sendRequest("cache-expired.aws-primary.org.ownstak.link")
+			time.Sleep(5 * time.Millisecond)
+			sendRequest("cache-expired.aws-primary.org.ownstak.link")
+
+			assert.Equal(t, 2, *invocations)
+		})
+
+		t.Run("should remember existing lambda functions", func(t *testing.T) {
+			middleware.functionCache.Flush("")
+			registerBufferedLambdaMock(t, []byte(`{"statusCode":200,"body":"Hello"}`))
+
+			ctx := sendRequest("cache-found.aws-primary.org.ownstak.link")
+			assert.Equal(t, 200, ctx.Response.Status)
+			assert.Contains(t, ctx.Response.Headers.Get(server.HeaderXOwnProxyDebug), "lambda-cache=miss")
+
+			ctx = sendRequest("cache-found.aws-primary.org.ownstak.link")
+			assert.Equal(t, 200, ctx.Response.Status)
+			assert.Contains(t, ctx.Response.Headers.Get(server.HeaderXOwnProxyDebug), "lambda-cache=hit")
+		})
+
+		t.Run("should not cache lambda functions when TTL is zero", func(t *testing.T) {
+			middleware.functionCache.Flush("")
+			originalNotFoundTTL := middleware.functionCache.notFoundTTL
+			middleware.functionCache.notFoundTTL = 0
+			defer func() { middleware.functionCache.notFoundTTL = originalNotFoundTTL }()
+			invocations := registerNotFoundLambdaMock()
+
+			sendRequest("cache-disabled.aws-primary.org.ownstak.link")
+			sendRequest("cache-disabled.aws-primary.org.ownstak.link")
+
+			assert.Equal(t, 2, *invocations)
+		})
+
+		t.Run("cache flush endpoint", func(t *testing.T) {
+			originalApiToken := os.Getenv(constants.EnvInternalApiToken)
+			os.Setenv(constants.EnvInternalApiToken, "secret-token")
+			defer os.Setenv(constants.EnvInternalApiToken, originalApiToken)
+
+			sendFlushRequest := func(method, query, apiToken string) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(method, "/__ownstak__/lambda/cache/flush"+query, nil)
+				req.Host = "proxy.ownstak.link"
+				if apiToken != "" {
+					req.Header.Set(server.HeaderXOwnApiToken, apiToken)
+				}
+				res := httptest.NewRecorder()
+
+				serverReq, err := server.NewRequest(req)
+				require.NoError(t, err)
+				serverRes := server.NewResponse(res)
+				ctx := server.NewRequestContext(serverReq, serverRes, createTestServer())
+				middleware.OnRequest(ctx, func() {})
+				serverRes.End()
+				return res
+			}
+
+			t.Run("should flush all functions", func(t *testing.T) {
+				middleware.functionCache.Flush("")
+				invocations := registerNotFoundLambdaMock()
+				sendRequest("flush-all-1.aws-primary.org.ownstak.link")
+				sendRequest("flush-all-2.aws-primary.org.ownstak.link")
+
+				res := sendFlushRequest("POST", "", "secret-token")
+				assert.Equal(t, 200, res.Code)
+				assert.JSONEq(t, `{"flushed":2}`, res.Body.String())
+
+				sendRequest("flush-all-1.aws-primary.org.ownstak.link")
+				assert.Equal(t, 3, *invocations)
+			})
+
+			t.Run("should flush only the function for given host", func(t *testing.T) {
+				middleware.functionCache.Flush("")
+				invocations := registerNotFoundLambdaMock()
+				sendRequest("flush-host-123.aws-primary.org.ownstak.link")
+				sendRequest("flush-other.aws-primary.org.ownstak.link")
+
+				res := sendFlushRequest("POST", "?host=flush-host-123.aws-primary.org.ownstak.link", "secret-token")
+				assert.Equal(t, 200, res.Code)
+				assert.JSONEq(t, `{"flushed":1}`, res.Body.String())
+
+				sendRequest("flush-host-123.aws-primary.org.ownstak.link")
+				sendRequest("flush-other.aws-primary.org.ownstak.link")
+				assert.Equal(t, 3, *invocations)
+			})
+
+			t.Run("should return 401 when api token is invalid", func(t *testing.T) {
+				res := sendFlushRequest("POST", "", "wrong-token")
+				assert.Equal(t, server.StatusUnauthorized, res.Code)
+			})
+
+			t.Run("should return 401 when api token is missing", func(t *testing.T) {
+				res := sendFlushRequest("POST", "", "")
+				assert.Equal(t, server.StatusUnauthorized, res.Code)
+			})
+
+			t.Run("should return 405 for other methods than POST", func(t *testing.T) {
+				res := sendFlushRequest("GET", "", "secret-token")
+				assert.Equal(t, server.StatusMethodNotAllowed, res.Code)
+			})
+
+			t.Run("should return 400 for invalid host", func(t *testing.T) {
+				res := sendFlushRequest("POST", "?host=invalid-host", "secret-token")
+				assert.Equal(t, server.StatusBadRequest, res.Code)
+			})
+		})
+	})
+
+	t.Run("async mode", func(t *testing.T) {
+		middleware.streamingMode = true
+		middleware.OnStart(createTestServer())
+		middleware.asyncRoutes = map[string][]AsyncRoute{
+			"*.aws-primary.org.ownstak.link": {
+				{Path: "/api/webhooks/**", Methods: []string{"POST"}},
+				{Path: "/beacon", Status: 204},
+				{Path: "/api/events", Status: 200, Body: `{"accepted":true}`, ContentType: "application/json"},
+			},
+		}
+		defer func() { middleware.asyncRoutes = map[string][]AsyncRoute{} }()
+
+		// Helper that registers async invocation mock and returns the received invocation types
+		registerAsyncLambdaMock := func() *[]string {
+			invocationTypes := []string{}
+			httpmock.RegisterResponder("POST", `=~^http://localhost:4566/2015-03-31/functions/.*?/invocations$`,
+				func(req *http.Request) (*http.Response, error) {
+					invocationTypes = append(invocationTypes, req.Header.Get("X-Amz-Invocation-Type"))
+					return httpmock.NewStringResponse(202, ""), nil
+				},
+			)
+			return &invocationTypes
+		}
+
+		// Helper that sends request and returns the response recorder and context
+		sendRequest := func(method, path, host string) (*httptest.ResponseRecorder, *server.RequestContext) {
+			req := httptest.NewRequest(method, path, strings.NewReader(`{"event":"payment.succeeded"}`))
+			req.Host = host
+			res := httptest.NewRecorder()
+
+			serverReq, err := server.NewRequest(req)
+			require.NoError(t, err)
+			serverRes := server.NewResponse(res)
+			ctx := server.NewRequestContext(serverReq, serverRes, createTestServer())
+			middleware.OnRequest(ctx, func() {})
+			serverRes.End()
+			return res, ctx
+		}
+
+		t.Run("should invoke lambda with event invocation type and return 202", func(t *testing.T) {
+			invocationTypes := registerAsyncLambdaMock()
+
+			res, ctx := sendRequest("POST", "/api/webhooks/stripe", "async-test.aws-primary.org.ownstak.link")
+
+			assert.Equal(t, 202, res.Code)
+			assert.Equal(t, "", res.Body.String())
+			assert.Equal(t, []string{"Event"}, *invocationTypes)
+			assert.Equal(t, "false", ctx.Request.Headers.Get(server.HeaderXOwnStreaming))
+		})
+
+		t.Run("should return configured status, body and content type", func(t *testing.T) {
+			registerAsyncLambdaMock()
+
+			res, _ := sendRequest("GET", "/api/events", "async-test.aws-primary.org.ownstak.link")
+
+			assert.Equal(t, 200, res.Code)
+			assert.Equal(t, "application/json", res.Header().Get("Content-Type"))
+			assert.Equal(t, `{"accepted":true}`, res.Body.String())
+		})
+
+		t.Run("should return configured status without body", func(t *testing.T) {
+			registerAsyncLambdaMock()
+
+			res, _ := sendRequest("POST", "/beacon", "async-test.aws-primary.org.ownstak.link")
+
+			assert.Equal(t, 204, res.Code)
+		})
+
+		t.Run("should invoke lambda synchronously when method doesn't match", func(t *testing.T) {
+			registerStreamingLambdaMock(t, [][]byte{
+				[]byte("{\"statusCode\":200,\"headers\":{\"Content-Type\":\"text/html\"}}"),
+				[]byte("\x00\x00\x00\x00\x00\x00\x00\x00"),
+				[]byte("<h1>Sync response</h1>"),
+			})
+
+			res, _ := sendRequest("GET", "/api/webhooks/stripe", "async-test.aws-primary.org.ownstak.link")
+
+			assert.Equal(t, 200, res.Code)
+			assert.Contains(t, res.Body.String(), "Sync response")
+		})
+
+		t.Run("should invoke lambda synchronously when host doesn't match", func(t *testing.T) {
+			registerStreamingLambdaMock(t, [][]byte{
+				[]byte("{\"statusCode\":200,\"headers\":{\"Content-Type\":\"text/html\"}}"),
+				[]byte("\x00\x00\x00\x00\x00\x00\x00\x00"),
+				[]byte("<h1>Sync response</h1>"),
+			})
+
+			res, _ := sendRequest("POST", "/api/webhooks/stripe", "async-test.aws-secondary.org.ownstak.link")
+
+			assert.Equal(t, 200, res.Code)
+			assert.Contains(t, res.Body.String(), "Sync response")
+		})
+
+		t.Run("should redirect to revive when function is not found", func(t *testing.T) {
+			httpmock.RegisterResponder("POST", `=~^http://localhost:4566/2015-03-31/functions/.*?/invocations$`,
+				func(req *http.Request) (*http.Response, error) {
+					return httpmock.NewStringResponse(404, `{"__type":"ResourceNotFoundException","message":"The resource you requested does not exist."}`), nil
+				},
+			)
+
+			_, ctx := sendRequest("POST", "/api/webhooks/stripe", "async-notfound.aws-primary.org.ownstak.link")
+
+			assert.Equal(t, server.StatusTemporaryRedirect, ctx.Response.Status)
+			assert.Contains(t, ctx.Response.Headers.Get(server.HeaderLocation), "revive")
+		})
+
+		t.Run("should throttle async requests when queue is full", func(t *testing.T) {
+			invocationTypes := registerAsyncLambdaMock()
+			testServer := &server.Server{
+				MaxMemory:  16 * 1024,
+				UsedMemory: 0,
+			}
+			middleware.OnStart(testServer)
+			defer middleware.OnStart(createTestServer())
+
+			for i := 0; i < middleware.highPriorityQueueConcurrency; i++ {
+				middleware.highPriorityQueue <- struct{}{}
+			}
+			defer func() {
+				for i := 0; i < middleware.highPriorityQueueConcurrency; i++ {
+					<-middleware.highPriorityQueue
+				}
+			}()
+
+			res, _ := sendRequest("POST", "/api/webhooks/stripe", "async-test.aws-primary.org.ownstak.link")
+
+			assert.Equal(t, server.StatusServiceOverloaded, res.Code)
+			assert.Empty(t, *invocationTypes)
+		})
+	})
+
+	t.Run("response size limit and compression", func(t *testing.T) {
+		middleware.OnStart(createTestServer())
+		middleware.maxResponseSizes = map[string]int{
+			"limited.aws-primary.org.ownstak.link": 64,
+		}
+		defer func() {
+			middleware.streamingMode = true
+			middleware.maxResponseSizes = map[string]int{}
+		}()
+
+		largeBody := strings.Repeat("<p>Hello from compressed Lambda!</p>", 100)
+		gzipBody := func(body string) []byte {
+			var buf bytes.Buffer
+			writer := gzip.NewWriter(&buf)
+			writer.Write([]byte(body))
+			writer.Close()
+			return buf.Bytes()
+		}
+		brotliBody := func(body string) []byte {
+			var buf bytes.Buffer
+			writer := brotli.NewWriter(&buf)
+			writer.Write([]byte(body))
+			writer.Close()
+			return buf.Bytes()
+		}
+
+		// Helper that sends request with given accept-encoding header
+		sendRequest := func(host string, acceptEncoding string) (*httptest.ResponseRecorder, *server.RequestContext) {
+			req := httptest.NewRequest("GET", "/test", nil)
+			req.Host = host
+			if acceptEncoding != "" {
+				req.Header.Set(server.HeaderAcceptEncoding, acceptEncoding)
+			}
+			res := httptest.NewRecorder()
+
+			serverReq, err := server.NewRequest(req)
+			require.NoError(t, err)
+			serverRes := server.NewResponse(res)
+			ctx := server.NewRequestContext(serverReq, serverRes, createTestServer())
+
+			middleware.OnRequest(ctx, func() {})
+			return res, ctx
+		}
+
+		t.Run("should send x-own-compression header to lambda", func(t *testing.T) {
+			middleware.streamingMode = false
+			var event ApiGatewayV2Event
+			httpmock.RegisterResponder("POST", `=~^http://localhost:4566/2015-03-31/functions/.*?/invocations$`,
+				func(req *http.Request) (*http.Response, error) {
+					body, _ := io.ReadAll(req.Body)
+					json.Unmarshal(body, &event)
+					return httpmock.NewStringResponse(200, `{"statusCode":200,"body":"OK"}`), nil
+				},
+			)
+
+			res, _ := sendRequest("compression-test.aws-primary.org.ownstak.link", "")
+
+			assert.Equal(t, 200, res.Code)
+			assert.Equal(t, "gzip,br", event.Headers["x-own-compression"])
+		})
+
+		t.Run("should decompress buffered gzip body when client doesn't accept gzip", func(t *testing.T) {
+			middleware.streamingMode = false
+			response, _ := json.Marshal(map[string]interface{}{
+				"statusCode":      200,
+				"headers":         map[string]string{"Content-Type": "text/html"},
+				"body":            base64.StdEncoding.EncodeToString(gzipBody(largeBody)),
+				"isBase64Encoded": true,
+				"compression":     "gzip",
+			})
+			registerBufferedLambdaMock(t, response)
+
+			res, _ := sendRequest("compression-test.aws-primary.org.ownstak.link", "br;q=0, deflate")
+
+			assert.Equal(t, 200, res.Code)
+			assert.Empty(t, res.Header().Get(server.HeaderContentEncoding))
+			assert.Equal(t, server.HeaderAcceptEncoding, res.Header().Get(server.HeaderVary))
+			assert.Equal(t, largeBody, res.Body.String())
+		})
+
+		t.Run("should pass through buffered gzip body when client accepts gzip", func(t *testing.T) {
+			middleware.streamingMode = false
+			compressedBody := gzipBody(largeBody)
+			response, _ := json.Marshal(map[string]interface{}{
+				"statusCode":      200,
+				"headers":         map[string]string{"Content-Type": "text/html", "Content-Length": strconv.Itoa(len(largeBody))},
+				"body":            base64.StdEncoding.EncodeToString(compressedBody),
+				"isBase64Encoded": true,
+				"compression":     "gzip",
+			})
+			registerBufferedLambdaMock(t, response)
+
+			res, _ := sendRequest("compression-test.aws-primary.org.ownstak.link", "gzip, br")
+
+			assert.Equal(t, 200, res.Code)
+			assert.Equal(t, "gzip", res.Header().Get(server.HeaderContentEncoding))
+			assert.Equal(t, server.HeaderAcceptEncoding, res.Header().Get(server.HeaderVary))
+			assert.NotEqual(t, strconv.Itoa(len(largeBody)), res.Header().Get(server.HeaderContentLength))
+			assert.Equal(t, compressedBody, res.Body.Bytes())
+		})
+
+		t.Run("should return error for unsupported compression", func(t *testing.T) {
+			middleware.streamingMode = false
+			registerBufferedLambdaMock(t, []byte(`{"statusCode":200,"body":"compressed","compression":"zstd"}`))
+
+			res, _ := sendRequest("compression-test.aws-primary.org.ownstak.link", "")
+
+			assert.Equal(t, server.StatusInternalError, res.Code)
+			assert.Contains(t, res.Body.String(), "unsupported lambda response compression 'zstd'")
+		})
+
+		t.Run("should return error when decompressed buffered body exceeds host limit", func(t *testing.T) {
+			middleware.streamingMode = false
+			response, _ := json.Marshal(map[string]interface{}{
+				"statusCode":      200,
+				"body":            base64.StdEncoding.EncodeToString(gzipBody(largeBody)),
+				"isBase64Encoded": true,
+				"compression":     "gzip",
+			})
+			registerBufferedLambdaMock(t, response)
+
+			res, _ := sendRequest("limited.aws-primary.org.ownstak.link", "")
+
+			assert.Equal(t, server.StatusProjectResponseTooLarge, res.Code)
+			assert.Contains(t, res.Body.String(), "lambda response exceeds size limit of 64 bytes")
+		})
+
+		t.Run("should decompress streaming brotli body split into chunks", func(t *testing.T) {
+			middleware.streamingMode = true
+			compressedBody := brotliBody(largeBody)
+			middlePart := len(compressedBody) / 2
+			registerStreamingLambdaMock(t, [][]byte{
+				[]byte(`{"statusCode":200,"headers":{"Content-Type":"text/html"},"compression":"br"}`),
+				[]byte(StreamingBodyDelimiter),
+				compressedBody[:middlePart],
+				compressedBody[middlePart:],
+			})
+
+			res, _ := sendRequest("compression-test.aws-primary.org.ownstak.link", "gzip")
+
+			assert.Equal(t, 200, res.Code)
+			assert.Empty(t, res.Header().Get(server.HeaderContentEncoding))
+			assert.Equal(t, largeBody, res.Body.String())
+		})
+
+		t.Run("should pass through streaming brotli body when client accepts br", func(t *testing.T) {
+			middleware.streamingMode = true
+			compressedBody := brotliBody(largeBody)
+			registerStreamingLambdaMock(t, [][]byte{
+				[]byte(`{"statusCode":200,"headers":{"Content-Type":"text/html"},"compression":"br"}`),
+				[]byte(StreamingBodyDelimiter),
+				compressedBody,
+			})
+
+			res, _ := sendRequest("compression-test.aws-primary.org.ownstak.link", "gzip, deflate, br")
+
+			assert.Equal(t, 200, res.Code)
+			assert.Equal(t, "br", res.Header().Get(server.HeaderContentEncoding))
+			assert.Equal(t, compressedBody, res.Body.Bytes())
+		})
+
+		t.Run("should abort streaming response when decompressed body exceeds host limit", func(t *testing.T) {
+			middleware.streamingMode = true
+			registerStreamingLambdaMock(t, [][]byte{
+				[]byte(`{"statusCode":200,"headers":{"Content-Type":"text/html"},"compression":"gzip"}`),
+				[]byte(StreamingBodyDelimiter),
+				gzipBody(largeBody),
+			})
+
+			_, ctx := sendRequest("limited.aws-primary.org.ownstak.link", "")
+
+			assert.Equal(t, server.StatusProjectResponseTooLarge, ctx.ErrorStatus)
+		})
+
+		t.Run("should return error when streaming response exceeds host limit", func(t *testing.T) {
+			middleware.streamingMode = true
+			registerStreamingLambdaMock(t, [][]byte{
+				[]byte(`{"statusCode":200,"headers":{"Content-Type":"text/html"}}`),
+				[]byte(StreamingBodyDelimiter),
+				[]byte(largeBody),
+			})
+
+			res, _ := sendRequest("limited.aws-primary.org.ownstak.link", "")
+			assert.Equal(t, server.StatusProjectResponseTooLarge, res.Code)
+
+			// Other hosts use the default limit
+			res, _ = sendRequest("compression-test.aws-primary.org.ownstak.link", "")
+			assert.Equal(t, 200, res.Code)
+			assert.Equal(t, largeBody, res.Body.String())
+		})
+	})
+
+	t.Run("warm-up", func(t *testing.T) {
+		// Helper that registers warm-up invocation mock and returns the received invocations
+		registerWarmupLambdaMock := func() (*sync.Mutex, *[]string, *[]ApiGatewayV2Event, *int32) {
+			mutex := &sync.Mutex{}
+			functionPaths := []string{}
+			events := []ApiGatewayV2Event{}
+			var inFlight, maxInFlight int32
+			httpmock.RegisterResponder("POST", `=~^http://localhost:4566/2015-03-31/functions/.*?/invocations$`,
+				func(req *http.Request) (*http.Response, error) {
+					current := atomic.AddInt32(&inFlight, 1)
+					defer atomic.AddInt32(&inFlight, -1)
+					for {
+						previous := atomic.LoadInt32(&maxInFlight)
+						if current <= previous || atomic.CompareAndSwapInt32(&maxInFlight, previous, current) {
+							break
+						}
+					}
+					time.Sleep(5 * time.Millisecond)
+
+					var event ApiGatewayV2Event
+					body, _ := io.ReadAll(req.Body)
+					json.Unmarshal(body, &event)
+
+					mutex.Lock()
+					functionPaths = append(functionPaths, req.URL.Path)
+					events = append(events, event)
+					mutex.Unlock()
+					return httpmock.NewStringResponse(200, `{"statusCode":200}`), nil
+				},
+			)
+			return mutex, &functionPaths, &events, &maxInFlight
+		}
+
+		t.Run("should not start when no functions are configured", func(t *testing.T) {
+			middleware.warmupFunctions = []string{}
+			middleware.startWarmup()
+			assert.Nil(t, middleware.warmupCancel)
+			middleware.stopWarmup()
+		})
+
+		t.Run("should periodically send ping invocations to configured functions", func(t *testing.T) {
+			mutex, functionPaths, events, _ := registerWarmupLambdaMock()
+			middleware.warmupFunctions = []string{"ownstak-warm-prod:current", "ownstak-other-prod:deployment-12"}
+			middleware.warmupInterval = 20 * time.Millisecond
+			middleware.warmupConcurrency = 2
+			defer func() { middleware.warmupFunctions = []string{} }()
+
+			middleware.startWarmup()
+			assert.Eventually(t, func() bool {
+				mutex.Lock()
+				defer mutex.Unlock()
+				return len(*functionPaths) >= 4
+			}, time.Second, 5*time.Millisecond)
+			middleware.stopWarmup()
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			assert.Contains(t, *functionPaths, "/2015-03-31/functions/ownstak-warm-prod:current/invocations")
+			assert.Contains(t, *functionPaths, "/2015-03-31/functions/ownstak-other-prod:deployment-12/invocations")
+			for _, event := range *events {
+				assert.Equal(t, "true", event.Headers["x-own-warmup"])
+				assert.Equal(t, "false", event.Headers["x-own-streaming"])
+				assert.Equal(t, "GET", event.RequestContext.Http.Method)
+				assert.Equal(t, "/", event.RawPath)
+			}
+		})
+
+		t.Run("should resolve the account ID before the first ping invocation", func(t *testing.T) {
+			mutex, functionPaths, events, _ := registerWarmupLambdaMock()
+			originalAccountId := middleware.accountId
+			middleware.accountId = ""
+			middleware.warmupFunctions = []string{"ownstak-warm-prod:current"}
+			middleware.warmupInterval = time.Hour
+			middleware.warmupConcurrency = 1
+			defer func() {
+				middleware.warmupFunctions = []string{}
+				middleware.accountId = originalAccountId
+			}()
+
+			middleware.startWarmup()
+			assert.Eventually(t, func() bool {
+				mutex.Lock()
+				defer mutex.Unlock()
+				return len(*functionPaths) >= 1
+			}, time.Second, 5*time.Millisecond)
+			middleware.stopWarmup()
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			assert.Equal(t, "123456789012", (*events)[0].RequestContext.AccountId)
+			assert.Equal(t, "123456789012", middleware.accountId)
+		})
+
+		t.Run("should limit the number of concurrent ping invocations", func(t *testing.T) {
+			mutex, functionPaths, _, maxInFlight := registerWarmupLambdaMock()
+			middleware.warmupFunctions = []string{"ownstak-a-prod:current", "ownstak-b-prod:current", "ownstak-c-prod:current", "ownstak-d-prod:current"}
+			middleware.warmupInterval = time.Hour
+			middleware.warmupConcurrency = 1
+			defer func() { middleware.warmupFunctions = []string{} }()
+
+			middleware.startWarmup()
+			assert.Eventually(t, func() bool {
+				mutex.Lock()
+				defer mutex.Unlock()
+				return len(*functionPaths) >= 4
+			}, time.Second, 5*time.Millisecond)
+			middleware.stopWarmup()
+
+			assert.Equal(t, int32(1), atomic.LoadInt32(maxInFlight))
+		})
+
+		t.Run("should stop sending ping invocations after stop", func(t *testing.T) {
+			mutex, functionPaths, _, _ := registerWarmupLambdaMock()
+			middleware.warmupFunctions = []string{"ownstak-warm-prod:current"}
+			middleware.warmupInterval = 10 * time.Millisecond
+			middleware.warmupConcurrency = 1
+			defer func() { middleware.warmupFunctions = []string{} }()
+
+			middleware.startWarmup()
+			assert.Eventually(t, func() bool {
+				mutex.Lock()
+				defer mutex.Unlock()
+				return len(*functionPaths) >= 1
+			}, time.Second, 5*time.Millisecond)
+			middleware.OnStop(createTestServer())
+			assert.Nil(t, middleware.warmupCancel)
+
+			mutex.Lock()
+			invocations := len(*functionPaths)
+			mutex.Unlock()
+
+			time.Sleep(50 * time.Millisecond)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			assert.Equal(t, invocations, len(*functionPaths))
+		})
+	})
+}
+
+func TestLambdaFunctionCache(t *testing.T) {
+	t.Run("should return not cached for unknown functions", func(t *testing.T) {
+		cache := newLambdaFunctionCache(time.Minute, time.Minute)
+		_, cached := cache.Get("arn:aws:lambda:us-east-1:123:function:ownstak-unknown:current")
+		assert.False(t, cached)
+	})
+
+	t.Run("should store found and not found functions", func(t *testing.T) {
+		cache := newLambdaFunctionCache(time.Minute, time.Minute)
+		cache.Set("arn:aws:lambda:us-east-1:123:function:ownstak-found:current", true)
+		cache.Set("arn:aws:lambda:us-east-1:123:function:ownstak-notfound:current", false)
+
+		found, cached := cache.Get("arn:aws:lambda:us-east-1:123:function:ownstak-found:current")
+		assert.True(t, cached)
+		assert.True(t, found)
+
+		found, cached = cache.Get("arn:aws:lambda:us-east-1:123:function:ownstak-notfound:current")
+		assert.True(t, cached)
+		assert.False(t, found)
+	})
+
+	t.Run("should use separate TTLs for found and not found functions", func(t *testing.T) {
+		cache := newLambdaFunctionCache(time.Minute, 0)
+		cache.Set("arn:aws:lambda:us-east-1:123:function:ownstak-found:current", true)
+		cache.Set("arn:aws:lambda:us-east-1:123:function:ownstak-notfound:current", false)
+
+		_, cached := cache.Get("arn:aws:lambda:us-east-1:123:function:ownstak-found:current")
+		assert.True(t, cached)
+		_, cached = cache.Get("arn:aws:lambda:us-east-1:123:function:ownstak-notfound:current")
+		assert.False(t, cached)
+	})
+
+	t.Run("should flush entries by suffix", func(t *testing.T) {
+		cache := newLambdaFunctionCache(time.Minute, time.Minute)
+		cache.Set("arn:aws:lambda:us-east-1:123:function:ownstak-app:current", false)
+		cache.Set("arn:aws:lambda:us-east-1:123:function:ownstak-app:deployment-1", false)
+
+		assert.Equal(t, 1, cache.Flush(":function:ownstak-app:current"))
+		_, cached := cache.Get("arn:aws:lambda:us-east-1:123:function:ownstak-app:current")
+		assert.False(t, cached)
+		_, cached = cache.Get("arn:aws:lambda:us-east-1:123:function:ownstak-app:deployment-1")
+		assert.True(t, cached)
+	})
+
+	t.Run("should not grow over the max entries limit", func(t *testing.T) {
+		cache := newLambdaFunctionCache(time.Minute, time.Minute)
+		for i := 0; i < maxLambdaCacheEntries+10; i++ {
+			cache.Set(fmt.Sprintf("arn:aws:lambda:us-east-1:123:function:ownstak-bot-%d:current", i), false)
+		}
+		assert.LessOrEqual(t, len(cache.entries), maxLambdaCacheEntries)
+	})
 }
 
 func setupAWSLambdaMock(t *testing.T) func() {
@@ -2203,6 +2942,16 @@ func setupAWSLambdaMock(t *testing.T) func() {
 				})
 				return resp, err
 			}
+			// The SDK sends GetCallerIdentity with the query protocol and expects XML response
+			body, _ := io.ReadAll(req.Body)
+			if strings.Contains(string(body), "Action=GetCallerIdentity") {
+				resp := httpmock.NewStringResponse(200, `<GetCallerIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+					<GetCallerIdentityResult><Arn>arn:aws:iam::123456789012:user/proxy</Arn><UserId>proxy</UserId><Account>123456789012</Account></GetCallerIdentityResult>
+					<ResponseMetadata><RequestId>1</RequestId></ResponseMetadata>
+				</GetCallerIdentityResponse>`)
+				resp.Header.Set("Content-Type", "text/xml")
+				return resp, nil
+			}
 			resp := httpmock.NewStringResponse(404, "Not Found")
 			return resp, nil
 		},
@@ -1,6 +1,7 @@
 package middlewares
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"net/http"
@@ -24,6 +25,7 @@ func NewFollowRedirectMiddleware() *FollowRedirectMiddleware {
 	client := &http.Client{
 		Transport: &http.Transport{
 			ResponseHeaderTimeout: 2 * time.Hour, // Fetch with max timeout of 2 hours for large files (default is unlimited)
+			DisableCompression:    true,          // Pass the Accept-Encoding and Content-Encoding headers through unchanged
 		},
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			if len(via) >= maxRedirects {
@@ -86,18 +88,34 @@ func (m *FollowRedirectMiddleware) OnResponse(ctx *server.RequestContext, next f
 	// Enable streaming for the response
 	ctx.Response.EnableStreaming()
 
-	// Start new request to the redirect URL
-	req, err := http.NewRequest(ctx.Request.Method, redirectURL, nil)
+	// Start new request to the redirect URL.
+	// The request body was already buffered for the lambda, so it can be sent again.
+	var body io.Reader
+	if ctx.Request.Method != http.MethodGet && ctx.Request.Method != http.MethodHead {
+		reqBody, err := ctx.Request.Body()
+		if err != nil {
+			errorMessage := fmt.Sprintf("Failed to read request body for redirect to '%s': %v", redirectURL, err)
+			ctx.Error(errorMessage, server.StatusInternalError)
+			return
+		}
+		if len(reqBody) > 0 {
+			body = bytes.NewReader(reqBody)
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx.Request.Context(), ctx.Request.Method, redirectURL, body)
 	if err != nil {
 		errorMessage := fmt.Sprintf("Failed to create request for redirect to '%s': %v", redirectURL, err)
 		ctx.Error(errorMessage, server.StatusInternalError)
 		return
 	}
 
-	// Copy request headers from the original request
+	// Copy all values of request headers from the original request,
+	// including Range, If-Range, If-None-Match and If-Modified-Since headers,
+	// so the video seeking and revalidation of the files on S3 work.
+	// The Content-Length is set by the client from the body.
 	for k, v := range ctx.Request.Headers {
-		if k != server.HeaderHost && !strings.HasPrefix(strings.ToLower(k), strings.ToLower(server.HeaderXOwnPrefix)) {
-			req.Header.Set(k, v[0])
+		if k != server.HeaderHost && k != server.HeaderContentLength && !strings.HasPrefix(strings.ToLower(k), strings.ToLower(server.HeaderXOwnPrefix)) {
+			req.Header[k] = append([]string(nil), v...)
 		}
 	}
 
@@ -131,8 +149,16 @@ func (m *FollowRedirectMiddleware) OnResponse(ctx *server.RequestContext, next f
 	}
 	for k, v := range resp.Header {
 		// Don't override x-own-* headers when following redirect to another ownstak site
-		if !strings.HasPrefix(strings.ToLower(k), strings.ToLower(server.HeaderXOwnPrefix)) {
-			ctx.Response.Headers.Set(k, v[0])
+		if strings.HasPrefix(strings.ToLower(k), strings.ToLower(server.HeaderXOwnPrefix)) {
+			continue
+		}
+		// Keep all values of multi-value headers. The cookies are appended to the ones from lambda response,
+		// other headers from the redirect response override the conflicting ones.
+		if k != server.HeaderSetCookie {
+			ctx.Response.Headers.Del(k)
+		}
+		for _, value := range v {
+			ctx.Response.Headers.Add(k, value)
 		}
 	}
 
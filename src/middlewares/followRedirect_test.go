@@ -1,6 +1,7 @@
 package middlewares
 
 import (
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -588,6 +589,150 @@ func TestFollowRedirectMiddleware(t *testing.T) {
 		assert.Empty(t, ctx.Response.Headers.Get(server.HeaderXOwnFollowRedirect))
 		assert.Equal(t, ctx.Response.Headers.Get("custom-header"), "from-s3")
 	})
+
+	t.Run("should pass through range requests and return 206 to the client", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/video.mp4", nil)
+		req.Header.Set(server.HeaderRange, "bytes=10-19")
+		req.Header.Set(server.HeaderIfRange, `"video-v1"`)
+		res := httptest.NewRecorder()
+
+		serverReq, _ := server.NewRequest(req)
+		serverRes := server.NewResponse(res)
+
+		ctx := &server.RequestContext{
+			Request:  serverReq,
+			Response: serverRes,
+		}
+
+		ctx.Response.Headers.Set(server.HeaderLocation, "https://127.0.0.1/video.mp4")
+		ctx.Response.Headers.Set(server.HeaderXOwnFollowRedirect, "true")
+		ctx.Response.Headers.Set(server.HeaderXOwnMergeStatus, "true")
+
+		httpmock.RegisterResponder("GET", "https://127.0.0.1/video.mp4",
+			func(req *http.Request) (*http.Response, error) {
+				assert.Equal(t, "bytes=10-19", req.Header.Get(server.HeaderRange))
+				assert.Equal(t, `"video-v1"`, req.Header.Get(server.HeaderIfRange))
+
+				resp := httpmock.NewStringResponse(206, "0123456789")
+				resp.Header.Set("Content-Type", "video/mp4")
+				resp.Header.Set(server.HeaderContentRange, "bytes 10-19/100")
+				resp.Header.Set(server.HeaderContentLength, "10")
+				resp.Header.Set(server.HeaderAcceptRanges, "bytes")
+				resp.Header.Set(server.HeaderETag, `"video-v1"`)
+				return resp, nil
+			})
+
+		middleware.OnResponse(ctx, func() {})
+
+		assert.Equal(t, http.StatusPartialContent, res.Code)
+		assert.Equal(t, "bytes 10-19/100", res.Header().Get(server.HeaderContentRange))
+		assert.Equal(t, "10", res.Header().Get(server.HeaderContentLength))
+		assert.Equal(t, "bytes", res.Header().Get(server.HeaderAcceptRanges))
+		assert.Equal(t, "video/mp4", res.Header().Get(server.HeaderContentType))
+		assert.Equal(t, "0123456789", res.Body.String())
+	})
+
+	t.Run("should pass through conditional requests and return 304 to the client", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/image.png", nil)
+		req.Header.Set(server.HeaderIfNoneMatch, `"image-v1"`)
+		req.Header.Set(server.HeaderIfModifiedSince, "Mon, 02 Jan 2006 15:04:05 GMT")
+		res := httptest.NewRecorder()
+
+		serverReq, _ := server.NewRequest(req)
+		serverRes := server.NewResponse(res)
+
+		ctx := &server.RequestContext{
+			Request:  serverReq,
+			Response: serverRes,
+		}
+
+		ctx.Response.Headers.Set(server.HeaderLocation, "https://127.0.0.1/image.png")
+		ctx.Response.Headers.Set(server.HeaderXOwnFollowRedirect, "true")
+		ctx.Response.Headers.Set(server.HeaderXOwnMergeStatus, "true")
+
+		httpmock.RegisterResponder("GET", "https://127.0.0.1/image.png",
+			func(req *http.Request) (*http.Response, error) {
+				assert.Equal(t, `"image-v1"`, req.Header.Get(server.HeaderIfNoneMatch))
+				assert.Equal(t, "Mon, 02 Jan 2006 15:04:05 GMT", req.Header.Get(server.HeaderIfModifiedSince))
+
+				resp := httpmock.NewStringResponse(304, "")
+				resp.Header.Set(server.HeaderETag, `"image-v1"`)
+				return resp, nil
+			})
+
+		middleware.OnResponse(ctx, func() {})
+		// The server ends the response with empty body after the middlewares
+		serverRes.End()
+
+		assert.Equal(t, http.StatusNotModified, res.Code)
+		assert.Equal(t, `"image-v1"`, res.Header().Get(server.HeaderETag))
+		assert.Empty(t, res.Body.String())
+	})
+
+	t.Run("should preserve all values of multi-value headers", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/test", nil)
+		req.Header.Add("X-Custom-Header", "first")
+		req.Header.Add("X-Custom-Header", "second")
+		res := httptest.NewRecorder()
+
+		serverReq, _ := server.NewRequest(req)
+		serverRes := server.NewResponse(res)
+
+		ctx := &server.RequestContext{
+			Request:  serverReq,
+			Response: serverRes,
+		}
+
+		ctx.Response.Headers.Set(server.HeaderLocation, "https://127.0.0.1/redirect")
+		ctx.Response.Headers.Set(server.HeaderXOwnFollowRedirect, "true")
+		ctx.Response.Headers.Set(server.HeaderXOwnMergeHeaders, "true")
+		ctx.Response.Headers.Add(server.HeaderSetCookie, "session=lambda")
+
+		httpmock.RegisterResponder("GET", "https://127.0.0.1/redirect",
+			func(req *http.Request) (*http.Response, error) {
+				assert.Equal(t, []string{"first", "second"}, req.Header.Values("X-Custom-Header"))
+
+				resp := httpmock.NewStringResponse(200, "redirected response")
+				resp.Header.Add(server.HeaderSetCookie, "a=1")
+				resp.Header.Add(server.HeaderSetCookie, "b=2")
+				resp.Header.Add(server.HeaderVary, "Accept")
+				resp.Header.Add(server.HeaderVary, "Accept-Encoding")
+				return resp, nil
+			})
+
+		middleware.OnResponse(ctx, func() {})
+
+		assert.Equal(t, []string{"session=lambda", "a=1", "b=2"}, res.Header().Values(server.HeaderSetCookie))
+		assert.Equal(t, []string{"Accept", "Accept-Encoding"}, res.Header().Values(server.HeaderVary))
+	})
+
+	t.Run("should forward request body when following redirect", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/test", strings.NewReader("test body"))
+		res := httptest.NewRecorder()
+
+		serverReq, _ := server.NewRequest(req)
+		serverRes := server.NewResponse(res)
+
+		ctx := &server.RequestContext{
+			Request:  serverReq,
+			Response: serverRes,
+		}
+
+		ctx.Response.Headers.Set(server.HeaderLocation, "https://127.0.0.1/redirect-body")
+		ctx.Response.Headers.Set(server.HeaderXOwnFollowRedirect, "true")
+
+		httpmock.RegisterResponder("POST", "https://127.0.0.1/redirect-body",
+			func(req *http.Request) (*http.Response, error) {
+				body, err := io.ReadAll(req.Body)
+				assert.NoError(t, err)
+				assert.Equal(t, "test body", string(body))
+				return httpmock.NewStringResponse(200, "redirected response"), nil
+			})
+
+		middleware.OnResponse(ctx, func() {})
+
+		assert.Equal(t, http.StatusOK, res.Code)
+	})
 }
 
 func TestNormalizeRedirectURL(t *testing.T) {
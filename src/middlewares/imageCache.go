@@ -0,0 +1,249 @@
+package middlewares
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"ownstak-proxy/src/logger"
+)
+
+// imageCache stores the optimized images on the local disk,
+// so the repeated requests for the same image with the same params
+// skip fetching the source image and processing it by libvips.
+// The cache is bounded by the total size of stored images and the least recently used images are evicted first.
+// Each entry is stored as two files in the cache directory:
+// - <key>.img - the optimized image
+// - <key>.json - the metadata of the optimized image (content type, etag, source validators etc...)
+type imageCache struct {
+	mutex   sync.Mutex
+	dir     string
+	maxSize int64
+	ttl     time.Duration
+	size    int64
+	entries map[string]*list.Element
+	lru     *list.List // The most recently used entries are at the front
+}
+
+type imageCacheEntry struct {
+	Key                string    `json:"key"`
+	Size               int64     `json:"size"`
+	ContentType        string    `json:"contentType"`
+	CacheControl       string    `json:"cacheControl"`
+	ETag               string    `json:"etag"`
+	LastModified       time.Time `json:"lastModified"`
+	SourceETag         string    `json:"sourceEtag"`
+	SourceLastModified string    `json:"sourceLastModified"`
+	StoredAt           time.Time `json:"storedAt"`
+	FreshUntil         time.Time `json:"freshUntil"` // Zero if the source image has no Cache-Control max-age or Expires header
+}
+
+const (
+	imageCacheImageExt    = ".img"
+	imageCacheMetadataExt = ".json"
+)
+
+// newImageCache creates the cache in the given directory
+// and loads the entries that were stored there before the restart.
+func newImageCache(dir string, maxSize int64, ttl time.Duration) (*imageCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create image cache directory: %v", err)
+	}
+
+	c := &imageCache{
+		dir:     dir,
+		maxSize: maxSize,
+		ttl:     ttl,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+	c.load()
+	return c, nil
+}
+
+// imageCacheKey returns the cache key for the given parts
+// such as source URL and all the transform params.
+func imageCacheKey(parts ...string) string {
+	hash := sha256.Sum256([]byte(strings.Join(parts, "\n")))
+	return hex.EncodeToString(hash[:])
+}
+
+// Get returns the entry with given key and moves it to the front of the LRU list.
+func (c *imageCache) Get(key string) (imageCacheEntry, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return imageCacheEntry{}, false
+	}
+	c.lru.MoveToFront(element)
+	return *element.Value.(*imageCacheEntry), true
+}
+
+// IsFresh returns true if the entry can be served without revalidating the source image.
+// The entry is fresh for the cache TTL at most, or shorter if the source image allows it.
+func (c *imageCache) IsFresh(entry imageCacheEntry) bool {
+	if !entry.FreshUntil.IsZero() && !time.Now().Before(entry.FreshUntil) {
+		return false
+	}
+	return time.Since(entry.StoredAt) < c.ttl
+}
+
+// Open opens the optimized image of the entry for reading.
+func (c *imageCache) Open(entry imageCacheEntry) (*os.File, error) {
+	return os.Open(c.path(entry.Key, imageCacheImageExt))
+}
+
+// Set stores the optimized image data in the cache
+// and evicts the least recently used entries if the cache exceeds its max size.
+func (c *imageCache) Set(entry imageCacheEntry, data []byte) error {
+	size := int64(len(data))
+	if size > c.maxSize {
+		return fmt.Errorf("image size %d exceeds the cache size %d", size, c.maxSize)
+	}
+	entry.Size = size
+	entry.StoredAt = time.Now()
+
+	metadata, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	// Write the files to tmp paths first and rename them after,
+	// so other requests never read partially written image.
+	tmpSuffix := fmt.Sprintf(".tmp-%d", time.Now().UnixNano())
+	if err := os.WriteFile(c.path(entry.Key, imageCacheImageExt+tmpSuffix), data, 0644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(c.path(entry.Key, imageCacheMetadataExt+tmpSuffix), metadata, 0644); err != nil {
+		os.Remove(c.path(entry.Key, imageCacheImageExt+tmpSuffix))
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	os.Rename(c.path(entry.Key, imageCacheImageExt+tmpSuffix), c.path(entry.Key, imageCacheImageExt))
+	os.Rename(c.path(entry.Key, imageCacheMetadataExt+tmpSuffix), c.path(entry.Key, imageCacheMetadataExt))
+	c.add(&entry)
+	return nil
+}
+
+// Touch marks the entry as fresh again after the source image was revalidated.
+// The freshUntil is the new freshness of the source image, see imageSourceFreshUntil.
+func (c *imageCache) Touch(key string, freshUntil time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return
+	}
+	entry := element.Value.(*imageCacheEntry)
+	entry.StoredAt = time.Now()
+	entry.FreshUntil = freshUntil
+	if metadata, err := json.Marshal(entry); err == nil {
+		os.WriteFile(c.path(entry.Key, imageCacheMetadataExt), metadata, 0644)
+	}
+}
+
+// Delete removes the entry with given key from the cache.
+func (c *imageCache) Delete(key string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+}
+
+// Size returns the total size of stored images in bytes.
+func (c *imageCache) Size() int64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.size
+}
+
+// add inserts or replaces the entry and evicts the least recently used entries
+// until the cache fits into its max size. The mutex needs to be locked.
+func (c *imageCache) add(entry *imageCacheEntry) {
+	if element, ok := c.entries[entry.Key]; ok {
+		c.size -= element.Value.(*imageCacheEntry).Size
+		element.Value = entry
+		c.lru.MoveToFront(element)
+	} else {
+		c.entries[entry.Key] = c.lru.PushFront(entry)
+	}
+	c.size += entry.Size
+
+	for c.size > c.maxSize && c.lru.Len() > 0 {
+		c.remove(c.lru.Back())
+	}
+}
+
+// remove deletes the entry and its files. The mutex needs to be locked.
+func (c *imageCache) remove(element *list.Element) {
+	entry := element.Value.(*imageCacheEntry)
+	c.lru.Remove(element)
+	delete(c.entries, entry.Key)
+	c.size -= entry.Size
+	os.Remove(c.path(entry.Key, imageCacheImageExt))
+	os.Remove(c.path(entry.Key, imageCacheMetadataExt))
+}
+
+// load restores the entries from the cache directory.
+// The entries are ordered by their last modification time, which is the best guess of their last usage.
+func (c *imageCache) load() {
+	metadataPaths, err := filepath.Glob(filepath.Join(c.dir, "*"+imageCacheMetadataExt))
+	if err != nil {
+		return
+	}
+
+	entries := make([]*imageCacheEntry, 0, len(metadataPaths))
+	for _, metadataPath := range metadataPaths {
+		entry := &imageCacheEntry{}
+		metadata, err := os.ReadFile(metadataPath)
+		if err == nil {
+			err = json.Unmarshal(metadata, entry)
+		}
+		if err != nil || entry.Key == "" {
+			// Remove broken metadata and its image
+			os.Remove(metadataPath)
+			os.Remove(strings.TrimSuffix(metadataPath, imageCacheMetadataExt) + imageCacheImageExt)
+			continue
+		}
+		if stat, err := os.Stat(c.path(entry.Key, imageCacheImageExt)); err != nil || stat.Size() != entry.Size {
+			os.Remove(metadataPath)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	// Add the oldest entries first, so the recently used ones end up at the front
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].StoredAt.Before(entries[j].StoredAt)
+	})
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, entry := range entries {
+		c.add(entry)
+	}
+
+	if len(entries) > 0 {
+		logger.Info("Image Optimizer cache loaded %d images (%d bytes) from %s", c.lru.Len(), c.size, c.dir)
+	}
+}
+
+func (c *imageCache) path(key string, ext string) string {
+	return filepath.Join(c.dir, key+ext)
+}
@@ -0,0 +1,141 @@
+package middlewares
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImageCache(t *testing.T) {
+	newImage := func(size int) []byte {
+		return make([]byte, size)
+	}
+
+	t.Run("should store and read images", func(t *testing.T) {
+		cache, err := newImageCache(t.TempDir(), 1024, time.Hour)
+		require.NoError(t, err)
+
+		key := imageCacheKey("https://example.com/image.jpg", "webp", "60")
+		require.NoError(t, cache.Set(imageCacheEntry{Key: key, ContentType: "image/webp", ETag: `"abc"`}, newImage(100)))
+
+		entry, ok := cache.Get(key)
+		require.True(t, ok)
+		assert.Equal(t, "image/webp", entry.ContentType)
+		assert.Equal(t, `"abc"`, entry.ETag)
+		assert.Equal(t, int64(100), entry.Size)
+		assert.Equal(t, int64(100), cache.Size())
+		assert.True(t, cache.IsFresh(entry))
+
+		file, err := cache.Open(entry)
+		require.NoError(t, err)
+		defer file.Close()
+		data, err := io.ReadAll(file)
+		require.NoError(t, err)
+		assert.Len(t, data, 100)
+	})
+
+	t.Run("should return different keys for different params", func(t *testing.T) {
+		assert.Equal(t, imageCacheKey("/image.jpg", "webp"), imageCacheKey("/image.jpg", "webp"))
+		assert.NotEqual(t, imageCacheKey("/image.jpg", "webp"), imageCacheKey("/image.jpg", "avif"))
+	})
+
+	t.Run("should evict least recently used images", func(t *testing.T) {
+		cache, err := newImageCache(t.TempDir(), 250, time.Hour)
+		require.NoError(t, err)
+
+		require.NoError(t, cache.Set(imageCacheEntry{Key: "first"}, newImage(100)))
+		require.NoError(t, cache.Set(imageCacheEntry{Key: "second"}, newImage(100)))
+
+		// Use the first image, so the second one is evicted
+		_, ok := cache.Get("first")
+		require.True(t, ok)
+		require.NoError(t, cache.Set(imageCacheEntry{Key: "third"}, newImage(100)))
+
+		_, ok = cache.Get("first")
+		assert.True(t, ok)
+		_, ok = cache.Get("second")
+		assert.False(t, ok)
+		_, ok = cache.Get("third")
+		assert.True(t, ok)
+		assert.Equal(t, int64(200), cache.Size())
+		assert.NoFileExists(t, cache.path("second", imageCacheImageExt))
+	})
+
+	t.Run("should not store images larger than the cache", func(t *testing.T) {
+		cache, err := newImageCache(t.TempDir(), 50, time.Hour)
+		require.NoError(t, err)
+
+		assert.Error(t, cache.Set(imageCacheEntry{Key: "large"}, newImage(100)))
+		_, ok := cache.Get("large")
+		assert.False(t, ok)
+	})
+
+	t.Run("should load stored images after restart", func(t *testing.T) {
+		dir := t.TempDir()
+		cache, err := newImageCache(dir, 1024, time.Hour)
+		require.NoError(t, err)
+		require.NoError(t, cache.Set(imageCacheEntry{Key: "persisted", ETag: `"abc"`}, newImage(100)))
+
+		// Broken metadata should be removed
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "broken"+imageCacheMetadataExt), []byte("{"), 0644))
+
+		restarted, err := newImageCache(dir, 1024, time.Hour)
+		require.NoError(t, err)
+
+		entry, ok := restarted.Get("persisted")
+		require.True(t, ok)
+		assert.Equal(t, `"abc"`, entry.ETag)
+		assert.Equal(t, int64(100), restarted.Size())
+		assert.NoFileExists(t, filepath.Join(dir, "broken"+imageCacheMetadataExt))
+	})
+
+	t.Run("should expire and touch entries", func(t *testing.T) {
+		cache, err := newImageCache(t.TempDir(), 1024, time.Hour)
+		require.NoError(t, err)
+		require.NoError(t, cache.Set(imageCacheEntry{Key: "stale"}, newImage(10)))
+
+		// Make the entry stale
+		cache.entries["stale"].Value.(*imageCacheEntry).StoredAt = time.Now().Add(-2 * time.Hour)
+		entry, _ := cache.Get("stale")
+		assert.False(t, cache.IsFresh(entry))
+
+		cache.Touch("stale", time.Time{})
+		entry, _ = cache.Get("stale")
+		assert.True(t, cache.IsFresh(entry))
+	})
+
+	t.Run("should expire entries by the source image freshness", func(t *testing.T) {
+		cache, err := newImageCache(t.TempDir(), 1024, time.Hour)
+		require.NoError(t, err)
+		require.NoError(t, cache.Set(imageCacheEntry{Key: "short", FreshUntil: time.Now().Add(-time.Second)}, newImage(10)))
+		require.NoError(t, cache.Set(imageCacheEntry{Key: "long", FreshUntil: time.Now().Add(2 * time.Hour)}, newImage(10)))
+
+		entry, _ := cache.Get("short")
+		assert.False(t, cache.IsFresh(entry))
+
+		// The TTL still applies to the sources with longer freshness
+		cache.entries["long"].Value.(*imageCacheEntry).StoredAt = time.Now().Add(-90 * time.Minute)
+		entry, _ = cache.Get("long")
+		assert.False(t, cache.IsFresh(entry))
+
+		cache.Touch("short", time.Now().Add(time.Minute))
+		entry, _ = cache.Get("short")
+		assert.True(t, cache.IsFresh(entry))
+	})
+
+	t.Run("should delete entries", func(t *testing.T) {
+		cache, err := newImageCache(t.TempDir(), 1024, time.Hour)
+		require.NoError(t, err)
+		require.NoError(t, cache.Set(imageCacheEntry{Key: "deleted"}, newImage(10)))
+
+		cache.Delete("deleted")
+		_, ok := cache.Get("deleted")
+		assert.False(t, ok)
+		assert.Equal(t, int64(0), cache.Size())
+	})
+}
@@ -0,0 +1,144 @@
+package middlewares
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"ownstak-proxy/src/server"
+)
+
+// imageFetchPolicyError is returned by the fetch client when the fetch policy
+// doesn't allow the redirect or the resolved IP of the remote image.
+type imageFetchPolicyError struct {
+	message string
+}
+
+func (e *imageFetchPolicyError) Error() string {
+	return e.message
+}
+
+func newImageFetchPolicyError(format string, args ...any) error {
+	return &imageFetchPolicyError{message: fmt.Sprintf(format, args...)}
+}
+
+// imageFetchErrorStatus returns the status code for the error returned by the fetch client.
+// The requests blocked by the fetch policy are the client's fault, the timeouts are returned as 504
+// and all other network errors as 502.
+func imageFetchErrorStatus(err error) int {
+	var policyErr *imageFetchPolicyError
+	if errors.As(err, &policyErr) {
+		return http.StatusBadRequest
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusBadGateway
+}
+
+// imageUpstreamStatus returns the status code for the non-200 response of the source image.
+// The missing images are returned as-is, so the CDN can cache them as missing,
+// the server errors are returned as 502 and all other statuses as 400.
+func imageUpstreamStatus(statusCode int) int {
+	switch {
+	case statusCode == http.StatusNotFound || statusCode == http.StatusGone:
+		return statusCode
+	case statusCode >= 500:
+		return http.StatusBadGateway
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// imageETag returns the ETag of the optimized image.
+// It's derived from the cache key with all the params and the source image ETag,
+// so it's the same across restarts and proxy instances.
+// The source ETag is embedded in the ETag, so it can be forwarded to the origin
+// when the client revalidates the optimized image. If the source image has no ETag,
+// the hash of its content is used instead and nothing is embedded.
+// e.g: "3f2a...9c1d-Vy8iYWJjIg" for the source ETag W/"abc"
+func imageETag(cacheKey, srcETag string, srcData []byte) string {
+	if srcETag == "" {
+		srcHash := sha256.Sum256(srcData)
+		return `"` + imageCacheKey(cacheKey, hex.EncodeToString(srcHash[:]))[:32] + `"`
+	}
+	return `"` + imageCacheKey(cacheKey, srcETag)[:32] + "-" + base64.RawURLEncoding.EncodeToString([]byte(srcETag)) + `"`
+}
+
+// imageSourceETag returns the source image ETag embedded in the optimized image ETag
+// from the If-None-Match header. Only the ETags issued for the same cache key are accepted,
+// so the client can't send arbitrary validators to the origin.
+// Returns empty string if there's no such ETag.
+func imageSourceETag(ifNoneMatch, cacheKey string) string {
+	for _, etag := range strings.Split(ifNoneMatch, ",") {
+		etag = strings.Trim(strings.TrimPrefix(strings.TrimSpace(etag), "W/"), `"`)
+		hash, encoded, found := strings.Cut(etag, "-")
+		if !found {
+			continue
+		}
+		srcETag, err := base64.RawURLEncoding.DecodeString(encoded)
+		if err != nil || len(srcETag) == 0 {
+			continue
+		}
+		if hash == imageCacheKey(cacheKey, string(srcETag))[:32] {
+			return string(srcETag)
+		}
+	}
+	return ""
+}
+
+// imageSourceFreshUntil returns the time until the source image can be served from the cache
+// without revalidation according to its Cache-Control and Expires headers.
+// The s-maxage directive takes precedence over max-age, because the proxy is a shared cache.
+// Returns zero time if the source image has none of them, so just the cache TTL applies.
+// e.g: "public, max-age=60" => now + 60s, "no-cache" => now
+func imageSourceFreshUntil(header http.Header) time.Time {
+	now := time.Now()
+	maxAge, sharedMaxAge := -1, -1
+	for _, directive := range strings.Split(header.Get(server.HeaderCacheControl), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		seconds, err := strconv.Atoi(strings.Trim(value, `"`))
+		switch strings.ToLower(name) {
+		case "no-cache", "no-store":
+			return now
+		case "max-age":
+			if err == nil {
+				maxAge = max(seconds, 0)
+			}
+		case "s-maxage":
+			if err == nil {
+				sharedMaxAge = max(seconds, 0)
+			}
+		}
+	}
+	if sharedMaxAge >= 0 {
+		return now.Add(time.Duration(sharedMaxAge) * time.Second)
+	}
+	if maxAge >= 0 {
+		return now.Add(time.Duration(maxAge) * time.Second)
+	}
+
+	expires := header.Get(server.HeaderExpires)
+	if expires == "" {
+		return time.Time{}
+	}
+	// The invalid Expires header such as "0" means the response is already expired
+	expiresAt, err := http.ParseTime(expires)
+	if err != nil {
+		return now
+	}
+	// Use the origin's clock if possible, so the clock skew doesn't matter
+	if date, err := http.ParseTime(header.Get(server.HeaderDate)); err == nil {
+		return now.Add(expiresAt.Sub(date))
+	}
+	return expiresAt
+}
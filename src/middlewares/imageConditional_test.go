@@ -0,0 +1,109 @@
+package middlewares
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImageFetchErrorStatus(t *testing.T) {
+	t.Run("should return 400 for errors of the fetch policy", func(t *testing.T) {
+		err := &url.Error{Op: "Get", URL: "https://example.com", Err: newImageFetchPolicyError("redirect to %s is not allowed", "https://internal")}
+		assert.Equal(t, http.StatusBadRequest, imageFetchErrorStatus(err))
+	})
+
+	t.Run("should return 504 for timeouts", func(t *testing.T) {
+		err := &url.Error{Op: "Get", URL: "https://example.com", Err: context.DeadlineExceeded}
+		assert.Equal(t, http.StatusGatewayTimeout, imageFetchErrorStatus(err))
+	})
+
+	t.Run("should return 502 for other errors", func(t *testing.T) {
+		err := &url.Error{Op: "Get", URL: "https://example.com", Err: errors.New("connection refused")}
+		assert.Equal(t, http.StatusBadGateway, imageFetchErrorStatus(err))
+	})
+}
+
+func TestImageUpstreamStatus(t *testing.T) {
+	assert.Equal(t, http.StatusNotFound, imageUpstreamStatus(http.StatusNotFound))
+	assert.Equal(t, http.StatusGone, imageUpstreamStatus(http.StatusGone))
+	assert.Equal(t, http.StatusBadGateway, imageUpstreamStatus(http.StatusInternalServerError))
+	assert.Equal(t, http.StatusBadGateway, imageUpstreamStatus(http.StatusServiceUnavailable))
+	assert.Equal(t, http.StatusBadRequest, imageUpstreamStatus(http.StatusForbidden))
+}
+
+func TestImageETag(t *testing.T) {
+	t.Run("should be deterministic", func(t *testing.T) {
+		assert.Equal(t, imageETag("key", `"v1"`, nil), imageETag("key", `"v1"`, nil))
+		assert.NotEqual(t, imageETag("key", `"v1"`, nil), imageETag("key", `"v2"`, nil))
+		assert.NotEqual(t, imageETag("key", `"v1"`, nil), imageETag("other", `"v1"`, nil))
+	})
+
+	t.Run("should use content hash without source ETag", func(t *testing.T) {
+		etag := imageETag("key", "", []byte("image"))
+		assert.Len(t, etag, 34)
+		assert.NotEqual(t, etag, imageETag("key", "", []byte("other image")))
+		assert.Equal(t, "", imageSourceETag(etag, "key"))
+	})
+
+	t.Run("should return embedded source ETag", func(t *testing.T) {
+		etag := imageETag("key", `W/"abc"`, nil)
+		assert.Equal(t, `W/"abc"`, imageSourceETag(etag, "key"))
+		assert.Equal(t, `W/"abc"`, imageSourceETag(`"other", W/`+etag, "key"))
+	})
+
+	t.Run("should ignore ETags issued for other cache key", func(t *testing.T) {
+		assert.Equal(t, "", imageSourceETag(imageETag("other", `"v1"`, nil), "key"))
+		assert.Equal(t, "", imageSourceETag(`"0123456789abcdef0123456789abcdef-InYxIg"`, "key"))
+		assert.Equal(t, "", imageSourceETag("*", "key"))
+	})
+}
+
+func TestImageSourceFreshUntil(t *testing.T) {
+	freshFor := func(headers map[string]string) time.Duration {
+		header := http.Header{}
+		for key, value := range headers {
+			header.Set(key, value)
+		}
+		freshUntil := imageSourceFreshUntil(header)
+		if freshUntil.IsZero() {
+			return -1
+		}
+		return time.Until(freshUntil).Round(time.Second)
+	}
+
+	t.Run("should return zero time without freshness headers", func(t *testing.T) {
+		assert.Equal(t, time.Duration(-1), freshFor(nil))
+		assert.Equal(t, time.Duration(-1), freshFor(map[string]string{"Cache-Control": "public"}))
+	})
+
+	t.Run("should use max-age", func(t *testing.T) {
+		assert.Equal(t, 60*time.Second, freshFor(map[string]string{"Cache-Control": "public, max-age=60"}))
+		assert.Equal(t, time.Duration(0), freshFor(map[string]string{"Cache-Control": "max-age=0"}))
+	})
+
+	t.Run("should prefer s-maxage over max-age", func(t *testing.T) {
+		assert.Equal(t, 300*time.Second, freshFor(map[string]string{"Cache-Control": "public, max-age=60, s-maxage=300"}))
+	})
+
+	t.Run("should not be fresh with no-cache or no-store", func(t *testing.T) {
+		assert.Equal(t, time.Duration(0), freshFor(map[string]string{"Cache-Control": "no-cache, max-age=60"}))
+		assert.Equal(t, time.Duration(0), freshFor(map[string]string{"Cache-Control": "No-Store"}))
+	})
+
+	t.Run("should use Expires relative to Date", func(t *testing.T) {
+		assert.Equal(t, 120*time.Second, freshFor(map[string]string{
+			"Date":    "Mon, 02 Jan 2006 15:04:05 GMT",
+			"Expires": "Mon, 02 Jan 2006 15:06:05 GMT",
+		}))
+		assert.Equal(t, time.Duration(0), freshFor(map[string]string{"Expires": "0"}))
+	})
+
+	t.Run("should prefer max-age over Expires", func(t *testing.T) {
+		assert.Equal(t, 60*time.Second, freshFor(map[string]string{"Cache-Control": "max-age=60", "Expires": "0"}))
+	})
+}
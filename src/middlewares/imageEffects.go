@@ -0,0 +1,300 @@
+package middlewares
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"ownstak-proxy/src/vips"
+)
+
+// Limits of the effect params, so a single request can't burn too much CPU time.
+const (
+	maxBlurSigma  = 100
+	maxBrightness = 5
+)
+
+// Supported rotate angles (clockwise) and their libvips values
+var rotateAngles = map[int]int{
+	0:   vips.VIPS_ANGLE_D0,
+	90:  vips.VIPS_ANGLE_D90,
+	180: vips.VIPS_ANGLE_D180,
+	270: vips.VIPS_ANGLE_D270,
+}
+
+// imageEffects are the optional effects applied to the image.
+// They're always applied in the same order regardless of the order of query params:
+// 1. Transforms before resizing: rotate, flip, flop
+// 2. Filters after resizing: blur, sharpen, grayscale, tint, brightness
+// The transforms go first, so the width and height params describe the final image,
+// and the filters go last, so they're applied to smaller image and their strength doesn't depend on the source image size.
+type imageEffects struct {
+	rotate     int       // Clockwise angle, one of 0, 90, 180, 270
+	flip       bool      // Mirror vertically (top to bottom)
+	flop       bool      // Mirror horizontally (left to right)
+	blur       float64   // Sigma of the gaussian blur, 0 = disabled
+	sharpen    bool      // Sharpen with the default libvips settings
+	grayscale  bool      // Convert to black and white
+	tint       *[3]uint8 // Colorize the grayscale image with the RGB color
+	brightness float64   // Multiplier of the pixel values, 1 = unchanged
+}
+
+// imageOperation is single libvips operation of the effects pipeline.
+type imageOperation struct {
+	name  string
+	apply func(img *vips.VipsImage) (*vips.VipsImage, error)
+}
+
+// parseImageEffects reads and validates the effect params from the query.
+func parseImageEffects(query map[string][]string) (imageEffects, error) {
+	effects := imageEffects{brightness: 1}
+
+	if rotate := GetQueryParam(query, "rotate", "", ""); rotate != "" {
+		angle, err := strconv.Atoi(rotate)
+		if err != nil {
+			return effects, fmt.Errorf("Rotate must be one of: 0, 90, 180, 270")
+		}
+		// Normalize negative and full turns, e.g. -90 => 270, 450 => 90
+		angle = ((angle % 360) + 360) % 360
+		if _, ok := rotateAngles[angle]; !ok {
+			return effects, fmt.Errorf("Rotate must be one of: 0, 90, 180, 270")
+		}
+		effects.rotate = angle
+	}
+
+	var err error
+	if effects.flip, err = parseBoolParam(query, "flip", ""); err != nil {
+		return effects, err
+	}
+	if effects.flop, err = parseBoolParam(query, "flop", ""); err != nil {
+		return effects, err
+	}
+	if effects.sharpen, err = parseBoolParam(query, "sharpen", ""); err != nil {
+		return effects, err
+	}
+	if effects.grayscale, err = parseBoolParam(query, "grayscale", "greyscale"); err != nil {
+		return effects, err
+	}
+
+	if blur := GetQueryParam(query, "blur", "", ""); blur != "" {
+		sigma, err := strconv.ParseFloat(blur, 64)
+		if err != nil || sigma < 0 || sigma > maxBlurSigma {
+			return effects, fmt.Errorf("Blur must be a number between 0 and %d", maxBlurSigma)
+		}
+		effects.blur = sigma
+	}
+
+	if tint := GetQueryParam(query, "tint", "", ""); tint != "" {
+		color, err := parseHexColor(tint)
+		if err != nil {
+			return effects, fmt.Errorf("Tint must be a hex color, e.g. ff0000 or f00")
+		}
+		effects.tint = &color
+	}
+
+	if brightness := GetQueryParam(query, "brightness", "", ""); brightness != "" {
+		multiplier, err := strconv.ParseFloat(brightness, 64)
+		if err != nil || multiplier < 0 || multiplier > maxBrightness {
+			return effects, fmt.Errorf("Brightness must be a number between 0 and %d", maxBrightness)
+		}
+		effects.brightness = multiplier
+	}
+
+	return effects, nil
+}
+
+// transforms returns the operations that change the geometry of the image
+// and need to be applied before resizing.
+func (e imageEffects) transforms() []imageOperation {
+	operations := []imageOperation{}
+	if e.rotate != 0 {
+		operations = append(operations, imageOperation{
+			name: fmt.Sprintf("rotate:%d", e.rotate),
+			apply: func(img *vips.VipsImage) (*vips.VipsImage, error) {
+				return vips.RotateImage(img, rotateAngles[e.rotate])
+			},
+		})
+	}
+	if e.flip {
+		operations = append(operations, imageOperation{
+			name: "flip",
+			apply: func(img *vips.VipsImage) (*vips.VipsImage, error) {
+				return vips.FlipImage(img, vips.VIPS_DIRECTION_VERTICAL)
+			},
+		})
+	}
+	if e.flop {
+		operations = append(operations, imageOperation{
+			name: "flop",
+			apply: func(img *vips.VipsImage) (*vips.VipsImage, error) {
+				return vips.FlipImage(img, vips.VIPS_DIRECTION_HORIZONTAL)
+			},
+		})
+	}
+	return operations
+}
+
+// filters returns the operations that change the pixels of the image
+// and are applied after resizing.
+func (e imageEffects) filters() []imageOperation {
+	operations := []imageOperation{}
+	if e.blur > 0 {
+		operations = append(operations, imageOperation{
+			name: "blur:" + strconv.FormatFloat(e.blur, 'f', -1, 64),
+			apply: func(img *vips.VipsImage) (*vips.VipsImage, error) {
+				return vips.BlurImage(img, e.blur)
+			},
+		})
+	}
+	if e.sharpen {
+		operations = append(operations, imageOperation{name: "sharpen", apply: vips.SharpenImage})
+	}
+	// The tint converts the image to grayscale too
+	if e.grayscale || e.tint != nil {
+		operations = append(operations, imageOperation{
+			name: "grayscale",
+			apply: func(img *vips.VipsImage) (*vips.VipsImage, error) {
+				return vips.ColourspaceImage(img, vips.VIPS_INTERPRETATION_B_W)
+			},
+		})
+	}
+	if e.tint != nil {
+		tint := *e.tint
+		operations = append(operations,
+			imageOperation{
+				name: "srgb",
+				apply: func(img *vips.VipsImage) (*vips.VipsImage, error) {
+					return vips.ColourspaceImage(img, vips.VIPS_INTERPRETATION_SRGB)
+				},
+			},
+			imageOperation{
+				name: fmt.Sprintf("tint:%02x%02x%02x", tint[0], tint[1], tint[2]),
+				apply: func(img *vips.VipsImage) (*vips.VipsImage, error) {
+					return linearImage(img, []float64{float64(tint[0]) / 255, float64(tint[1]) / 255, float64(tint[2]) / 255})
+				},
+			},
+		)
+	}
+	if e.brightness != 1 {
+		operations = append(operations, imageOperation{
+			name: "brightness:" + strconv.FormatFloat(e.brightness, 'f', -1, 64),
+			apply: func(img *vips.VipsImage) (*vips.VipsImage, error) {
+				return linearImage(img, []float64{e.brightness, e.brightness, e.brightness})
+			},
+		})
+	}
+	return operations
+}
+
+// String returns the names of all operations in the order they're applied.
+// It's used in the cache key and debug header.
+// e.g: rotate:90,flip,blur:5,grayscale
+func (e imageEffects) String() string {
+	names := []string{}
+	for _, operation := range append(e.transforms(), e.filters()...) {
+		names = append(names, operation.name)
+	}
+	return strings.Join(names, ",")
+}
+
+// applyImageOperations applies the operations one by one and frees the intermediate images right away.
+// It returns the input image unchanged if there are no operations,
+// otherwise the returned image needs to be freed by the caller.
+func applyImageOperations(img *vips.VipsImage, operations []imageOperation) (*vips.VipsImage, error) {
+	current := img
+	for _, operation := range operations {
+		out, err := operation.apply(current)
+		// The output image holds its own reference to the input image,
+		// so we can release our reference to the intermediate image.
+		if current != img {
+			current.Free()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", operation.name, err)
+		}
+		current = out
+	}
+	return current, nil
+}
+
+// applyImageFrameOperations applies the operations to each frame of animated image
+// and joins the processed frames back into single animated image.
+// The images with single frame are processed as a whole.
+func applyImageFrameOperations(img *vips.VipsImage, pages int, operations []imageOperation) (*vips.VipsImage, error) {
+	if pages <= 1 || len(operations) == 0 {
+		return applyImageOperations(img, operations)
+	}
+
+	frames := make([]*vips.VipsImage, 0, pages)
+	// The joined image holds its own references to the frames
+	defer func() {
+		for _, frame := range frames {
+			frame.Free()
+		}
+	}()
+
+	for i := 0; i < pages; i++ {
+		frame, err := vips.GetImageFrame(img, i)
+		if err != nil {
+			return nil, fmt.Errorf("frame %d: %v", i, err)
+		}
+		out, err := applyImageOperations(frame, operations)
+		if out != frame {
+			frame.Free()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("frame %d: %v", i, err)
+		}
+		frames = append(frames, out)
+	}
+
+	return vips.JoinImageFrames(frames)
+}
+
+// linearImage multiplies the color bands of the image by the given values
+// and keeps the alpha channel unchanged. The single color value is used for grayscale images.
+func linearImage(img *vips.VipsImage, colors []float64) (*vips.VipsImage, error) {
+	bands := vips.GetImageBands(img)
+	colorBands := bands
+	if vips.ImageHasAlpha(img) {
+		colorBands--
+	}
+
+	a := make([]float64, bands)
+	b := make([]float64, bands)
+	for i := range a {
+		a[i] = 1
+		if i < colorBands {
+			a[i] = colors[min(i, len(colors)-1)]
+		}
+	}
+	return vips.LinearImage(img, a, b)
+}
+
+// parseBoolParam returns true if the query param is set to true or 1.
+func parseBoolParam(query map[string][]string, param1, param2 string) (bool, error) {
+	value := GetQueryParam(query, param1, param2, "false")
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("%s must be true or false", strings.ToUpper(param1[:1])+param1[1:])
+	}
+	return enabled, nil
+}
+
+// parseHexColor parses the color in RRGGBB or RGB format with optional # prefix.
+// e.g: parseHexColor("#ff8000") => [255, 128, 0]
+func parseHexColor(color string) ([3]uint8, error) {
+	color = strings.TrimPrefix(color, "#")
+	if len(color) == 3 {
+		color = string([]byte{color[0], color[0], color[1], color[1], color[2], color[2]})
+	}
+	if len(color) != 6 {
+		return [3]uint8{}, fmt.Errorf("invalid color length")
+	}
+
+	value, err := strconv.ParseUint(color, 16, 32)
+	if err != nil {
+		return [3]uint8{}, err
+	}
+	return [3]uint8{uint8(value >> 16), uint8(value >> 8), uint8(value)}, nil
+}
@@ -0,0 +1,70 @@
+package middlewares
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseImageEffects(t *testing.T) {
+	t.Run("should return no effects by default", func(t *testing.T) {
+		effects, err := parseImageEffects(map[string][]string{})
+		require.NoError(t, err)
+		assert.Equal(t, "", effects.String())
+		assert.Empty(t, effects.transforms())
+		assert.Empty(t, effects.filters())
+	})
+
+	t.Run("should apply effects in defined order", func(t *testing.T) {
+		effects, err := parseImageEffects(map[string][]string{
+			"brightness": {"1.2"},
+			"tint":       {"#ff8000"},
+			"blur":       {"2.5"},
+			"flop":       {"true"},
+			"rotate":     {"-90"},
+			"sharpen":    {"1"},
+			"flip":       {"true"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "rotate:270,flip,flop,blur:2.5,sharpen,grayscale,srgb,tint:ff8000,brightness:1.2", effects.String())
+		assert.Len(t, effects.transforms(), 3)
+		assert.Len(t, effects.filters(), 6)
+	})
+
+	t.Run("should support greyscale alias", func(t *testing.T) {
+		effects, err := parseImageEffects(map[string][]string{"greyscale": {"true"}})
+		require.NoError(t, err)
+		assert.Equal(t, "grayscale", effects.String())
+	})
+
+	t.Run("should reject invalid values", func(t *testing.T) {
+		invalid := []map[string][]string{
+			{"rotate": {"45"}},
+			{"rotate": {"abc"}},
+			{"flip": {"yes"}},
+			{"blur": {"1000"}},
+			{"blur": {"-1"}},
+			{"tint": {"red"}},
+			{"tint": {"ff00"}},
+			{"brightness": {"10"}},
+		}
+		for _, query := range invalid {
+			_, err := parseImageEffects(query)
+			assert.Error(t, err, query)
+		}
+	})
+}
+
+func TestParseHexColor(t *testing.T) {
+	color, err := parseHexColor("#ff8000")
+	require.NoError(t, err)
+	assert.Equal(t, [3]uint8{255, 128, 0}, color)
+
+	color, err = parseHexColor("0f0")
+	require.NoError(t, err)
+	assert.Equal(t, [3]uint8{0, 255, 0}, color)
+
+	_, err = parseHexColor("zzzzzz")
+	assert.Error(t, err)
+}
@@ -0,0 +1,105 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"ownstak-proxy/src/vips"
+)
+
+// The EXIF fields returned by the /__ownstak__/image/info endpoint and their libvips names.
+// The other EXIF fields such as GPS position are not returned, so the endpoint doesn't leak more than needed.
+var imageInfoExifFields = map[string]string{
+	"make":             "exif-ifd0-Make",
+	"model":            "exif-ifd0-Model",
+	"software":         "exif-ifd0-Software",
+	"dateTime":         "exif-ifd0-DateTime",
+	"dateTimeOriginal": "exif-ifd2-DateTimeOriginal",
+	"artist":           "exif-ifd0-Artist",
+	"copyright":        "exif-ifd0-Copyright",
+	"exposureTime":     "exif-ifd2-ExposureTime",
+	"fNumber":          "exif-ifd2-FNumber",
+	"iso":              "exif-ifd2-ISOSpeedRatings",
+	"focalLength":      "exif-ifd2-FocalLength",
+}
+
+type ImageInfoResponse struct {
+	URL           string            `json:"url"`
+	Format        string            `json:"format"`
+	ContentType   string            `json:"contentType"`
+	Width         int               `json:"width"`
+	Height        int               `json:"height"`
+	HasAlpha      bool              `json:"hasAlpha"`
+	Orientation   int               `json:"orientation"`
+	Colorspace    string            `json:"colorspace"`
+	HasIccProfile bool              `json:"hasIccProfile"`
+	Size          int64             `json:"size"`
+	Pages         int               `json:"pages"`
+	Exif          map[string]string `json:"exif,omitempty"`
+}
+
+// buildImageInfo returns the info JSON for the loaded source image without any processing.
+// The width and height are the displayed dimensions of single frame after applying the EXIF orientation.
+func buildImageInfo(img *vips.VipsImage, imageURL, contentType string, data []byte) ([]byte, error) {
+	info := ImageInfoResponse{
+		URL:           imageURL,
+		Format:        detectImageFormat(data, contentType),
+		ContentType:   contentType,
+		Width:         vips.GetImageWidth(img),
+		Height:        vips.GetImagePageHeight(img),
+		HasAlpha:      vips.ImageHasAlpha(img),
+		Orientation:   vips.GetImageOrientation(img),
+		Colorspace:    vips.GetImageColourspace(img),
+		HasIccProfile: vips.ImageHasIccProfile(img),
+		Size:          int64(len(data)),
+		Pages:         vips.GetImageFilePages(img),
+	}
+
+	// The orientations 5-8 rotate the image by 90 or 270 degrees
+	if info.Orientation >= 5 {
+		info.Width, info.Height = info.Height, info.Width
+	}
+
+	for name, field := range imageInfoExifFields {
+		if value := parseExifValue(vips.GetImageField(img, field)); value != "" {
+			if info.Exif == nil {
+				info.Exif = map[string]string{}
+			}
+			info.Exif[name] = value
+		}
+	}
+
+	return json.Marshal(info)
+}
+
+// detectImageFormat returns the format of the image based on its magic bytes,
+// or the format from the content type header if it's not recognized.
+// e.g: detectImageFormat(data, "image/png") => "png"
+func detectImageFormat(data []byte, contentType string) string {
+	if format := vips.GetImageFormat(data); format != vips.UNKNOWN {
+		return string(format)
+	}
+	format := strings.TrimPrefix(strings.ToLower(strings.Split(contentType, ";")[0]), "image/")
+	return strings.TrimSuffix(format, "+xml")
+}
+
+// The suffix libvips adds after the EXIF value, e.g. ", ASCII, 6 components, 6 bytes)"
+var exifValueSuffix = regexp.MustCompile(`, [^,]+, \d+ components?, \d+ bytes?\)$`)
+
+// parseExifValue returns just the value of the EXIF field formatted by libvips.
+// libvips formats the values as "<value> (<raw value>, <type>, <n> components, <n> bytes)".
+// The raw value is usually the same as the value, so the value is the first half of the string before the suffix.
+// e.g: parseExifValue("Canon (Canon, ASCII, 6 components, 6 bytes)") => "Canon"
+func parseExifValue(value string) string {
+	if loc := exifValueSuffix.FindStringIndex(value); loc != nil {
+		prefix := value[:loc[0]]
+		if length := (len(prefix) - 2) / 2; length >= 0 && prefix[length:length+2] == " (" && prefix[:length] == prefix[length+2:] {
+			value = prefix[:length]
+		} else if index := strings.LastIndex(prefix, " ("); index != -1 {
+			// e.g: "1/60 sec. (1/60, Rational, 1 components, 8 bytes)"
+			value = prefix[:index]
+		}
+	}
+	return strings.TrimSpace(value)
+}
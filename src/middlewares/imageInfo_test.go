@@ -0,0 +1,28 @@
+package middlewares
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseExifValue(t *testing.T) {
+	assert.Equal(t, "Canon", parseExifValue("Canon (Canon, ASCII, 6 components, 6 bytes)"))
+	assert.Equal(t, "1/60 sec.", parseExifValue("1/60 sec. (1/60, Rational, 1 components, 8 bytes)"))
+	assert.Equal(t, "Photo (2024)", parseExifValue("Photo (2024) (Photo (2024), ASCII, 13 components, 13 bytes)"))
+	assert.Equal(t, "plain", parseExifValue("plain"))
+	assert.Equal(t, "", parseExifValue(""))
+}
+
+func TestDetectImageFormat(t *testing.T) {
+	t.Run("should detect format from magic bytes", func(t *testing.T) {
+		data := []byte{0x89, 0x50, 0x4E, 0x47, 0x0D, 0x0A, 0x1A, 0x0A, 0, 0, 0, 0x0D}
+		assert.Equal(t, "png", detectImageFormat(data, "image/jpeg"))
+	})
+
+	t.Run("should fallback to content type", func(t *testing.T) {
+		data := []byte("unknown image format")
+		assert.Equal(t, "avif", detectImageFormat(data, "image/avif"))
+		assert.Equal(t, "svg", detectImageFormat(data, "image/svg+xml; charset=utf-8"))
+	})
+}
@@ -0,0 +1,62 @@
+package middlewares
+
+import (
+	"sync"
+	"time"
+
+	"ownstak-proxy/src/vips"
+)
+
+// Default max number of pixels of the source image (width x height x loaded frames).
+// The small PNG or WebP file can declare enormous dimensions and explode the memory on decode,
+// so the dimensions are checked from the image header before the image is processed.
+// e.g. 8000x5000 image
+const defaultMaxImagePixels = 40_000_000
+
+// Default max duration of the image processing, from the load of the source image until the output image is encoded.
+const defaultImageProcessTimeout = 20 * time.Second
+
+// imageProcessWatchdog stops the processing of the image when it takes too long.
+// The libvips pipelines can't be cancelled by the context,
+// so it kills the source image and all operations reading its pixels fail as soon as possible.
+type imageProcessWatchdog struct {
+	mutex   sync.Mutex
+	timer   *time.Timer
+	img     *vips.VipsImage
+	stopped bool
+	expired bool
+}
+
+// startImageProcessWatchdog starts the watchdog for the source image.
+// Stop needs to be called before the image is freed.
+func startImageProcessWatchdog(img *vips.VipsImage, timeout time.Duration) *imageProcessWatchdog {
+	watchdog := &imageProcessWatchdog{img: img}
+	watchdog.timer = time.AfterFunc(timeout, watchdog.expire)
+	return watchdog
+}
+
+// expire kills the image unless the watchdog was already stopped.
+func (w *imageProcessWatchdog) expire() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.stopped {
+		return
+	}
+	w.expired = true
+	vips.SetImageKill(w.img, true)
+}
+
+// Expired returns true if the processing took longer than the timeout.
+func (w *imageProcessWatchdog) Expired() bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.expired
+}
+
+// Stop stops the watchdog, so the image can be safely freed.
+func (w *imageProcessWatchdog) Stop() {
+	w.timer.Stop()
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.stopped = true
+}
@@ -0,0 +1,25 @@
+package middlewares
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImageProcessWatchdog(t *testing.T) {
+	t.Run("should expire after the timeout", func(t *testing.T) {
+		watchdog := startImageProcessWatchdog(nil, time.Millisecond)
+		defer watchdog.Stop()
+
+		assert.Eventually(t, watchdog.Expired, time.Second, time.Millisecond)
+	})
+
+	t.Run("should not expire when stopped", func(t *testing.T) {
+		watchdog := startImageProcessWatchdog(nil, 5*time.Millisecond)
+		watchdog.Stop()
+
+		time.Sleep(10 * time.Millisecond)
+		assert.False(t, watchdog.Expired())
+	})
+}
@@ -1,15 +1,22 @@
 package middlewares
 
 import (
+	"context"
 	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"net/url"
 	"os"
 	"runtime"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"ownstak-proxy/src/constants"
@@ -17,23 +24,28 @@ import (
 	"ownstak-proxy/src/server"
 	"ownstak-proxy/src/utils"
 	"ownstak-proxy/src/vips"
-
-	"github.com/google/uuid"
 )
 
 /**
  * Image Optimizer Middleware
  *
  * This middleware allows customers to optimize images on the fly.
- * The Image Optimizer allows to fetch images from relative or absolute URLs on the same domain.
+ * The Image Optimizer allows to fetch images from relative or absolute URLs on the same domain
+ * and from the remote URLs allowed by the project's IMAGE_OPTIMIZER_REMOTE_PATTERNS (same semantics as Next.js images.remotePatterns).
+ * The remote images can't resolve to private, loopback or link-local IPs and the fetch follows at most 3 redirects to allowed URLs.
  * They don't need to be on OwnStak platform, so customers can fetch images from CDN cache.
  * The underlying library is libvips and it uses its own pool of threads to process images.
+ * The JPEG, PNG, WebP, GIF and TIFF images are always supported. The HEIC/HEIF, AVIF and JPEG XL images are supported
+ * only if libvips was built with libheif/libjxl. The supported formats are listed by the /__ownstak__/info endpoint.
  *
  * Throttling:
  * All image optimization requests are put into a queue and processed in FIFO order with configured concurrency based on VIPS_CONCURRENCY environment variable.
  * This is by default half of the available CPUs/threads to make sure it doesn't put too much load on the system and proxy has enough resources to handle standard IO requests.
- * If the request is in the queue too long, the client close/reset the connection during the waiting, the image optimization task is skipped.
+ * If the client close/reset the connection during the waiting, the image optimization task is skipped.
+ * If the request is in the queue too long, it's rejected with 529 status code and Retry-After header, so the CDN or client can retry it later.
  * Each concurrent thread that processes the image consumes around 100MB of RAM memory depending on image size, format etc...
+ * so the max concurrency is also limited by MAX_MEMORY and the queues shrink when the memory usage is above 80%
+ * and grow back when it's below 60%. The current occupancy of the queues is returned by the /__ownstak__/info endpoint.
  *
  * Usage:
  * The Image Optimizer is enabled by default as long as the libvips library was found on the system.
@@ -47,13 +59,103 @@ import (
  * - url: The relative or absolute URL of the image to optimize.
  * - width (or just w): The width of the image.
  * - height (or just h): The height of the image.
- * - format (or just f): The format of the image.
+ * - format (or just f): The format of the image. Use "auto" to pick the best format supported by the client based on the Accept header.
  * - quality (or just q): The quality of the image.
+ * - fit: How the image fits into both width and height. One of cover (default), contain, fill, inside, outside.
+ * - position (or just gravity): The part of the image to keep when cropping or where to place it when embedding.
+ *   One of center (default), top, right, bottom, left, top-left, top-right, bottom-left, bottom-right,
+ *   or entropy and attention to let libvips find the most interesting part of the image.
+ * - fp-x, fp-y: The focal point in the range 0-1 that takes precedence over the position. e.g. fp-x=0.3&fp-y=0.6
+ * - metadata: Which metadata to keep in the output image. One of strip (default), icc (keeps just ICC profile) or keep (keeps EXIF, XMP, IPTC and ICC profile).
+ * - dpr: The device pixel ratio in the range 1-4 that multiplies the width and height. e.g. w=100&dpr=2 returns 200px wide image.
+ * - rotate: Rotate the image clockwise by 0, 90, 180 or 270 degrees.
+ * - flip, flop: Mirror the image vertically (flip=true) or horizontally (flop=true).
+ * - blur: The sigma of the gaussian blur in the range 0-100. e.g. blur=5
+ * - sharpen: Sharpen the image (sharpen=true).
+ * - grayscale (or greyscale): Convert the image to black and white (grayscale=true).
+ * - tint: Convert the image to grayscale and colorize it with the hex color. e.g. tint=ff8000
+ * - brightness: Multiply the brightness of the image in the range 0-5. e.g. brightness=1.2 for 20% brighter image.
+ *   The effects are always applied in this order: rotate, flip, flop, resize, blur, sharpen, grayscale, tint, brightness, overlay.
+ * - overlay: The relative or absolute URL of the image (e.g. logo or watermark) composited over the image.
+ *   It's fetched with the same rules as the source image and it's cached in memory for few minutes.
+ * - overlay-position: Where to place the overlay. One of center, top, right, bottom, left, top-left, top-right, bottom-left, bottom-right (default).
+ * - overlay-opacity: The opacity of the overlay in the range 0-1. Defaults to 1.
+ * - overlay-scale: The width of the overlay relative to the output image in the range 0-1. e.g. overlay-scale=0.2
+ *   Defaults to the original size of the overlay. The overlay is always scaled down to fit into the output image.
+ * - frame: The frame of animated GIF/WebP image to return as static image. e.g. frame=0 returns the first frame as the poster image.
+ *   Without this param, the animated images keep all frames, their delays and loop count if the output format is webp, gif or auto.
+ *   Other output formats return just the first frame.
  * - enabled (or just e): Whether the Image Optimizer is enabled or not.
  *
+ * Srcset:
+ * The /__ownstak__/image/srcset endpoint returns the ready-to-use srcset attribute value
+ * and the list of image URLs for the given image, so framework integrations don't need to calculate them.
+ * - url: The relative or absolute URL of the image.
+ * - widths: Comma separated list of breakpoint widths. Defaults to the Next.js device sizes capped at maxDimension.
+ * - width (or just w): The width of the image for fixed size images. Returns density descriptors (1x, 2x) instead of widths.
+ * - dprs: Comma separated list of device pixel ratios for fixed size images. Defaults to 1,2.
+ * All other query params (q, f, fit, etc...) are passed through to the image URLs.
+ *
+ * For example:
+ * https://example.com/__ownstak__/image/srcset?url=/image.jpg&widths=640,1080&q=80
+ * => {"srcset": "/__ownstak__/image?q=80&url=%2Fimage.jpg&w=640 640w, /__ownstak__/image?q=80&url=%2Fimage.jpg&w=1080 1080w", ...}
+ *
+ * The images are automatically rotated based on their EXIF orientation
+ * and converted from their embedded ICC profile to sRGB before resizing.
+ *
+ * Placeholder:
+ * The /__ownstak__/image/placeholder endpoint returns the low-quality image placeholder (LQIP) as JSON,
+ * so SSR functions can inline it into HTML without shipping image libraries.
+ * It accepts the same params as the Image Optimizer and is cached the same way.
+ * - type: blur (default) returns the data URI of ~16px blurred WebP image, color returns the average color of the image.
+ *
+ * For example:
+ * https://example.com/__ownstak__/image/placeholder?url=/image.jpg&type=color
+ * => {"type": "color", "color": "#8a6f5c", "width": 11, "height": 16, "srcWidth": 640, "srcHeight": 960}
+ *
+ * Info:
+ * The /__ownstak__/image/info endpoint fetches the source image the same way as the Image Optimizer
+ * and returns its metadata as JSON without encoding any output image.
+ * The width and height are the displayed dimensions after applying the EXIF orientation.
+ *
+ * For example:
+ * https://example.com/__ownstak__/image/info?url=/image.jpg
+ * => {"url": "...", "format": "jpeg", "width": 640, "height": 960, "orientation": 6, "colorspace": "srgb", "size": 84512, "pages": 1, "exif": {"make": "Canon", ...}, ...}
+ *
+ * Presets:
+ * The projects can define named presets of the params in IMAGE_OPTIMIZER_PRESETS, so the frontends don't need to repeat them.
+ * The preset param expands the preset before the other params are parsed. The params in the query take precedence over the preset.
+ * When presetsOnly is enabled for the project, the requests with other params than url, preset and s are rejected with 400
+ * and the srcset endpoint is not available.
+ *
+ * For example:
+ * IMAGE_OPTIMIZER_PRESETS={"*.ownstak.link": {"presets": {"thumbnail": {"w": 200, "h": 200, "fit": "cover"}}}}
+ * https://example.com/__ownstak__/image?url=/image.jpg&preset=thumbnail
+ *
+ * Signed URLs:
+ * When IMAGE_OPTIMIZER_SIGNING_SECRETS contains a secret for the project host, all requests need to be signed
+ * with the "s" param containing HMAC-SHA256 signature of the path and all other query params.
+ * Unsigned or tampered requests are rejected with 403. Use the SignImageURL helper to generate signed URLs.
+ * The srcset endpoint needs to be signed too and it returns signed image URLs.
+ *
+ * Cache drop:
+ * The POST /__ownstak__/image/cache/drop endpoint drops the libvips operation cache and returns the freed memory to the OS.
+ * It requires the X-Own-Api-Token header matching INTERNAL_API_TOKEN. The libvips memory stats are returned by the /__ownstak__/info endpoint.
+ *
+ * Caching:
+ * When IMAGE_OPTIMIZER_CACHE_DIR is set, the optimized images are stored in the size-bounded LRU disk cache.
+ * The repeated requests are served from the cache without fetching the source image for IMAGE_OPTIMIZER_CACHE_TTL,
+ * then the source image is revalidated with its ETag/Last-Modified headers and processed again only if it changed.
+ * The source image's Cache-Control s-maxage/max-age or Expires header shortens this time if it's lower than the TTL,
+ * so the source images with no-cache or max-age=0 are revalidated on every request and their changes show up right away.
+ *
  * The Image Optimizer will return the optimized image and set the following headers:
  * - Content-Type: The content type of the output image.
  * - Cache-Control: The cache control header value for optimized images.
+ * - ETag: The hash of the source image version and all the params. Requests with matching If-None-Match get 304.
+ *   The ETag embeds the source image ETag, so it's forwarded to the origin together with If-Modified-Since
+ *   and the client gets 304 without processing the image again if the origin says the source image didn't change.
+ * - Last-Modified: The Last-Modified of the source image. Requests with If-Modified-Since get 304 if it didn't change.
  * - X-Own-Image-Optimizer: The X-Own-Image-Optimizer header value.
  *
  * The Image Optimizer will return the original image unchanged if:
@@ -64,8 +166,20 @@ import (
  * The Image Optimizer will return a 400 error if:
  * - The "url" query param is not provided.
  * - The "url" query param is not a valid URL.
- * - The "url" query param is not from the same domain.
+ * - The "url" query param is not from the same domain and doesn't match any allowed remote pattern.
  * - The "url" param points back to /__ownstak__/ path.
+ * - The image has more pixels (width x height x frames) than IMAGE_OPTIMIZER_MAX_PIXELS. The dimensions are read from the header before the pixels are decoded.
+ * - The image is truncated or corrupt. See VIPS_FAIL_ON environment variable.
+ * - The server of the source image returned other status code than 200, 404, 410 or 5xx.
+ * - The fetch of the source image was blocked by the remote patterns or redirected to not allowed URL.
+ *
+ * The Image Optimizer will return the 404 and 410 errors of the source image as-is,
+ * so the CDN can cache the missing images as missing.
+ *
+ * The Image Optimizer will return a 502 error if the server of the source image returned 5xx status code or the connection failed,
+ * and a 504 error if the fetch of the source image timed out.
+ *
+ * The Image Optimizer will return a 503 error if the processing takes longer than IMAGE_OPTIMIZER_PROCESS_TIMEOUT.
  */
 
 // Define limits and defaults
@@ -76,12 +190,24 @@ const maxImageSize = 6 * 1024 * 1024 // 6MB
 // Exceeding this limit won't throw an error, but the image will be resized to the limit.
 const maxDimension = 2560
 
+// Maximum device pixel ratio that multiplies the requested dimensions.
+const maxDpr = 4
+
 // Default width of image that optimizer will return.
 const defaultWidth = 0  // 0 means auto
 const defaultHeight = 0 // 0 means auto
 const defaultFormat = "webp"
+
+// The output format that is negotiated from the Accept header of the request.
+// AVIF => WebP => PNG (for transparent images) or JPEG
+const autoFormat = "auto"
 const defaultQuality = 60
 
+// Default max size of the disk cache for optimized images
+// and how long they are served without revalidating the source image.
+const defaultImageCacheSize = 1024 * 1024 * 1024 // 1GB
+const defaultImageCacheTTL = time.Hour
+
 // Cache control header value for optimized images.
 // Optimized images should be cached "publicly" by the CDN.
 const defaultCacheControl = "public, max-age=86400, s-maxage=31536000"
@@ -94,18 +220,122 @@ var supportedOutputFormats = map[string]bool{
 	"jpg":  true,
 	"jpeg": true,
 	"webp": true,
+	"png":  true,
+	"avif": true,
+}
+
+// Supported output formats that preserve the animation of GIF/WebP images.
+var animatedOutputFormats = map[string]bool{
+	"gif":  true,
+	"webp": true,
+}
+
+// Supported fit modes when both width and height are provided.
+// See: https://sharp.pixelplumbing.com/api-resize
+// - cover: Crop the image to cover both dimensions, preserving aspect ratio (default).
+// - contain: Embed the image within both dimensions, preserving aspect ratio and adding borders.
+// - fill: Stretch the image to both dimensions, ignoring aspect ratio.
+// - inside: Resize the image to be as large as possible while smaller or equal to both dimensions.
+// - outside: Resize the image to be as small as possible while larger or equal to both dimensions.
+const (
+	fitCover   = "cover"
+	fitContain = "contain"
+	fitFill    = "fill"
+	fitInside  = "inside"
+	fitOutside = "outside"
+)
+
+var supportedFits = map[string]bool{
+	fitCover:   true,
+	fitContain: true,
+	fitFill:    true,
+	fitInside:  true,
+	fitOutside: true,
+}
+
+// imageFocalPoint is the relative position in the image
+// that is kept in the crop for "cover" fit or where the image is placed for "contain" fit.
+// Both coordinates are in the range 0-1, where 0,0 is the top-left corner.
+type imageFocalPoint struct {
+	x float64
+	y float64
+}
+
+const positionCenter = "center"
+
+// Supported positions (gravity) and their focal points.
+var positionFocalPoints = map[string]imageFocalPoint{
+	positionCenter: {0.5, 0.5},
+	"centre":       {0.5, 0.5},
+	"top":          {0.5, 0},
+	"right":        {1, 0.5},
+	"bottom":       {0.5, 1},
+	"left":         {0, 0.5},
+	"top-left":     {0, 0},
+	"top-right":    {1, 0},
+	"bottom-left":  {0, 1},
+	"bottom-right": {1, 1},
+}
+
+// Supported positions that let libvips to find the most interesting part of the image.
+// - entropy: Keep the part with the highest entropy (the most details).
+// - attention: Keep the part with skin tones, saturated colors and edges.
+var positionSmartCrops = map[string]int{
+	"entropy":   vips.VIPS_INTERESTING_ENTROPY,
+	"attention": vips.VIPS_INTERESTING_ATTENTION,
+}
+
+// Supported values of the metadata param and the metadata they keep in the output image.
+// - strip: Remove all metadata to make the image smaller (default).
+// - icc: Keep just the ICC color profile.
+// - keep: Keep all metadata such as EXIF, XMP and IPTC with copyright information and ICC profile.
+const metadataStrip = "strip"
+
+var metadataKeepFlags = map[string]int{
+	metadataStrip: vips.VIPS_FOREIGN_KEEP_NONE,
+	"icc":         vips.VIPS_FOREIGN_KEEP_ICC,
+	"keep":        vips.VIPS_FOREIGN_KEEP_ALL,
+}
+
+// Default breakpoint widths for the srcset endpoint.
+// The same as the default device sizes in Next.js, capped at maxDimension.
+var defaultSrcsetWidths = []int{640, 750, 828, 1080, 1200, 1920, 2048, maxDimension}
+
+// Default device pixel ratios for the srcset endpoint when the image has a fixed width.
+var defaultSrcsetDprs = []float64{1, 2}
+
+type ImageSrcsetResponse struct {
+	Srcset  string              `json:"srcset"`
+	Sources []ImageSrcsetSource `json:"sources"`
+}
+
+type ImageSrcsetSource struct {
+	URL        string  `json:"url"`
+	Width      int     `json:"width"`
+	Dpr        float64 `json:"dpr"`
+	Descriptor string  `json:"descriptor"`
 }
 
 type ImageOptimizerMiddleware struct {
 	server.DefaultMiddleware
 
 	enabled bool
-	// Channel to control concurrent image processing and fetching
-	fetchQueue              chan struct{}
-	fetchQueueConcurrency   int
-	processQueue            chan struct{}
-	processQueueConcurrency int
-	client                  *http.Client
+	// Queues to control concurrent image processing and fetching
+	fetchQueue     *imageQueue
+	processQueue   *imageQueue
+	queueTimeout   time.Duration
+	maxPixels      int64
+	processTimeout time.Duration
+	client         *http.Client
+	defaultFormat  string
+	cache          *imageCache
+	signingSecrets map[string]string
+	remotePatterns map[string][]ImageRemotePattern
+	overlayCache   *imageOverlayCache
+	presets        map[string]ImagePresets
+	// Background worker that adjusts the queue limits based on memory usage
+	adjustCancel    context.CancelFunc
+	adjustWaitGroup sync.WaitGroup
 }
 
 func NewImageOptimizerMiddleware() *ImageOptimizerMiddleware {
@@ -114,8 +344,10 @@ func NewImageOptimizerMiddleware() *ImageOptimizerMiddleware {
 
 	// Create an HTTP client that can handle both HTTP and HTTPS
 	client := &http.Client{
+		CheckRedirect: checkImageRedirect, // Follow just few redirects to allowed URLs
 		Transport: &http.Transport{
-			ResponseHeaderTimeout: 20 * time.Second, // Fetch with timeout of 20 seconds (default is unlimited)
+			DialContext:           newImageDialContext(), // Block remote images pointing to the internal network
+			ResponseHeaderTimeout: 20 * time.Second,      // Fetch with timeout of 20 seconds (default is unlimited)
 			TLSClientConfig: &tls.Config{
 				InsecureSkipVerify: true, // Allow self-signed certificates
 			},
@@ -133,33 +365,308 @@ func NewImageOptimizerMiddleware() *ImageOptimizerMiddleware {
 		// The actual processing will be done by VIPS workers with VIPS_CONCURRENCY threads.
 		// Each VIPS concurrent thread consumes around 100MB of RAM memory depending on image size, format etc...
 		processConcurrency = vips.GetConcurrency()
-		fetchConcurrency = processConcurrency * 10
+		fetchConcurrency = processConcurrency * imageFetchQueueMultiplier
 	}
 
-	// Create a buffered channel to control concurrency
-	processQueue := make(chan struct{}, processConcurrency)
-	fetchQueue := make(chan struct{}, fetchConcurrency)
+	// The default output format when the format param is not provided.
+	// Set to "auto" to negotiate the format from the Accept header.
+	format := strings.ToLower(utils.GetEnvWithDefault(constants.EnvImageOptimizerDefaultFormat, defaultFormat))
+	if format != autoFormat && !supportedOutputFormats[format] {
+		logger.Warn("Invalid IMAGE_OPTIMIZER_DEFAULT_FORMAT value '%s', using default: %s", format, defaultFormat)
+		format = defaultFormat
+	}
+
+	// The disk cache for optimized images is enabled when the cache directory is set
+	var cache *imageCache
+	if cacheDir := utils.GetEnv(constants.EnvImageOptimizerCacheDir); cacheDir != "" && enabled {
+		cacheSize := uint64(defaultImageCacheSize)
+		if cacheSizeStr := utils.GetEnv(constants.EnvImageOptimizerCacheSize); cacheSizeStr != "" {
+			if size, err := utils.ParseMemorySize(cacheSizeStr); err == nil && size > 0 {
+				cacheSize = size
+			} else {
+				logger.Warn("Invalid IMAGE_OPTIMIZER_CACHE_SIZE format, using default: %s", utils.FormatBytes(cacheSize))
+			}
+		}
+		cacheTTL := defaultImageCacheTTL
+		if cacheTTLStr := utils.GetEnv(constants.EnvImageOptimizerCacheTTL); cacheTTLStr != "" {
+			if ttl, err := time.ParseDuration(cacheTTLStr); err == nil {
+				cacheTTL = ttl
+			} else {
+				logger.Warn("Invalid IMAGE_OPTIMIZER_CACHE_TTL format, using default: %v", cacheTTL)
+			}
+		}
+
+		var err error
+		if cache, err = newImageCache(cacheDir, int64(cacheSize), cacheTTL); err != nil {
+			logger.Warn("Disabling Image Optimizer cache - %v", err)
+		} else {
+			logger.Info("Image Optimizer cache enabled in %s (size: %s, ttl: %v)", cacheDir, utils.FormatBytes(cacheSize), cacheTTL)
+		}
+	}
+
+	// Load the secrets for signed URLs for each host pattern.
+	// e.g: {"*.aws-primary.my-org.ownstak.link": "my-secret"}
+	signingSecrets := map[string]string{}
+	if err := utils.GetEnvJSON(constants.EnvImageOptimizerSigningSecrets, &signingSecrets); err != nil {
+		logger.Warn("Invalid IMAGE_OPTIMIZER_SIGNING_SECRETS format, signed URLs are disabled: %v", err)
+		signingSecrets = map[string]string{}
+	}
+	for hostPattern, secret := range signingSecrets {
+		if secret == "" {
+			logger.Warn("Empty IMAGE_OPTIMIZER_SIGNING_SECRETS value for host '%s', signed URLs are disabled for it", hostPattern)
+			delete(signingSecrets, hostPattern)
+		}
+	}
+
+	// Load the allowed remote images for each host pattern.
+	// e.g: {"*.aws-primary.my-org.ownstak.link": [{"protocol": "https", "hostname": "**.amazonaws.com", "pathname": "/my-bucket/**"}]}
+	remotePatterns := map[string][]ImageRemotePattern{}
+	if err := utils.GetEnvJSON(constants.EnvImageOptimizerRemotePatterns, &remotePatterns); err != nil {
+		logger.Warn("Invalid IMAGE_OPTIMIZER_REMOTE_PATTERNS format, remote images are disabled: %v", err)
+		remotePatterns = map[string][]ImageRemotePattern{}
+	}
+
+	// Load the named presets for each host pattern.
+	// e.g: {"*.aws-primary.my-org.ownstak.link": {"presets": {"thumbnail": {"w": 200, "h": 200}}, "presetsOnly": true}}
+	presets := map[string]ImagePresets{}
+	if err := utils.GetEnvJSON(constants.EnvImageOptimizerPresets, &presets); err != nil {
+		logger.Warn("Invalid IMAGE_OPTIMIZER_PRESETS format, presets are disabled: %v", err)
+		presets = map[string]ImagePresets{}
+	}
+
+	// The limits that protect the server from the decompression bombs and images that take too long to process
+	maxPixels := int64(defaultMaxImagePixels)
+	if maxPixelsStr := utils.GetEnv(constants.EnvImageOptimizerMaxPixels); maxPixelsStr != "" {
+		if pixels, err := strconv.ParseInt(maxPixelsStr, 10, 64); err == nil && pixels > 0 {
+			maxPixels = pixels
+		} else {
+			logger.Warn("Invalid IMAGE_OPTIMIZER_MAX_PIXELS format, using default: %d", maxPixels)
+		}
+	}
+	processTimeout := defaultImageProcessTimeout
+	if processTimeoutStr := utils.GetEnv(constants.EnvImageOptimizerProcessTimeout); processTimeoutStr != "" {
+		if timeout, err := time.ParseDuration(processTimeoutStr); err == nil && timeout > 0 {
+			processTimeout = timeout
+		} else {
+			logger.Warn("Invalid IMAGE_OPTIMIZER_PROCESS_TIMEOUT format, using default: %v", processTimeout)
+		}
+	}
 
 	logger.Info("Image Optimizer middleware initialized with concurrency (fetch: %d, process: %d)", fetchConcurrency, processConcurrency)
 
 	return &ImageOptimizerMiddleware{
-		enabled:                 enabled,
-		fetchQueue:              fetchQueue,
-		fetchQueueConcurrency:   fetchConcurrency,
-		processQueue:            processQueue,
-		processQueueConcurrency: processConcurrency,
-		client:                  client,
+		enabled:        enabled,
+		fetchQueue:     newImageQueue(fetchConcurrency),
+		processQueue:   newImageQueue(processConcurrency),
+		queueTimeout:   imageQueueTimeout,
+		maxPixels:      maxPixels,
+		processTimeout: processTimeout,
+		client:         client,
+		defaultFormat:  format,
+		cache:          cache,
+		signingSecrets: signingSecrets,
+		remotePatterns: remotePatterns,
+		overlayCache:   newImageOverlayCache(overlayCacheSize, overlayCacheTTL),
+		presets:        presets,
+	}
+}
+
+// OnStart is called when the server starts
+func (m *ImageOptimizerMiddleware) OnStart(server *server.Server) {
+	if !m.enabled || server.MaxMemory == 0 {
+		return
+	}
+
+	// Don't start more processing threads than fit into the memory
+	// and keep the rest of the memory for standard IO requests.
+	// Example: MAX_MEMORY=1024MiB and VIPS_CONCURRENCY=16 results in concurrency (fetch: 80, process: 8)
+	memoryConcurrency := int(server.MaxMemory * imageQueueShrinkMemoryPct / 100 / imageProcessMemory)
+	processConcurrency := min(m.processQueue.Stats().MaxLimit, max(1, memoryConcurrency))
+	m.processQueue.SetMaxLimit(processConcurrency)
+	m.fetchQueue.SetMaxLimit(processConcurrency * imageFetchQueueMultiplier)
+	logger.Info("Image Optimizer middleware adjusted max concurrency to available memory (fetch: %d, process: %d)", processConcurrency*imageFetchQueueMultiplier, processConcurrency)
+
+	m.startQueueAdjuster(server)
+}
+
+// OnStop is called when the server stops
+func (m *ImageOptimizerMiddleware) OnStop(server *server.Server) {
+	if m.adjustCancel == nil {
+		return
+	}
+	m.adjustCancel()
+	m.adjustWaitGroup.Wait()
+	m.adjustCancel = nil
+}
+
+// startQueueAdjuster starts the background worker that shrinks the queue limits
+// when the server is running out of memory and grows them back when the memory is freed.
+func (m *ImageOptimizerMiddleware) startQueueAdjuster(server *server.Server) {
+	adjustCtx, adjustCancel := context.WithCancel(context.Background())
+	m.adjustCancel = adjustCancel
+	m.adjustWaitGroup.Add(1)
+
+	go func() {
+		defer m.adjustWaitGroup.Done()
+
+		ticker := time.NewTicker(imageQueueAdjustInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-adjustCtx.Done():
+				return
+			case <-ticker.C:
+				m.adjustQueues(server.UsedMemory, server.MaxMemory)
+			}
+		}
+	}()
+}
+
+// adjustQueues sets the queue limits for the current memory usage.
+func (m *ImageOptimizerMiddleware) adjustQueues(usedMemory, maxMemory uint64) {
+	processStats := m.processQueue.Stats()
+	processLimit := nextImageQueueLimit(processStats.Limit, processStats.MaxLimit, usedMemory, maxMemory)
+	if processLimit == processStats.Limit {
+		return
+	}
+	m.processQueue.SetLimit(processLimit)
+	m.fetchQueue.SetLimit(processLimit * imageFetchQueueMultiplier)
+	logger.Debug("Image Optimizer - Adjusted concurrency to memory usage %s/%s (fetch: %d, process: %d)", utils.FormatBytes(usedMemory), utils.FormatBytes(maxMemory), m.fetchQueue.Limit(), processLimit)
+}
+
+// QueueStats returns the current occupancy of the fetch and process queues.
+func (m *ImageOptimizerMiddleware) QueueStats() ImageOptimizerQueueStats {
+	return ImageOptimizerQueueStats{
+		Fetch:   m.fetchQueue.Stats(),
+		Process: m.processQueue.Stats(),
+	}
+}
+
+// ImageOptimizerInfo is the state and capabilities of the Image Optimizer
+// returned by the /__ownstak__/info endpoint.
+type ImageOptimizerInfo struct {
+	InputFormats  []string                 `json:"inputFormats"`
+	OutputFormats []string                 `json:"outputFormats"`
+	Queues        ImageOptimizerQueueStats `json:"queues"`
+	Vips          vips.Stats               `json:"vips"`
+}
+
+// Info returns the formats supported by the loaded libvips, the current occupancy of the queues
+// and the memory tracked by libvips. The optional input formats such as HEIF or JPEG XL depend on how libvips was built.
+func (m *ImageOptimizerMiddleware) Info() ImageOptimizerInfo {
+	info := ImageOptimizerInfo{
+		InputFormats:  []string{},
+		OutputFormats: []string{},
+		Queues:        m.QueueStats(),
+	}
+	if err := vips.ReadVipsMemStats(&info.Vips); err != nil {
+		logger.Debug("Image Optimizer - Failed to read VIPS stats: %v", err)
+	}
+	for _, format := range vips.GetSupportedInputFormats() {
+		info.InputFormats = append(info.InputFormats, string(format))
+	}
+	for _, format := range vips.GetSupportedOutputFormats() {
+		if supportedOutputFormats[string(format)] {
+			info.OutputFormats = append(info.OutputFormats, string(format))
+		}
+	}
+	return info
+}
+
+// acquireQueue waits for a free slot in the queue.
+// Returns false and responds with 529 if the request waited too long,
+// or just returns false if the client is no longer waiting for the response.
+func (m *ImageOptimizerMiddleware) acquireQueue(ctx *server.RequestContext, queue *imageQueue, name string) bool {
+	err := queue.Acquire(ctx.Request.Context(), m.queueTimeout)
+	if err == nil {
+		return true
+	}
+	m.queueError(ctx, err, name)
+	return false
+}
+
+// queueError responds with 529 if the request waited for the queue slot too long.
+// Otherwise the request was cancelled and there's nobody to respond to.
+func (m *ImageOptimizerMiddleware) queueError(ctx *server.RequestContext, err error, name string) {
+	if errors.Is(err, errImageQueueTimeout) {
+		// ctx.Error ends the response and writes its head to the response writer right away,
+		// so the Retry-After header needs to be on the writer before it's called.
+		if ctx.Response.ResponseWriter != nil {
+			ctx.Response.ResponseWriter.Header().Set(server.HeaderRetryAfter, imageQueueRetryAfter)
+		}
+		ctx.Error(fmt.Sprintf("Server is overloaded: Image Optimizer couldn't enqueue the request in time because of high load. Please try again later. (%s queue slot timeout: %s)", name, m.queueTimeout.String()), server.StatusServiceOverloaded)
+		// Keep it in the response headers too, so the other middlewares and logs can see it
+		ctx.Response.Headers.Set(server.HeaderRetryAfter, imageQueueRetryAfter)
+	}
+}
+
+// handleCacheDrop drops the libvips operation cache and returns the freed heap memory back to the OS.
+// It's meant to be called on demand during incidents when the memory usage is too high.
+// e.g: POST /__ownstak__/image/cache/drop
+func (m *ImageOptimizerMiddleware) handleCacheDrop(ctx *server.RequestContext) {
+	if ctx.Request.Method != "POST" {
+		ctx.Error("Failed to drop image cache: Method not allowed", server.StatusMethodNotAllowed)
+		return
+	}
+	if !ctx.IsAuthorized() {
+		ctx.Error(fmt.Sprintf("Failed to drop image cache: Unauthorized. The valid %s header is required.", server.HeaderXOwnApiToken), server.StatusUnauthorized)
+		return
 	}
+
+	var before, after vips.Stats
+	if err := vips.ReadVipsMemStats(&before); err != nil {
+		ctx.Error(fmt.Sprintf("Failed to drop image cache: %v", err), server.StatusServiceUnavailable)
+		return
+	}
+	vips.CacheDrop()
+	vips.MallocTrim()
+	vips.ReadVipsMemStats(&after)
+	logger.Info("Dropped VIPS cache, tracked memory: %s => %s", utils.FormatBytes(uint64(before.Mem)), utils.FormatBytes(uint64(after.Mem)))
+
+	jsonData, _ := json.Marshal(map[string]interface{}{
+		"before": before,
+		"after":  after,
+	})
+	ctx.Response.Status = server.StatusOK
+	ctx.Response.Headers.Set(server.HeaderContentType, server.ContentTypeJSON)
+	ctx.Response.Body = jsonData
 }
 
 func (m *ImageOptimizerMiddleware) OnRequest(ctx *server.RequestContext, next func()) {
 	// Run the Image Optimizer middleware only on below path
 	imageOptimizerPath := constants.InternalPathPrefix + "/image"
-	if ctx.Request.Path != imageOptimizerPath && ctx.Request.Path != imageOptimizerPath+"/" {
+
+	// Handle the internal endpoint that drops the libvips cache
+	if ctx.Request.Path == imageOptimizerPath+"/cache/drop" {
+		m.handleCacheDrop(ctx)
+		return
+	}
+	if ctx.Request.Path != imageOptimizerPath && ctx.Request.Path != imageOptimizerPath+"/" && ctx.Request.Path != imageOptimizerPath+"/srcset" && ctx.Request.Path != imageOptimizerPath+"/placeholder" && ctx.Request.Path != imageOptimizerPath+"/info" {
 		next()
 		return
 	}
 
+	// Reject unsigned or tampered requests if the project has the signing secret configured,
+	// so nobody can burn our CPU with arbitrary params.
+	signingSecret, signed := utils.GetHostConfig(m.signingSecrets, ctx.Request.Host)
+	if signed && !verifyImageSignature(signingSecret, ctx.Request.Path, ctx.Request.Query) {
+		ctx.Error("Image Optimizer failed: Missing or invalid signature", http.StatusForbidden)
+		return
+	}
+
+	// The srcset endpoint generates the image URLs with arbitrary widths,
+	// so it's not available for the projects that accept just the presets.
+	presets, _ := utils.GetHostConfig(m.presets, ctx.Request.Host)
+	if ctx.Request.Path == imageOptimizerPath+"/srcset" {
+		if presets.PresetsOnly {
+			ctx.Error("Image Optimizer failed: Only presets are allowed for this project", http.StatusBadRequest)
+			return
+		}
+		m.handleSrcset(ctx, signingSecret)
+		return
+	}
+
 	// Only allow GET, HEAD and OPTIONS methods to avoid caching issues
 	// and wasting resources on processing requests with large bodies.
 	if ctx.Request.Method != "GET" && ctx.Request.Method != "HEAD" && ctx.Request.Method != "OPTIONS" {
@@ -167,6 +674,15 @@ func (m *ImageOptimizerMiddleware) OnRequest(ctx *server.RequestContext, next fu
 		return
 	}
 
+	// Expand the named preset into the params before parsing them,
+	// so the presets support all the params and they're validated the same way.
+	query, err := applyImagePreset(ctx.Request.Query, presets)
+	if err != nil {
+		ctx.Error(fmt.Sprintf("Image Optimizer failed: %v", err), http.StatusBadRequest)
+		return
+	}
+	ctx.Request.Query = query
+
 	// Start timing the optimization process
 	startTime := time.Now()
 
@@ -175,7 +691,14 @@ func (m *ImageOptimizerMiddleware) OnRequest(ctx *server.RequestContext, next fu
 	quality := GetQueryParam(ctx.Request.Query, "quality", "q", strconv.Itoa(defaultQuality))
 	width := GetQueryParam(ctx.Request.Query, "width", "w", strconv.Itoa(defaultWidth))
 	height := GetQueryParam(ctx.Request.Query, "height", "h", strconv.Itoa(defaultHeight))
-	format := GetQueryParam(ctx.Request.Query, "format", "f", defaultFormat)
+	dpr := GetQueryParam(ctx.Request.Query, "dpr", "", "1")
+	format := GetQueryParam(ctx.Request.Query, "format", "f", m.defaultFormat)
+	fit := GetQueryParam(ctx.Request.Query, "fit", "", fitCover)
+	position := GetQueryParam(ctx.Request.Query, "position", "gravity", positionCenter)
+	focalPointX := GetQueryParam(ctx.Request.Query, "fp-x", "", "")
+	focalPointY := GetQueryParam(ctx.Request.Query, "fp-y", "", "")
+	metadata := GetQueryParam(ctx.Request.Query, "metadata", "", metadataStrip)
+	frame := GetQueryParam(ctx.Request.Query, "frame", "", "")
 
 	// Check if the Image Optimizer can and should be applied to the image
 	enabled := m.enabled
@@ -191,12 +714,13 @@ func (m *ImageOptimizerMiddleware) OnRequest(ctx *server.RequestContext, next fu
 
 	// Validate output format
 	format = strings.ToLower(format)
-	if !supportedOutputFormats[format] {
+	if format != autoFormat && !supportedOutputFormats[format] {
 		// output formats as string, comma separated
-		outputFormats := make([]string, 0, len(supportedOutputFormats))
+		outputFormats := make([]string, 0, len(supportedOutputFormats)+1)
 		for format := range supportedOutputFormats {
 			outputFormats = append(outputFormats, format)
 		}
+		outputFormats = append(outputFormats, autoFormat)
 		outputFormatsString := strings.Join(outputFormats, ", ")
 		ctx.Error(fmt.Sprintf("Image Optimizer failed: Unsupported output format: %s. Supported formats are: %s", format, outputFormatsString), http.StatusBadRequest)
 		return
@@ -229,43 +753,291 @@ func (m *ImageOptimizerMiddleware) OnRequest(ctx *server.RequestContext, next fu
 		parsedURL.Host = currentHost
 	}
 
-	// Don't allow fetching images from other domains or even subdomains,
+	// Don't allow fetching images from other domains or even subdomains unless they match the project's remote patterns,
 	// so people can't use this proxy/image optimizer to fetch images from other sites.
 	// For example by setting DNS records images.example.com to your server and example.com to this proxy.
 	// This feature is allowed in development mode, so we can easily test it locally when runnning ./scripts/dev.sh.
-	if parsedURL.Host != ctx.Request.Host && constants.Mode != "development" {
-		ctx.Error("Image Optimizer failed: URL must be from the same domain. Fetching images from external domains is not allowed in the production mode.", http.StatusBadRequest)
+	var fetchPolicy *imageFetchPolicy
+	if constants.Mode != "development" {
+		remotePatterns, _ := utils.GetHostConfig(m.remotePatterns, ctx.Request.Host)
+		fetchPolicy = &imageFetchPolicy{host: ctx.Request.Host, remotePatterns: remotePatterns}
+		if !fetchPolicy.Allows(parsedURL) {
+			ctx.Error("Image Optimizer failed: URL must be from the same domain or match the allowed remote patterns. Fetching images from other external domains is not allowed in the production mode.", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Convert quality to integer
+	qualityInt, err := strconv.Atoi(quality)
+	if err != nil || qualityInt < 1 || qualityInt > 100 {
+		ctx.Error("Image Optimizer failed: Quality must be a number between 1 and 100", http.StatusBadRequest)
+		return
+	}
+
+	// Convert dimensions to integers
+	widthInt, err := strconv.Atoi(width)
+	if err != nil || widthInt < 0 {
+		ctx.Error("Image Optimizer failed: Width must be a positive number", http.StatusBadRequest)
+		return
+	}
+
+	heightInt, err := strconv.Atoi(height)
+	if err != nil || heightInt < 0 {
+		ctx.Error("Image Optimizer failed: Height must be a positive number", http.StatusBadRequest)
+		return
+	}
+
+	// Multiply the requested dimensions by the device pixel ratio,
+	// so the image is sharp on high density displays.
+	// The result is capped at maxDimension by the resize plan.
+	dprFloat, err := strconv.ParseFloat(dpr, 64)
+	if err != nil || dprFloat < 1 || dprFloat > maxDpr {
+		ctx.Error(fmt.Sprintf("Image Optimizer failed: DPR must be a number between 1 and %d", maxDpr), http.StatusBadRequest)
 		return
 	}
+	widthInt = int(math.Round(float64(widthInt) * dprFloat))
+	heightInt = int(math.Round(float64(heightInt) * dprFloat))
+
+	// Validate fit mode
+	fit = strings.ToLower(fit)
+	if !supportedFits[fit] {
+		ctx.Error(fmt.Sprintf("Image Optimizer failed: Unsupported fit: %s. Supported fits are: %s", fit, strings.Join(sortedKeys(supportedFits), ", ")), http.StatusBadRequest)
+		return
+	}
+
+	// The placeholder endpoint returns the tiny version of the image
+	// as JSON with the data URI of blurred WebP image or just its average color.
+	placeholder := ""
+	if ctx.Request.Path == imageOptimizerPath+"/placeholder" {
+		placeholder = strings.ToLower(GetQueryParam(ctx.Request.Query, "type", "", placeholderBlur))
+		if !supportedPlaceholders[placeholder] {
+			ctx.Error(fmt.Sprintf("Image Optimizer failed: Unsupported placeholder type: %s. Supported types are: %s", placeholder, strings.Join(sortedKeys(supportedPlaceholders), ", ")), http.StatusBadRequest)
+			return
+		}
+		widthInt, heightInt, fit = placeholderDimensions(widthInt, heightInt, fit)
+		format = "webp"
+		if GetQueryParam(ctx.Request.Query, "quality", "q", "") == "" {
+			qualityInt = placeholderQuality
+		}
+	}
+
+	// The info endpoint returns the metadata of the source image as JSON
+	// without encoding any output image, so the other params don't apply to it.
+	info := ctx.Request.Path == imageOptimizerPath+"/info"
+	if info {
+		format = "json"
+	}
+
+	// Convert position to the focal point or smart crop strategy
+	position = strings.ToLower(position)
+	focalPoint, isPosition := positionFocalPoints[position]
+	smartCrop, isSmartCrop := positionSmartCrops[position]
+	if !isPosition && !isSmartCrop {
+		positions := append(sortedKeys(positionFocalPoints), sortedKeys(positionSmartCrops)...)
+		ctx.Error(fmt.Sprintf("Image Optimizer failed: Unsupported position: %s. Supported positions are: %s", position, strings.Join(positions, ", ")), http.StatusBadRequest)
+		return
+	}
+	if isSmartCrop {
+		focalPoint = positionFocalPoints[positionCenter]
+	}
+
+	// The explicit focal point takes precedence over the position
+	if focalPointX != "" || focalPointY != "" {
+		focalPoint, err = parseFocalPoint(focalPointX, focalPointY)
+		if err != nil {
+			ctx.Error(fmt.Sprintf("Image Optimizer failed: %v", err), http.StatusBadRequest)
+			return
+		}
+		smartCrop = vips.VIPS_INTERESTING_NONE
+	}
+
+	// Validate which metadata to keep in the output image
+	metadata = strings.ToLower(metadata)
+	keepMetadata, ok := metadataKeepFlags[metadata]
+	if !ok {
+		ctx.Error(fmt.Sprintf("Image Optimizer failed: Unsupported metadata: %s. Supported values are: %s", metadata, strings.Join(sortedKeys(metadataKeepFlags), ", ")), http.StatusBadRequest)
+		return
+	}
+
+	// Validate the effects applied to the image
+	effects, err := parseImageEffects(ctx.Request.Query)
+	if err != nil {
+		ctx.Error(fmt.Sprintf("Image Optimizer failed: %v", err), http.StatusBadRequest)
+		return
+	}
+	if placeholder == placeholderBlur && effects.blur == 0 {
+		effects.blur = placeholderBlurSigma
+	}
+
+	// Validate the overlay (watermark) composited over the image.
+	// It's fetched with the same allowlist rules as the source image.
+	var overlay *imageOverlay
+	if !info {
+		overlay, err = parseImageOverlay(ctx.Request.Query, ctx.Request.Scheme, currentHost, fetchPolicy)
+		if err != nil {
+			ctx.Error(fmt.Sprintf("Image Optimizer failed: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Validate the frame of animated image to extract, -1 keeps the animation
+	frameInt := -1
+	if frame != "" {
+		frameInt, err = strconv.Atoi(frame)
+		if err != nil || frameInt < 0 {
+			ctx.Error("Image Optimizer failed: Frame must be a positive number", http.StatusBadRequest)
+			return
+		}
+	} else if placeholder != "" {
+		// The placeholder is always generated from the first frame
+		frameInt = 0
+	}
+
+	// The cache key contains the source URL and all the params that affect the output image.
+	// The "auto" format is resolved to the best format accepted by the client,
+	// because the transparency of the same source image doesn't change.
+	formatKey := format
+	if format == autoFormat {
+		formatKey = autoFormat + ":" + negotiateOutputFormat(ctx.Request.Headers.Get(server.HeaderAccept), false)
+	}
+	cacheKey := imageCacheKey(
+		parsedURL.String(),
+		formatKey,
+		strconv.Itoa(qualityInt),
+		strconv.Itoa(widthInt),
+		strconv.Itoa(heightInt),
+		fit,
+		fmt.Sprintf("%g,%g,%d", focalPoint.x, focalPoint.y, smartCrop),
+		metadata,
+		effects.String(),
+		placeholder,
+		strconv.Itoa(frameInt),
+		overlay.String(),
+	)
+	if info {
+		// All info requests for the same image share the cache entry
+		cacheKey = imageCacheKey(parsedURL.String(), "info")
+	}
+
+	// Serve the optimized image from the cache without fetching the source image
+	// if it was stored recently. Otherwise, revalidate the source image first.
+	var cachedEntry imageCacheEntry
+	cached := false
+	if enabled && m.cache != nil {
+		cachedEntry, cached = m.cache.Get(cacheKey)
+		if cached && m.cache.IsFresh(cachedEntry) {
+			if m.serveCachedImage(ctx, cachedEntry, format == autoFormat, "HIT") {
+				return
+			}
+			m.cache.Delete(cacheKey)
+			cached = false
+		}
+	}
 
 	// Wait for an available slot in the fetch queue
 	// before we try to fetch the image.
-	select {
-	case m.fetchQueue <- struct{}{}:
-		// Got a slot, fetch the image
-	case <-ctx.Request.Context().Done():
-		// Request was cancelled or connection was closed
-		// Just return without error as the client is no longer waiting for the response
+	if !m.acquireQueue(ctx, m.fetchQueue, "fetch") {
 		return
 	}
 
 	// Fetch the image
 	fetchStartTime := time.Now()
 	logger.Debug("Image Optimizer - Fetching image from %s", parsedURL.String())
-	resp, err := m.client.Get(parsedURL.String())
+	fetchCtx := ctx.Request.Context()
+	if fetchPolicy != nil {
+		// Pass the policy to the client, so it can check the redirects and resolved IPs
+		fetchCtx = context.WithValue(fetchCtx, imageFetchPolicyKey{}, fetchPolicy)
+	}
+	fetchReq, err := http.NewRequestWithContext(fetchCtx, http.MethodGet, parsedURL.String(), nil)
 	if err != nil {
-		ctx.Error(fmt.Sprintf("Image Optimizer failed: Failed to fetch image: %v", err), http.StatusBadRequest)
+		m.fetchQueue.Release()
+		ctx.Error(fmt.Sprintf("Image Optimizer failed: Invalid URL: %v", err), http.StatusBadRequest)
 		return
 	}
-	if resp.StatusCode != 200 {
-		ctx.Error(fmt.Sprintf("Image Optimizer failed: Failed to fetch image: Server returned status code %d", resp.StatusCode), http.StatusBadRequest)
+	// Ask the server just for the changed source image if we have the optimized one in the cache
+	if cached {
+		if cachedEntry.SourceETag != "" {
+			fetchReq.Header.Set(server.HeaderIfNoneMatch, cachedEntry.SourceETag)
+		}
+		if cachedEntry.SourceLastModified != "" {
+			fetchReq.Header.Set(server.HeaderIfModifiedSince, cachedEntry.SourceLastModified)
+		}
+	}
+	// Otherwise, forward the client's conditional headers to the server,
+	// so we don't need to fetch and process the image the client already has.
+	// The If-Modified-Since is ignored when the request has If-None-Match (RFC 9110 section 13.1.3),
+	// even if its ETag wasn't issued by us and it's not forwarded.
+	forwardedETag := ""
+	forwarded := false
+	if !cached && enabled {
+		if ifNoneMatch := ctx.Request.Headers.Get(server.HeaderIfNoneMatch); ifNoneMatch != "" {
+			if forwardedETag = imageSourceETag(ifNoneMatch, cacheKey); forwardedETag != "" {
+				fetchReq.Header.Set(server.HeaderIfNoneMatch, forwardedETag)
+				forwarded = true
+			}
+		} else if ifModifiedSince := ctx.Request.Headers.Get(server.HeaderIfModifiedSince); ifModifiedSince != "" {
+			fetchReq.Header.Set(server.HeaderIfModifiedSince, ifModifiedSince)
+			forwarded = true
+		}
+	}
+	resp, err := m.client.Do(fetchReq)
+
+	// Release the fetch slot
+	m.fetchQueue.Release()
+
+	if err != nil {
+		if ctx.Request.Context().Err() != nil {
+			// The client closed the connection, there's nobody to respond to
+			return
+		}
+		ctx.Error(fmt.Sprintf("Image Optimizer failed: Failed to fetch image: %v", err), imageFetchErrorStatus(err))
 		return
 	}
 	defer resp.Body.Close()
-	fetchDuration := time.Since(fetchStartTime)
 
-	// Release the fetch slot
-	func() { <-m.fetchQueue }()
+	// The source image didn't change since the client got the optimized image
+	if forwarded && resp.StatusCode == http.StatusNotModified {
+		srcETag := resp.Header.Get(server.HeaderETag)
+		if srcETag == "" {
+			srcETag = forwardedETag
+		}
+		if srcETag != "" {
+			ctx.Response.Headers.Set(server.HeaderETag, imageETag(cacheKey, srcETag, nil))
+		}
+		if lastModified := resp.Header.Get(server.HeaderLastModified); lastModified != "" {
+			ctx.Response.Headers.Set(server.HeaderLastModified, lastModified)
+		}
+		cacheControl := resp.Header.Get(server.HeaderCacheControl)
+		if cacheControl == "" {
+			cacheControl = defaultCacheControl
+		}
+		ctx.Response.Headers.Set(server.HeaderCacheControl, cacheControl)
+		if format == autoFormat {
+			ctx.Response.Headers.Add(server.HeaderVary, server.HeaderAccept)
+		}
+		ctx.Debug("io-cache=NOT-MODIFIED")
+		ctx.Response.Status = http.StatusNotModified
+		return
+	}
+
+	// The source image didn't change, serve the optimized image from the cache
+	if cached && (resp.StatusCode == http.StatusNotModified || (resp.StatusCode == http.StatusOK && cachedEntry.SourceETag != "" && resp.Header.Get(server.HeaderETag) == cachedEntry.SourceETag)) {
+		m.cache.Touch(cacheKey, imageSourceFreshUntil(resp.Header))
+		if m.serveCachedImage(ctx, cachedEntry, format == autoFormat, "REVALIDATED") {
+			return
+		}
+		// The cached image was evicted in the meantime and the source image body is empty,
+		// so the client needs to retry the request.
+		m.cache.Delete(cacheKey)
+		ctx.Error("Image Optimizer failed: Cached image is not available, please try again", server.StatusInternalError)
+		return
+	}
+
+	if resp.StatusCode != 200 {
+		ctx.Error(fmt.Sprintf("Image Optimizer failed: Failed to fetch image: Server returned status code %d", resp.StatusCode), imageUpstreamStatus(resp.StatusCode))
+		return
+	}
+	fetchDuration := time.Since(fetchStartTime)
 
 	// Check if the response is an image
 	if !strings.HasPrefix(resp.Header.Get(server.HeaderContentType), "image/") {
@@ -298,6 +1070,16 @@ func (m *ImageOptimizerMiddleware) OnRequest(ctx *server.RequestContext, next fu
 	// This protects against someone abusing the service to fetch massive files
 	limitedReader := io.LimitReader(resp.Body, maxImageSize+1)
 
+	// The placeholders can't be generated without libvips
+	if placeholder != "" && (!enabled || strings.Contains(resp.Header.Get(server.HeaderContentType), "svg")) {
+		ctx.Error("Image Optimizer failed: Placeholders are not available for this image", http.StatusUnprocessableEntity)
+		return
+	}
+	if info && (!enabled || strings.Contains(resp.Header.Get(server.HeaderContentType), "svg")) {
+		ctx.Error("Image Optimizer failed: Info is not available for this image", http.StatusUnprocessableEntity)
+		return
+	}
+
 	// If the Image Optimizer is disabled or the image type is an SVG,
 	// just return the original image unchanged, so it still works locally even without the libvips installed.
 	if !enabled || strings.Contains(resp.Header.Get(server.HeaderContentType), "svg") {
@@ -321,63 +1103,109 @@ func (m *ImageOptimizerMiddleware) OnRequest(ctx *server.RequestContext, next fu
 		return
 	}
 
-	// Convert quality to integer
-	qualityInt, err := strconv.Atoi(quality)
-	if err != nil || qualityInt < 1 || qualityInt > 100 {
-		ctx.Error("Image Optimizer failed: Quality must be a number between 1 and 100", http.StatusBadRequest)
-		return
+	// Fetch the overlay before we start to process the image,
+	// so it doesn't block the process queue.
+	var overlayData []byte
+	if overlay != nil {
+		overlayData, err = m.fetchOverlay(ctx.Request.Context(), overlay, fetchPolicy)
+		if err != nil {
+			if errors.Is(err, errImageQueueTimeout) || ctx.Request.Context().Err() != nil {
+				m.queueError(ctx, err, "fetch")
+				return
+			}
+			ctx.Error(fmt.Sprintf("Image Optimizer failed: Failed to fetch overlay: %v", err), http.StatusBadRequest)
+			return
+		}
+		// libvips reads the overlay image directly from overlayData
+		defer runtime.KeepAlive(overlayData)
 	}
 
-	// Convert dimensions to integers
-	widthInt, err := strconv.Atoi(width)
-	if err != nil || widthInt < 0 {
-		ctx.Error("Image Optimizer failed: Width must be a positive number", http.StatusBadRequest)
+	// Wait for an available slot in the process queue
+	// before we start to process the image.
+	if !m.acquireQueue(ctx, m.processQueue, "process") {
 		return
 	}
+	defer m.processQueue.Release() // Release the slot when we are done
 
-	heightInt, err := strconv.Atoi(height)
-	if err != nil || heightInt < 0 {
-		ctx.Error("Image Optimizer failed: Height must be a positive number", http.StatusBadRequest)
+	// Run VIPS thread shutdown when we are done or if we get an error
+	defer vips.ThreadShutdown()
+	defer vips.MallocTrim()
+
+	// Read the fetched image into memory only after we got the slot in the process queue,
+	// so the memory is bounded by the process queue concurrency and maxImageSize,
+	// and the image is processed without any tmp files on the disk.
+	srcData, err := io.ReadAll(limitedReader)
+	if err != nil {
+		ctx.Error(fmt.Sprintf("Image Optimizer failed: Failed to stream image: %v", err), server.StatusInternalError)
 		return
 	}
-
-	// Wait for an available slot in the process queue
-	// before we start to process the image.
-	select {
-	case m.processQueue <- struct{}{}:
-		// Got a slot, process the image
-		defer func() { <-m.processQueue }() // Release the slot when we are done
-	case <-ctx.Request.Context().Done():
-		// Request was cancelled or connection was closed
-		// Just return without error as the client is no longer waiting for the response
+	if len(srcData) > maxImageSize {
+		ctx.Error(fmt.Sprintf("Image Optimizer failed: The image exceeds maximum limit of %s", utils.FormatBytes(uint64(maxImageSize))), http.StatusBadRequest)
 		return
 	}
-
-	// We stream the fetched image directly to tmp file, so we dont need to hold it whole in memory
-	// until VIPS worker picks up the task.
-	srcImageFilename := fmt.Sprintf("/tmp/image-optimizer-src-%s.%s", uuid.New().String(), format)
-	srcImageFile, err := os.Create(srcImageFilename)
+	// libvips reads the source image directly from srcData,
+	// so it needs to stay alive until all the images are freed.
+	defer runtime.KeepAlive(srcData)
+
+	// The ETag of the optimized image is derived from the source image version and all the params,
+	// so it's the same across restarts and proxy instances.
+	// The overlay is identified by its URL in the cache key the same way as in the disk cache.
+	etag := imageETag(cacheKey, resp.Header.Get(server.HeaderETag), srcData)
+	lastModified, err := http.ParseTime(resp.Header.Get(server.HeaderLastModified))
 	if err != nil {
-		ctx.Error(fmt.Sprintf("Image Optimizer failed: Failed to create temporary srcImageFile: %v", err), server.StatusInternalError)
-		return
+		lastModified = time.Now()
 	}
-	// Always remove the tmp file after we are done
-	defer os.Remove(srcImageFilename)
+	lastModified = lastModified.UTC().Truncate(time.Second)
 
-	// Run VIPS thread shutdown when we are done or if we get an error
-	defer vips.ThreadShutdown()
-	defer vips.MallocTrim()
+	ctx.Response.Headers.Set(server.HeaderETag, etag)
+	ctx.Response.Headers.Set(server.HeaderLastModified, lastModified.Format(http.TimeFormat))
+	ctx.Response.Headers.Set(server.HeaderCacheControl, cacheControl)
+	if format == autoFormat {
+		ctx.Response.Headers.Add(server.HeaderVary, server.HeaderAccept)
+	}
 
-	// Stream the image to the tmp file
-	if _, err := io.Copy(srcImageFile, limitedReader); err != nil {
-		ctx.Error(fmt.Sprintf("Image Optimizer failed: Failed to stream image: %v", err), server.StatusInternalError)
+	// The client already has this version of the optimized image
+	if ctx.Request.IsNotModified(etag, lastModified) {
+		ctx.Response.Status = http.StatusNotModified
 		return
 	}
-	srcImageFile.Close()
 
-	// Stream the image data directly to libvips tmp file
-	// instead of loading it whole into memory.
-	srcImage, err := vips.LoadImageFromFile(srcImageFilename)
+	// Detect the format of the source image from its magic bytes.
+	// Load all frames of animated GIF/WebP images if the output format can be animated,
+	// or just the requested frame, e.g. the first frame as the poster image.
+	var srcImage *vips.VipsImage
+	animatedLoader := vips.IsAnimatedLoader(vips.GetImageBufferLoader(srcData))
+	allFrames := animatedLoader && frameInt < 0 && (format == autoFormat || animatedOutputFormats[format])
+
+	// Reject the decompression bombs that declare enormous dimensions
+	// before their pixels are decoded. The info doesn't decode the pixels at all.
+	if !info {
+		header, err := vips.GetImageHeaderFromBuffer(srcData)
+		if err != nil {
+			ctx.Error(fmt.Sprintf("Image Optimizer failed: Failed to load image: %v", err), http.StatusBadRequest)
+			return
+		}
+		pixels := header.Pixels()
+		if allFrames {
+			pixels *= int64(header.Pages)
+		}
+		if pixels > m.maxPixels {
+			ctx.Error(fmt.Sprintf("Image Optimizer failed: The image dimensions %dx%d (%d frames) exceed maximum limit of %d pixels", header.Width, header.Height, header.Pages, m.maxPixels), http.StatusBadRequest)
+			return
+		}
+	}
+
+	switch {
+	case animatedLoader && frameInt >= 0:
+		srcImage, err = vips.LoadImageFromBufferWithPages(srcData, frameInt, 1)
+	case allFrames:
+		srcImage, err = vips.LoadImageFromBufferWithPages(srcData, 0, -1)
+	case frameInt > 0:
+		ctx.Error("Image Optimizer failed: Frame is out of range, the image is not animated", http.StatusBadRequest)
+		return
+	default:
+		srcImage, err = vips.LoadImageFromBuffer(srcData)
+	}
 	if err != nil {
 		ctx.Error(fmt.Sprintf("Image Optimizer failed: Failed to load image: %v", err), http.StatusBadRequest)
 		return
@@ -387,9 +1215,75 @@ func (m *ImageOptimizerMiddleware) OnRequest(ctx *server.RequestContext, next fu
 	// If we don't free the image, it will stay in memory forever and cause memory leaks.
 	defer srcImage.Free()
 
-	// Get source image dimensions
+	// Stop the processing if it takes too long.
+	// The watchdog is stopped before the source image is freed.
+	watchdog := startImageProcessWatchdog(srcImage, m.processTimeout)
+	defer watchdog.Stop()
+
+	// Return just the metadata of the source image before it's rotated or converted
+	if info {
+		infoJSON, err := buildImageInfo(srcImage, parsedURL.String(), resp.Header.Get(server.HeaderContentType), srcData)
+		if err != nil {
+			ctx.Error(fmt.Sprintf("Image Optimizer failed: Failed to get image info: %v", err), server.StatusInternalError)
+			return
+		}
+
+		ctx.Response.Headers.Set(server.HeaderContentType, server.ContentTypeJSON)
+		ctx.Response.Status = http.StatusOK
+		ctx.Debug("io-enabled=" + strconv.FormatBool(enabled))
+		ctx.Debug("io-url=" + urlStr)
+		ctx.Debug("io-info=true")
+		ctx.Debug("io-fetch-duration=" + strconv.FormatInt(fetchDuration.Milliseconds(), 10))
+		ctx.Debug("io-duration=" + strconv.FormatInt(time.Since(startTime).Milliseconds(), 10))
+		if m.cache != nil {
+			ctx.Debug("io-cache=MISS")
+		}
+		ctx.Response.EnableStreaming()
+
+		m.serveOutput(ctx, infoJSON, imageCacheEntry{
+			Key:                cacheKey,
+			ContentType:        server.ContentTypeJSON,
+			CacheControl:       cacheControl,
+			ETag:               etag,
+			LastModified:       lastModified,
+			SourceETag:         resp.Header.Get(server.HeaderETag),
+			SourceLastModified: resp.Header.Get(server.HeaderLastModified),
+			FreshUntil:         imageSourceFreshUntil(resp.Header),
+		})
+		return
+	}
+
+	// Rotate the image based on the EXIF orientation before resizing,
+	// so photos taken by phones are not displayed sideways.
+	rotatedImage, err := vips.AutoRotateImage(srcImage)
+	if err != nil {
+		m.processError(ctx, watchdog, "Failed to rotate image", err)
+		return
+	}
+	defer rotatedImage.Free()
+	srcImage = rotatedImage
+
+	// Convert the colors to sRGB, so the image looks the same in all browsers
+	// even if the ICC profile is stripped from the output image.
+	if vips.ImageHasIccProfile(srcImage) {
+		srgbImage, err := vips.TransformImageToSrgb(srcImage)
+		if err != nil {
+			m.processError(ctx, watchdog, "Failed to transform image to sRGB", err)
+			return
+		}
+		defer srgbImage.Free()
+		srcImage = srgbImage
+	}
+
+	// Get source image dimensions.
+	// The frames of animated images are stacked vertically, so the height is the height of single frame.
+	pages := vips.GetImagePages(srcImage)
 	srcWidth := vips.GetImageWidth(srcImage)
-	srcHeight := vips.GetImageHeight(srcImage)
+	srcHeight := vips.GetImagePageHeight(srcImage)
+	// The image is rotated before resizing, so the requested width and height are the dimensions of the final image.
+	if effects.rotate == 90 || effects.rotate == 270 {
+		srcWidth, srcHeight = srcHeight, srcWidth
+	}
 	srcFormat := resp.Header.Get(server.HeaderContentType)
 	srcFormat = strings.ToLower(srcFormat)
 
@@ -404,62 +1298,48 @@ func (m *ImageOptimizerMiddleware) OnRequest(ctx *server.RequestContext, next fu
 		return
 	}
 
-	aspectRatio := float64(srcWidth) / float64(srcHeight)
-
-	// Start with the target dimensions set to provided width and height
-	targetWidth := widthInt
-	targetHeight := heightInt
-
-	// Make sure target dimensions are smaller or equal to source dimensions
-	if targetWidth > srcWidth {
-		targetWidth = srcWidth
-	}
-	if targetHeight > srcHeight {
-		targetHeight = srcHeight
+	// Pick the best output format supported by the client.
+	// The response differs based on the Accept header, so CDN needs to cache it separately.
+	// The animated images need format that supports animation.
+	if format == autoFormat && pages > 1 {
+		format = negotiateAnimatedOutputFormat(ctx.Request.Headers.Get(server.HeaderAccept))
+	} else if format == autoFormat {
+		format = negotiateOutputFormat(ctx.Request.Headers.Get(server.HeaderAccept), vips.ImageHasAlpha(srcImage))
 	}
 
-	// Calculate missing dimensions while preserving aspect ratio
-	// if any of the target dimensions are not provided
-	if targetWidth == 0 && targetHeight == 0 {
-		targetWidth = srcWidth
-		targetHeight = srcHeight
-	} else if targetWidth == 0 {
-		targetWidth = int(float64(targetHeight) * aspectRatio)
-	} else if targetHeight == 0 {
-		targetHeight = int(float64(targetWidth) * aspectRatio)
-	}
-
-	// If source is larger than max allowed dimension,
-	// set target dimensions to max allowed dimension
-	// while preserving aspect ratio
-	if targetHeight > maxDimension || targetWidth > maxDimension {
-		if targetWidth > targetHeight {
-			// Width is larger, limit it to maxDimension
-			targetWidth = maxDimension
-			targetHeight = int(float64(maxDimension) / aspectRatio)
-		} else {
-			// Height is larger, limit it to maxDimension
-			targetHeight = maxDimension
-			targetWidth = int(float64(maxDimension) * aspectRatio)
-		}
-	}
+	// Calculate the dimensions of the resized image and the area to crop or embed
+	plan := planImageResize(srcWidth, srcHeight, widthInt, heightInt, fit, focalPoint)
 
-	// Call resize if target dimensions are different from source
-	if targetWidth != srcWidth || targetHeight != srcHeight {
-		// Calculate scale factor for resize
-		scale := float64(targetWidth) / float64(srcWidth)
-		resizedImage, err := vips.ResizeImage(srcImage, scale)
+	// Rotate and flip the image, resize it, crop it and apply the filters such as blur or grayscale.
+	// The animated images are processed frame by frame, so the frame delays and loop count are preserved.
+	operations := effects.transforms()
+	operations = append(operations, resizeOperations(plan, srcWidth, srcHeight, smartCrop)...)
+	operations = append(operations, effects.filters()...)
+	if overlay != nil {
+		overlayImage, err := prepareOverlayImage(overlayData, overlay, plan.width, plan.height, m.maxPixels)
 		if err != nil {
-			ctx.Error(fmt.Sprintf("Failed to resize image: %v", err), server.StatusInternalError)
+			ctx.Error(fmt.Sprintf("Image Optimizer failed: Failed to load overlay: %v", err), http.StatusBadRequest)
 			return
 		}
-		defer resizedImage.Free()
-		srcImage = resizedImage
+		defer overlayImage.Free()
+		operations = append(operations, overlay.operation(overlayImage))
+	}
+	outImage, err := applyImageFrameOperations(srcImage, pages, operations)
+	if err != nil {
+		m.processError(ctx, watchdog, "Failed to process image", err)
+		return
+	}
+	if outImage != srcImage {
+		defer outImage.Free()
+		srcImage = outImage
 	}
 
 	// Export image to the specified format
-	ctx.Response.Headers.Set(server.HeaderContentType, "image/"+format)
-	ctx.Response.Headers.Set(server.HeaderCacheControl, cacheControl)
+	contentType := "image/" + format
+	if placeholder != "" {
+		contentType = server.ContentTypeJSON
+	}
+	ctx.Response.Headers.Set(server.HeaderContentType, contentType)
 	ctx.Response.Status = http.StatusOK
 
 	// Store debug information about the image optimization
@@ -467,35 +1347,500 @@ func (m *ImageOptimizerMiddleware) OnRequest(ctx *server.RequestContext, next fu
 	ctx.Debug("io-url=" + urlStr)
 	ctx.Debug("io-src-format=" + srcFormat)
 	ctx.Debug("io-format=" + format)
+	if placeholder != "" {
+		ctx.Debug("io-placeholder=" + placeholder)
+	}
 	ctx.Debug("io-src-width=" + strconv.Itoa(srcWidth))
-	ctx.Debug("io-width=" + strconv.Itoa(targetWidth))
+	ctx.Debug("io-width=" + strconv.Itoa(plan.width))
 	ctx.Debug("io-src-height=" + strconv.Itoa(srcHeight))
-	ctx.Debug("io-height=" + strconv.Itoa(targetHeight))
+	ctx.Debug("io-height=" + strconv.Itoa(plan.height))
+	if pages > 1 {
+		ctx.Debug("io-frames=" + strconv.Itoa(pages))
+	}
+	ctx.Debug("io-fit=" + plan.fit)
 	ctx.Debug("io-quality=" + strconv.Itoa(qualityInt))
+	ctx.Debug("io-metadata=" + metadata)
+	ctx.Debug("io-dpr=" + strconv.FormatFloat(dprFloat, 'f', -1, 64))
+	if effectsStr := effects.String(); effectsStr != "" {
+		ctx.Debug("io-effects=" + effectsStr)
+	}
+	if overlay != nil {
+		ctx.Debug("io-overlay=" + overlay.url.String())
+	}
 	ctx.Debug("io-fetch-duration=" + strconv.FormatInt(fetchDuration.Milliseconds(), 10))
 	ctx.Debug("io-duration=" + strconv.FormatInt(time.Since(startTime).Milliseconds(), 10))
+	if m.cache != nil {
+		ctx.Debug("io-cache=MISS")
+	}
 
 	// Enable streaming for the response
 	ctx.Response.EnableStreaming()
 
-	outImageFilename := fmt.Sprintf("/tmp/image-optimizer-out-%s.%s", uuid.New().String(), format)
-	err = vips.SaveImageToFile(srcImage, outImageFilename, qualityInt)
+	// Encode the output image into memory
+	var outData []byte
+	if placeholder != "" {
+		// The placeholder JSON goes through the same cache as the optimized images
+		outData, err = buildImagePlaceholder(srcImage, placeholder, qualityInt, srcWidth, srcHeight)
+	} else {
+		outData, err = vips.SaveImageToBuffer(srcImage, format, qualityInt, keepMetadata)
+	}
 	if err != nil {
-		ctx.Error(fmt.Sprintf("Failed to save image: %v", err), server.StatusInternalError)
+		m.processError(ctx, watchdog, "Failed to save image", err)
 		return
 	}
 
-	// Start streaming the image from tmp file to client
-	outImageFile, err := os.Open(outImageFilename)
+	m.serveOutput(ctx, outData, imageCacheEntry{
+		Key:                cacheKey,
+		ContentType:        contentType,
+		CacheControl:       cacheControl,
+		ETag:               etag,
+		LastModified:       lastModified,
+		SourceETag:         resp.Header.Get(server.HeaderETag),
+		SourceLastModified: resp.Header.Get(server.HeaderLastModified),
+		FreshUntil:         imageSourceFreshUntil(resp.Header),
+	})
+
+	runtime.GC()
+}
+
+// processError responds with the error returned while processing the source image.
+// The truncated or corrupt images are the client errors,
+// the processing that took too long is stopped by the watchdog.
+func (m *ImageOptimizerMiddleware) processError(ctx *server.RequestContext, watchdog *imageProcessWatchdog, message string, err error) {
+	switch {
+	case watchdog.Expired():
+		ctx.Error(fmt.Sprintf("Image Optimizer failed: The image processing exceeded timeout of %s", m.processTimeout.String()), http.StatusServiceUnavailable)
+	case vips.IsDecodeError(err):
+		ctx.Error(fmt.Sprintf("Image Optimizer failed: The image is truncated or corrupt: %v", err), http.StatusBadRequest)
+	default:
+		ctx.Error(fmt.Sprintf("Image Optimizer failed: %s: %v", message, err), server.StatusInternalError)
+	}
+}
+
+// serveOutput stores the output in the cache for the next requests
+// and writes it to the client.
+func (m *ImageOptimizerMiddleware) serveOutput(ctx *server.RequestContext, data []byte, entry imageCacheEntry) {
+	if m.cache != nil {
+		if err := m.cache.Set(entry, data); err != nil {
+			logger.Warn("Image Optimizer - Failed to store image in the cache: %v", err)
+		}
+	}
+	ctx.Response.Write(data)
+}
+
+// serveCachedImage serves the optimized image from the cache
+// or returns 304 Not Modified if the client already has it.
+// Returns false if the cached image couldn't be opened.
+func (m *ImageOptimizerMiddleware) serveCachedImage(ctx *server.RequestContext, entry imageCacheEntry, negotiated bool, cacheStatus string) bool {
+	var file *os.File
+	notModified := ctx.Request.IsNotModified(entry.ETag, entry.LastModified)
+	if !notModified {
+		var err error
+		if file, err = m.cache.Open(entry); err != nil {
+			logger.Warn("Image Optimizer - Failed to open cached image: %v", err)
+			return false
+		}
+		defer file.Close()
+	}
+
+	ctx.Response.Headers.Set(server.HeaderContentType, entry.ContentType)
+	ctx.Response.Headers.Set(server.HeaderCacheControl, entry.CacheControl)
+	ctx.Response.Headers.Set(server.HeaderETag, entry.ETag)
+	ctx.Response.Headers.Set(server.HeaderLastModified, entry.LastModified.UTC().Format(http.TimeFormat))
+	if negotiated {
+		ctx.Response.Headers.Add(server.HeaderVary, server.HeaderAccept)
+	}
+	ctx.Debug("io-cache=" + cacheStatus)
+
+	if notModified {
+		ctx.Response.Status = http.StatusNotModified
+		return true
+	}
+
+	ctx.Response.Status = http.StatusOK
+	ctx.Response.EnableStreaming()
+	io.Copy(ctx.Response, file)
+	return true
+}
+
+// handleSrcset returns the srcset attribute value and the list of image URLs
+// for the image in the url query param.
+// The returned URLs are signed with the given secret if it's not empty.
+func (m *ImageOptimizerMiddleware) handleSrcset(ctx *server.RequestContext, signingSecret string) {
+	if ctx.Request.Method != "GET" && ctx.Request.Method != "HEAD" {
+		ctx.Error("Image Optimizer failed: Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := ctx.Request.Query
+	if GetQueryParam(query, "url", "", "") == "" {
+		ctx.Error("Image Optimizer failed: URL parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	width, err := strconv.Atoi(GetQueryParam(query, "width", "w", strconv.Itoa(defaultWidth)))
+	if err != nil || width < 0 {
+		ctx.Error("Image Optimizer failed: Width must be a positive number", http.StatusBadRequest)
+		return
+	}
+
+	widths := defaultSrcsetWidths
+	if value := GetQueryParam(query, "widths", "", ""); value != "" {
+		widths = nil
+		for _, item := range strings.Split(value, ",") {
+			itemInt, err := strconv.Atoi(strings.TrimSpace(item))
+			if err != nil || itemInt <= 0 {
+				ctx.Error("Image Optimizer failed: Widths must be a comma separated list of positive numbers", http.StatusBadRequest)
+				return
+			}
+			widths = append(widths, itemInt)
+		}
+	}
+
+	dprs := defaultSrcsetDprs
+	if value := GetQueryParam(query, "dprs", "", ""); value != "" {
+		dprs = nil
+		for _, item := range strings.Split(value, ",") {
+			itemFloat, err := strconv.ParseFloat(strings.TrimSpace(item), 64)
+			if err != nil || itemFloat < 1 || itemFloat > maxDpr {
+				ctx.Error(fmt.Sprintf("Image Optimizer failed: DPRs must be a comma separated list of numbers between 1 and %d", maxDpr), http.StatusBadRequest)
+				return
+			}
+			dprs = append(dprs, itemFloat)
+		}
+	}
+
+	// Pass through all other params to the image URLs
+	imageQuery := url.Values{}
+	for key, values := range query {
+		switch key {
+		case "width", "w", "widths", "dpr", "dprs", imageSignatureParam:
+			continue
+		}
+		imageQuery[key] = values
+	}
+
+	sources := buildSrcsetSources(imageQuery, width, widths, dprs)
+	descriptors := make([]string, 0, len(sources))
+	for i, source := range sources {
+		if signingSecret != "" {
+			signedURL, err := SignImageURL(signingSecret, source.URL)
+			if err != nil {
+				ctx.Error(fmt.Sprintf("Image Optimizer failed: Failed to sign srcset URL: %v", err), server.StatusInternalError)
+				return
+			}
+			sources[i].URL = signedURL
+			source.URL = signedURL
+		}
+		descriptors = append(descriptors, source.URL+" "+source.Descriptor)
+	}
+
+	jsonData, err := json.Marshal(ImageSrcsetResponse{
+		Srcset:  strings.Join(descriptors, ", "),
+		Sources: sources,
+	})
 	if err != nil {
-		ctx.Error(fmt.Sprintf("Failed to open image: %v", err), server.StatusInternalError)
+		ctx.Error(fmt.Sprintf("Image Optimizer failed: Failed to marshal srcset: %v", err), server.StatusInternalError)
 		return
 	}
-	defer outImageFile.Close()
-	defer os.Remove(outImageFilename)
-	io.Copy(ctx.Response, outImageFile)
 
-	runtime.GC()
+	ctx.Response.Headers.Set(server.HeaderContentType, server.ContentTypeJSON)
+	ctx.Response.Headers.Set(server.HeaderCacheControl, defaultCacheControl)
+	ctx.Response.Status = http.StatusOK
+	ctx.Response.Body = jsonData
+}
+
+// buildSrcsetSources returns the image URLs with width descriptors for each breakpoint width,
+// or with density descriptors for each device pixel ratio if the image has a fixed width.
+// Widths are capped at maxDimension and duplicates are skipped,
+// because the Image Optimizer would return the same image for them.
+func buildSrcsetSources(query url.Values, width int, widths []int, dprs []float64) []ImageSrcsetSource {
+	sources := []ImageSrcsetSource{}
+	seenWidths := map[int]bool{}
+	imagePath := constants.InternalPathPrefix + "/image"
+
+	if width > 0 {
+		for _, dpr := range dprs {
+			dprWidth := min(int(math.Round(float64(width)*dpr)), maxDimension)
+			if seenWidths[dprWidth] {
+				continue
+			}
+			seenWidths[dprWidth] = true
+
+			imageQuery := cloneQuery(query)
+			imageQuery.Set("w", strconv.Itoa(width))
+			if dpr != 1 {
+				imageQuery.Set("dpr", strconv.FormatFloat(dpr, 'f', -1, 64))
+			}
+			sources = append(sources, ImageSrcsetSource{
+				URL:        imagePath + "?" + imageQuery.Encode(),
+				Width:      dprWidth,
+				Dpr:        dpr,
+				Descriptor: strconv.FormatFloat(dpr, 'f', -1, 64) + "x",
+			})
+		}
+		return sources
+	}
+
+	sortedWidths := slices.Clone(widths)
+	slices.Sort(sortedWidths)
+	for _, width := range sortedWidths {
+		width = min(width, maxDimension)
+		if seenWidths[width] {
+			continue
+		}
+		seenWidths[width] = true
+
+		imageQuery := cloneQuery(query)
+		imageQuery.Set("w", strconv.Itoa(width))
+		sources = append(sources, ImageSrcsetSource{
+			URL:        imagePath + "?" + imageQuery.Encode(),
+			Width:      width,
+			Dpr:        1,
+			Descriptor: strconv.Itoa(width) + "w",
+		})
+	}
+	return sources
+}
+
+// cloneQuery returns a copy of the query params that can be modified.
+func cloneQuery(query url.Values) url.Values {
+	clone := make(url.Values, len(query))
+	for key, values := range query {
+		clone[key] = slices.Clone(values)
+	}
+	return clone
+}
+
+// negotiateOutputFormat returns the best output format supported by the client
+// based on the Accept header and whether the image has transparency.
+// e.g: image/avif,image/webp,image/apng,image/svg+xml,image/*,*/*;q=0.8 => avif
+func negotiateOutputFormat(accept string, hasAlpha bool) string {
+	accept = strings.ToLower(accept)
+	if strings.Contains(accept, "image/avif") {
+		return "avif"
+	}
+	if strings.Contains(accept, "image/webp") {
+		return "webp"
+	}
+	// Only PNG preserves the transparency from the widely supported formats
+	if hasAlpha {
+		return "png"
+	}
+	return "jpeg"
+}
+
+// negotiateAnimatedOutputFormat returns the best output format for animated images supported by the client.
+// The WebP animations are way smaller than GIFs, but older clients support just GIF.
+func negotiateAnimatedOutputFormat(accept string) string {
+	if strings.Contains(strings.ToLower(accept), "image/webp") {
+		return "webp"
+	}
+	return "gif"
+}
+
+// imageResizePlan describes how the source image is transformed to the output image.
+// The image is first resized to resizeWidth x resizeHeight and then cropped (cover)
+// or embedded (contain) to width x height at the left and top offset.
+type imageResizePlan struct {
+	fit          string
+	resizeWidth  int
+	resizeHeight int
+	width        int
+	height       int
+	left         int
+	top          int
+}
+
+// resizeOperations returns the operations that resize the image
+// and crop or embed it according to the plan.
+func resizeOperations(plan imageResizePlan, srcWidth, srcHeight int, smartCrop int) []imageOperation {
+	operations := []imageOperation{}
+
+	// Resize the image if the dimensions are different from source.
+	// The aspect ratio is already preserved by the plan, so we can force the exact dimensions.
+	if plan.resizeWidth != srcWidth || plan.resizeHeight != srcHeight {
+		operations = append(operations, imageOperation{
+			name: "resize",
+			apply: func(img *vips.VipsImage) (*vips.VipsImage, error) {
+				return vips.ThumbnailImage(img, plan.resizeWidth, plan.resizeHeight, vips.VIPS_SIZE_FORCE)
+			},
+		})
+	}
+
+	// Crop the overflowing part of the resized image for the "cover" fit
+	// or add the borders around it for the "contain" fit.
+	if plan.width != plan.resizeWidth || plan.height != plan.resizeHeight {
+		operations = append(operations, imageOperation{
+			name: "crop",
+			apply: func(img *vips.VipsImage) (*vips.VipsImage, error) {
+				switch {
+				case plan.fit == fitContain:
+					return vips.EmbedImage(img, plan.left, plan.top, plan.width, plan.height, vips.VIPS_EXTEND_BLACK)
+				case smartCrop != vips.VIPS_INTERESTING_NONE:
+					return vips.SmartCropImage(img, plan.width, plan.height, smartCrop)
+				default:
+					return vips.CropImage(img, plan.left, plan.top, plan.width, plan.height)
+				}
+			},
+		})
+	}
+
+	return operations
+}
+
+// planImageResize calculates the resize plan for the source image and requested dimensions.
+// The fit mode is applied only when both width and height are provided,
+// otherwise the missing dimension is calculated from the aspect ratio.
+// The image is never upscaled and the output never exceeds maxDimension.
+func planImageResize(srcWidth, srcHeight, width, height int, fit string, focalPoint imageFocalPoint) imageResizePlan {
+	if width == 0 || height == 0 {
+		return planImageResizeInside(srcWidth, srcHeight, width, height)
+	}
+
+	// Scale down the requested dimensions to fit into the max allowed dimension
+	// while preserving the requested aspect ratio.
+	if width > maxDimension || height > maxDimension {
+		limit := float64(maxDimension) / float64(max(width, height))
+		width = max(1, int(math.Round(float64(width)*limit)))
+		height = max(1, int(math.Round(float64(height)*limit)))
+	}
+
+	scaleX := float64(width) / float64(srcWidth)
+	scaleY := float64(height) / float64(srcHeight)
+
+	switch fit {
+	case fitFill:
+		width = min(width, srcWidth)
+		height = min(height, srcHeight)
+		return imageResizePlan{fit: fit, resizeWidth: width, resizeHeight: height, width: width, height: height}
+
+	case fitInside, fitOutside:
+		scale := min(scaleX, scaleY)
+		if fit == fitOutside {
+			scale = max(scaleX, scaleY)
+		}
+		// The "outside" fit can exceed the max allowed dimension on the other side
+		scale = min(scale, 1, float64(maxDimension)/float64(max(srcWidth, srcHeight)))
+		resizeWidth, resizeHeight := scaleDimensions(srcWidth, srcHeight, scale)
+		return imageResizePlan{fit: fit, resizeWidth: resizeWidth, resizeHeight: resizeHeight, width: resizeWidth, height: resizeHeight}
+
+	case fitContain:
+		scale := min(scaleX, scaleY)
+		// Shrink the canvas instead of upscaling the image
+		if scale > 1 {
+			width = max(1, int(math.Round(float64(width)/scale)))
+			height = max(1, int(math.Round(float64(height)/scale)))
+			scale = 1
+		}
+		resizeWidth, resizeHeight := scaleDimensions(srcWidth, srcHeight, scale)
+		width = max(width, resizeWidth)
+		height = max(height, resizeHeight)
+		return imageResizePlan{
+			fit:          fit,
+			resizeWidth:  resizeWidth,
+			resizeHeight: resizeHeight,
+			width:        width,
+			height:       height,
+			left:         int(math.Round(float64(width-resizeWidth) * focalPoint.x)),
+			top:          int(math.Round(float64(height-resizeHeight) * focalPoint.y)),
+		}
+
+	default:
+		scale := max(scaleX, scaleY)
+		// Shrink the crop area instead of upscaling the image
+		if scale > 1 {
+			width = max(1, int(math.Round(float64(width)/scale)))
+			height = max(1, int(math.Round(float64(height)/scale)))
+			scale = 1
+		}
+		resizeWidth, resizeHeight := scaleDimensions(srcWidth, srcHeight, scale)
+		width = min(width, resizeWidth)
+		height = min(height, resizeHeight)
+		// Center the crop area on the focal point and keep it within the image
+		left := int(math.Round(float64(resizeWidth)*focalPoint.x - float64(width)/2))
+		top := int(math.Round(float64(resizeHeight)*focalPoint.y - float64(height)/2))
+		return imageResizePlan{
+			fit:          fitCover,
+			resizeWidth:  resizeWidth,
+			resizeHeight: resizeHeight,
+			width:        width,
+			height:       height,
+			left:         min(max(left, 0), resizeWidth-width),
+			top:          min(max(top, 0), resizeHeight-height),
+		}
+	}
+}
+
+// planImageResizeInside calculates the resize plan when at most one dimension is provided.
+// The missing dimension is calculated while preserving the aspect ratio.
+func planImageResizeInside(srcWidth, srcHeight, width, height int) imageResizePlan {
+	aspectRatio := float64(srcWidth) / float64(srcHeight)
+
+	// Make sure target dimensions are smaller or equal to source dimensions
+	width = min(width, srcWidth)
+	height = min(height, srcHeight)
+
+	// Calculate missing dimensions while preserving aspect ratio
+	if width == 0 && height == 0 {
+		width = srcWidth
+		height = srcHeight
+	} else if width == 0 {
+		width = max(1, int(math.Round(float64(height)*aspectRatio)))
+	} else if height == 0 {
+		height = max(1, int(math.Round(float64(width)/aspectRatio)))
+	}
+
+	// If target is larger than max allowed dimension,
+	// set target dimensions to max allowed dimension
+	// while preserving aspect ratio
+	if width > maxDimension || height > maxDimension {
+		if width > height {
+			width = maxDimension
+			height = max(1, int(math.Round(float64(maxDimension)/aspectRatio)))
+		} else {
+			height = maxDimension
+			width = max(1, int(math.Round(float64(maxDimension)*aspectRatio)))
+		}
+	}
+
+	return imageResizePlan{fit: fitInside, resizeWidth: width, resizeHeight: height, width: width, height: height}
+}
+
+// scaleDimensions returns the dimensions scaled by the given factor, at least 1x1 pixel.
+func scaleDimensions(width, height int, scale float64) (int, int) {
+	return max(1, int(math.Round(float64(width)*scale))), max(1, int(math.Round(float64(height)*scale)))
+}
+
+// parseFocalPoint parses the focal point coordinates from the fp-x and fp-y query params.
+// The missing coordinate defaults to the center of the image.
+func parseFocalPoint(x, y string) (imageFocalPoint, error) {
+	focalPoint := imageFocalPoint{0.5, 0.5}
+	for _, coord := range []struct {
+		name  string
+		value string
+		dest  *float64
+	}{{"fp-x", x, &focalPoint.x}, {"fp-y", y, &focalPoint.y}} {
+		if coord.value == "" {
+			continue
+		}
+		value, err := strconv.ParseFloat(coord.value, 64)
+		if err != nil || value < 0 || value > 1 {
+			return focalPoint, fmt.Errorf("Focal point %s must be a number between 0 and 1", coord.name)
+		}
+		*coord.dest = value
+	}
+	return focalPoint, nil
+}
+
+// sortedKeys returns the keys of the map in alphabetical order.
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
 }
 
 func GetQueryParam(query map[string][]string, param1, param2, defaultValue string) string {
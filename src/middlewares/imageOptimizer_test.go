@@ -1,14 +1,20 @@
 package middlewares
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"ownstak-proxy/src/constants"
 	"ownstak-proxy/src/server"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/jarcoal/httpmock"
 
@@ -217,6 +223,71 @@ func TestImageOptimizerMiddleware(t *testing.T) {
 			assert.Contains(t, ctx.Response.Headers.Get(server.HeaderXOwnProxyDebug), "io-format=jpeg")
 		})
 
+		t.Run("should work with png format", func(t *testing.T) {
+			// Create test request
+			req := httptest.NewRequest("GET", "/__ownstak__/image?url=/image.webp&f=png", nil)
+			req.Header.Set(server.HeaderXOwnDebug, "true")
+			res := httptest.NewRecorder()
+
+			// Create request context
+			serverReq, err := server.NewRequest(req)
+			require.NoError(t, err)
+			serverRes := server.NewResponse(res)
+			ctx := server.NewRequestContext(serverReq, serverRes, nil)
+
+			// Create and run middleware
+			middleware.OnRequest(ctx, func() {})
+
+			// Verify response
+			assert.Equal(t, http.StatusOK, ctx.Response.Status)
+			assert.Equal(t, "image/png", ctx.Response.Headers.Get("Content-Type"))
+			assert.Contains(t, ctx.Response.Headers.Get(server.HeaderXOwnProxyDebug), "io-format=png")
+		})
+
+		t.Run("should work with avif format", func(t *testing.T) {
+			// Create test request
+			req := httptest.NewRequest("GET", "/__ownstak__/image?url=/image.webp&f=avif", nil)
+			req.Header.Set(server.HeaderXOwnDebug, "true")
+			res := httptest.NewRecorder()
+
+			// Create request context
+			serverReq, err := server.NewRequest(req)
+			require.NoError(t, err)
+			serverRes := server.NewResponse(res)
+			ctx := server.NewRequestContext(serverReq, serverRes, nil)
+
+			// Create and run middleware
+			middleware.OnRequest(ctx, func() {})
+
+			// Verify response
+			assert.Equal(t, http.StatusOK, ctx.Response.Status)
+			assert.Equal(t, "image/avif", ctx.Response.Headers.Get("Content-Type"))
+			assert.Contains(t, ctx.Response.Headers.Get(server.HeaderXOwnProxyDebug), "io-format=avif")
+		})
+
+		t.Run("should negotiate output format with auto format", func(t *testing.T) {
+			// Create test request
+			req := httptest.NewRequest("GET", "/__ownstak__/image?url=/image.webp&f=auto", nil)
+			req.Header.Set(server.HeaderXOwnDebug, "true")
+			req.Header.Set(server.HeaderAccept, "image/avif,image/webp,image/*,*/*;q=0.8")
+			res := httptest.NewRecorder()
+
+			// Create request context
+			serverReq, err := server.NewRequest(req)
+			require.NoError(t, err)
+			serverRes := server.NewResponse(res)
+			ctx := server.NewRequestContext(serverReq, serverRes, nil)
+
+			// Create and run middleware
+			middleware.OnRequest(ctx, func() {})
+
+			// Verify response
+			assert.Equal(t, http.StatusOK, ctx.Response.Status)
+			assert.Equal(t, "image/avif", ctx.Response.Headers.Get("Content-Type"))
+			assert.Equal(t, server.HeaderAccept, ctx.Response.Headers.Get(server.HeaderVary))
+			assert.Contains(t, ctx.Response.Headers.Get(server.HeaderXOwnProxyDebug), "io-format=avif")
+		})
+
 		t.Run("should work with f parameter (alias for format)", func(t *testing.T) {
 			// Create test request
 			req := httptest.NewRequest("GET", "/__ownstak__/image?url=/image.webp&f=jpeg", nil)
@@ -233,14 +304,666 @@ func TestImageOptimizerMiddleware(t *testing.T) {
 			middleware.OnRequest(ctx, func() {})
 
 			// Verify response
-			assert.Equal(t, http.StatusOK, ctx.Response.Status)
-			assert.Equal(t, "image/jpeg", ctx.Response.Headers.Get("Content-Type"))
-			assert.Contains(t, ctx.Response.Headers.Get(server.HeaderXOwnProxyDebug), "io-format=jpeg")
+			assert.Equal(t, http.StatusOK, ctx.Response.Status)
+			assert.Equal(t, "image/jpeg", ctx.Response.Headers.Get("Content-Type"))
+			assert.Contains(t, ctx.Response.Headers.Get(server.HeaderXOwnProxyDebug), "io-format=jpeg")
+		})
+
+		t.Run("should work with enabled parameter", func(t *testing.T) {
+			// Create test request
+			req := httptest.NewRequest("GET", "/__ownstak__/image?url=/image.webp&enabled=true", nil)
+			req.Header.Set(server.HeaderXOwnDebug, "true")
+			res := httptest.NewRecorder()
+
+			// Create request context
+			serverReq, err := server.NewRequest(req)
+			require.NoError(t, err)
+			serverRes := server.NewResponse(res)
+			ctx := server.NewRequestContext(serverReq, serverRes, nil)
+
+			// Create and run middleware
+			middleware.OnRequest(ctx, func() {})
+
+			// Verify response
+			assert.Equal(t, http.StatusOK, ctx.Response.Status)
+			assert.Equal(t, "image/webp", ctx.Response.Headers.Get("Content-Type"))
+			assert.Contains(t, ctx.Response.Headers.Get(server.HeaderXOwnProxyDebug), "io-enabled=true")
+		})
+
+		t.Run("should work with e parameter (alias for enabled)", func(t *testing.T) {
+			// Create test request
+			req := httptest.NewRequest("GET", "/__ownstak__/image?url=/image.webp&e=true", nil)
+			req.Header.Set(server.HeaderXOwnDebug, "true")
+			res := httptest.NewRecorder()
+
+			// Create request context
+			serverReq, err := server.NewRequest(req)
+			require.NoError(t, err)
+			serverRes := server.NewResponse(res)
+			ctx := server.NewRequestContext(serverReq, serverRes, nil)
+
+			// Create and run middleware
+			middleware.OnRequest(ctx, func() {})
+
+			// Verify response
+			assert.Equal(t, http.StatusOK, ctx.Response.Status)
+			assert.Equal(t, "image/webp", ctx.Response.Headers.Get("Content-Type"))
+			assert.Contains(t, ctx.Response.Headers.Get(server.HeaderXOwnProxyDebug), "io-enabled=true")
+		})
+
+		t.Run("should work with all parameters together", func(t *testing.T) {
+			// Create test request
+			req := httptest.NewRequest("GET", "/__ownstak__/image?url=/image.webp&w=100&h=150&q=80&f=jpeg&e=true", nil)
+			req.Header.Set(server.HeaderXOwnDebug, "true")
+			res := httptest.NewRecorder()
+
+			// Create request context
+			serverReq, err := server.NewRequest(req)
+			require.NoError(t, err)
+			serverRes := server.NewResponse(res)
+			ctx := server.NewRequestContext(serverReq, serverRes, nil)
+
+			// Create and run middleware
+			middleware.OnRequest(ctx, func() {})
+
+			// Verify response
+			assert.Equal(t, http.StatusOK, ctx.Response.Status)
+			assert.Equal(t, "image/jpeg", ctx.Response.Headers.Get("Content-Type"))
+			optimizerHeader := ctx.Response.Headers.Get(server.HeaderXOwnProxyDebug)
+			assert.Contains(t, optimizerHeader, "io-width=100")
+			assert.Contains(t, optimizerHeader, "io-height=150")
+			assert.Contains(t, optimizerHeader, "io-quality=80")
+			assert.Contains(t, optimizerHeader, "io-format=jpeg")
+			assert.Contains(t, optimizerHeader, "io-enabled=true")
+		})
+
+		t.Run("should validate quality range", func(t *testing.T) {
+			// Create test request with invalid quality
+			req := httptest.NewRequest("GET", "/__ownstak__/image?url=/image.webp&q=0", nil)
+			req.Header.Set(server.HeaderXOwnDebug, "true")
+			res := httptest.NewRecorder()
+
+			// Create request context
+			serverReq, err := server.NewRequest(req)
+			require.NoError(t, err)
+			serverRes := server.NewResponse(res)
+			ctx := server.NewRequestContext(serverReq, serverRes, nil)
+
+			// Create and run middleware
+			middleware.OnRequest(ctx, func() {})
+
+			// Verify response
+			assert.Equal(t, http.StatusBadRequest, ctx.Response.Status)
+			assert.Contains(t, string(ctx.Response.Body), "Quality must be a number between 1 and 100")
+		})
+
+		t.Run("should validate width range", func(t *testing.T) {
+			// Create test request with invalid width
+			req := httptest.NewRequest("GET", "/__ownstak__/image?url=/image.webp&w=-1", nil)
+			req.Header.Set(server.HeaderXOwnDebug, "true")
+			res := httptest.NewRecorder()
+
+			// Create request context
+			serverReq, err := server.NewRequest(req)
+			require.NoError(t, err)
+			serverRes := server.NewResponse(res)
+			ctx := server.NewRequestContext(serverReq, serverRes, nil)
+
+			// Create and run middleware
+			middleware.OnRequest(ctx, func() {})
+
+			// Verify response
+			assert.Equal(t, http.StatusBadRequest, ctx.Response.Status)
+			assert.Contains(t, string(ctx.Response.Body), "Width must be a positive number")
+		})
+
+		t.Run("should validate height range", func(t *testing.T) {
+			// Create test request with invalid height
+			req := httptest.NewRequest("GET", "/__ownstak__/image?url=/image.webp&h=-1", nil)
+			req.Header.Set(server.HeaderXOwnDebug, "true")
+			res := httptest.NewRecorder()
+
+			// Create request context
+			serverReq, err := server.NewRequest(req)
+			require.NoError(t, err)
+			serverRes := server.NewResponse(res)
+			ctx := server.NewRequestContext(serverReq, serverRes, nil)
+
+			// Create and run middleware
+			middleware.OnRequest(ctx, func() {})
+
+			// Verify response
+			assert.Equal(t, http.StatusBadRequest, ctx.Response.Status)
+			assert.Contains(t, string(ctx.Response.Body), "Height must be a positive number")
+		})
+
+		t.Run("should validate output format", func(t *testing.T) {
+			// Create test request with invalid format
+			req := httptest.NewRequest("GET", "/__ownstak__/image?url=/image.webp&f=bmp", nil)
+			req.Header.Set(server.HeaderXOwnDebug, "true")
+			res := httptest.NewRecorder()
+
+			// Create request context
+			serverReq, err := server.NewRequest(req)
+			require.NoError(t, err)
+			serverRes := server.NewResponse(res)
+			ctx := server.NewRequestContext(serverReq, serverRes, nil)
+
+			// Create and run middleware
+			middleware.OnRequest(ctx, func() {})
+
+			// Verify response
+			assert.Equal(t, http.StatusBadRequest, ctx.Response.Status)
+			assert.Contains(t, string(ctx.Response.Body), "Unsupported output format")
+		})
+
+		t.Run("should crop image to cover both dimensions", func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/__ownstak__/image?url=/image.webp&w=50&h=50", nil)
+			req.Header.Set(server.HeaderXOwnDebug, "true")
+			res := httptest.NewRecorder()
+
+			// Create request context
+			serverReq, err := server.NewRequest(req)
+			require.NoError(t, err)
+			serverRes := server.NewResponse(res)
+			ctx := server.NewRequestContext(serverReq, serverRes, nil)
+
+			// Create and run middleware
+			middleware.OnRequest(ctx, func() {})
+
+			// Verify response
+			assert.Equal(t, http.StatusOK, ctx.Response.Status)
+			assert.Contains(t, ctx.Response.Headers.Get(server.HeaderXOwnProxyDebug), "io-width=50")
+			assert.Contains(t, ctx.Response.Headers.Get(server.HeaderXOwnProxyDebug), "io-height=50")
+			assert.Contains(t, ctx.Response.Headers.Get(server.HeaderXOwnProxyDebug), "io-fit=cover")
+		})
+
+		t.Run("should embed image with contain fit", func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/__ownstak__/image?url=/image.webp&w=50&h=50&fit=contain&position=top", nil)
+			req.Header.Set(server.HeaderXOwnDebug, "true")
+			res := httptest.NewRecorder()
+
+			// Create request context
+			serverReq, err := server.NewRequest(req)
+			require.NoError(t, err)
+			serverRes := server.NewResponse(res)
+			ctx := server.NewRequestContext(serverReq, serverRes, nil)
+
+			// Create and run middleware
+			middleware.OnRequest(ctx, func() {})
+
+			// Verify response
+			assert.Equal(t, http.StatusOK, ctx.Response.Status)
+			assert.Contains(t, ctx.Response.Headers.Get(server.HeaderXOwnProxyDebug), "io-width=50")
+			assert.Contains(t, ctx.Response.Headers.Get(server.HeaderXOwnProxyDebug), "io-height=50")
+			assert.Contains(t, ctx.Response.Headers.Get(server.HeaderXOwnProxyDebug), "io-fit=contain")
+		})
+
+		t.Run("should crop image with smart crop", func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/__ownstak__/image?url=/image.webp&w=50&h=50&gravity=attention", nil)
+			req.Header.Set(server.HeaderXOwnDebug, "true")
+			res := httptest.NewRecorder()
+
+			// Create request context
+			serverReq, err := server.NewRequest(req)
+			require.NoError(t, err)
+			serverRes := server.NewResponse(res)
+			ctx := server.NewRequestContext(serverReq, serverRes, nil)
+
+			// Create and run middleware
+			middleware.OnRequest(ctx, func() {})
+
+			// Verify response
+			assert.Equal(t, http.StatusOK, ctx.Response.Status)
+			assert.Contains(t, ctx.Response.Headers.Get(server.HeaderXOwnProxyDebug), "io-width=50")
+			assert.Contains(t, ctx.Response.Headers.Get(server.HeaderXOwnProxyDebug), "io-height=50")
+		})
+
+		t.Run("should crop image around focal point", func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/__ownstak__/image?url=/image.webp&w=50&h=50&fp-x=0.2&fp-y=0.8", nil)
+			req.Header.Set(server.HeaderXOwnDebug, "true")
+			res := httptest.NewRecorder()
+
+			// Create request context
+			serverReq, err := server.NewRequest(req)
+			require.NoError(t, err)
+			serverRes := server.NewResponse(res)
+			ctx := server.NewRequestContext(serverReq, serverRes, nil)
+
+			// Create and run middleware
+			middleware.OnRequest(ctx, func() {})
+
+			// Verify response
+			assert.Equal(t, http.StatusOK, ctx.Response.Status)
+			assert.Contains(t, ctx.Response.Headers.Get(server.HeaderXOwnProxyDebug), "io-width=50")
+			assert.Contains(t, ctx.Response.Headers.Get(server.HeaderXOwnProxyDebug), "io-height=50")
+		})
+
+		t.Run("should multiply dimensions by dpr", func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/__ownstak__/image?url=/image.webp&w=25&h=25&dpr=2", nil)
+			req.Header.Set(server.HeaderXOwnDebug, "true")
+			res := httptest.NewRecorder()
+
+			// Create request context
+			serverReq, err := server.NewRequest(req)
+			require.NoError(t, err)
+			serverRes := server.NewResponse(res)
+			ctx := server.NewRequestContext(serverReq, serverRes, nil)
+
+			// Create and run middleware
+			middleware.OnRequest(ctx, func() {})
+
+			// Verify response
+			assert.Equal(t, http.StatusOK, ctx.Response.Status)
+			assert.Contains(t, ctx.Response.Headers.Get(server.HeaderXOwnProxyDebug), "io-width=50")
+			assert.Contains(t, ctx.Response.Headers.Get(server.HeaderXOwnProxyDebug), "io-height=50")
+			assert.Contains(t, ctx.Response.Headers.Get(server.HeaderXOwnProxyDebug), "io-dpr=2")
+		})
+
+		t.Run("should validate dpr", func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/__ownstak__/image?url=/image.webp&w=25&dpr=10", nil)
+			req.Header.Set(server.HeaderXOwnDebug, "true")
+			res := httptest.NewRecorder()
+
+			// Create request context
+			serverReq, err := server.NewRequest(req)
+			require.NoError(t, err)
+			serverRes := server.NewResponse(res)
+			ctx := server.NewRequestContext(serverReq, serverRes, nil)
+
+			// Create and run middleware
+			middleware.OnRequest(ctx, func() {})
+
+			// Verify response
+			assert.Equal(t, http.StatusBadRequest, ctx.Response.Status)
+			assert.Contains(t, string(ctx.Response.Body), "DPR must be a number between 1 and 4")
+		})
+
+		t.Run("should auto rotate image by EXIF orientation", func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/__ownstak__/image?url=/static/pexels-exif-rotated.jpg&f=jpeg", nil)
+			req.Header.Set(server.HeaderXOwnDebug, "true")
+			res := httptest.NewRecorder()
+
+			// Create request context
+			serverReq, err := server.NewRequest(req)
+			require.NoError(t, err)
+			serverRes := server.NewResponse(res)
+			ctx := server.NewRequestContext(serverReq, serverRes, nil)
+
+			// Create and run middleware
+			middleware.OnRequest(ctx, func() {})
+
+			// Verify response
+			assert.Equal(t, http.StatusOK, ctx.Response.Status)
+			assert.Contains(t, ctx.Response.Headers.Get(server.HeaderXOwnProxyDebug), "io-src-width=960")
+			assert.Contains(t, ctx.Response.Headers.Get(server.HeaderXOwnProxyDebug), "io-src-height=640")
+			assert.Contains(t, ctx.Response.Headers.Get(server.HeaderXOwnProxyDebug), "io-metadata=strip")
+		})
+
+		t.Run("should apply effects", func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/__ownstak__/image?url=/static/pexels.jpg&w=100&rotate=90&flop=true&blur=2&grayscale=true&f=jpeg", nil)
+			req.Header.Set(server.HeaderXOwnDebug, "true")
+			res := httptest.NewRecorder()
+
+			// Create request context
+			serverReq, err := server.NewRequest(req)
+			require.NoError(t, err)
+			serverRes := server.NewResponse(res)
+			ctx := server.NewRequestContext(serverReq, serverRes, nil)
+
+			// Create and run middleware
+			middleware.OnRequest(ctx, func() {})
+
+			// Verify response
+			assert.Equal(t, http.StatusOK, ctx.Response.Status)
+			assert.Contains(t, ctx.Response.Headers.Get(server.HeaderXOwnProxyDebug), "io-src-width=960")
+			assert.Contains(t, ctx.Response.Headers.Get(server.HeaderXOwnProxyDebug), "io-height=67")
+			assert.Contains(t, ctx.Response.Headers.Get(server.HeaderXOwnProxyDebug), "io-effects=rotate:90,flop,blur:2,grayscale")
+		})
+
+		t.Run("should validate effects", func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/__ownstak__/image?url=/static/pexels.jpg&rotate=45", nil)
+			req.Header.Set(server.HeaderXOwnDebug, "true")
+			res := httptest.NewRecorder()
+
+			// Create request context
+			serverReq, err := server.NewRequest(req)
+			require.NoError(t, err)
+			serverRes := server.NewResponse(res)
+			ctx := server.NewRequestContext(serverReq, serverRes, nil)
+
+			// Create and run middleware
+			middleware.OnRequest(ctx, func() {})
+
+			// Verify response
+			assert.Equal(t, http.StatusBadRequest, ctx.Response.Status)
+			assert.Contains(t, string(ctx.Response.Body), "Rotate must be one of")
+		})
+
+		t.Run("should composite overlay", func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/__ownstak__/image?url=/static/pexels.jpg&w=200&overlay=/static/pexels-100.webp&overlay-scale=0.25&overlay-opacity=0.5", nil)
+			req.Header.Set(server.HeaderXOwnDebug, "true")
+			res := httptest.NewRecorder()
+
+			// Create request context
+			serverReq, err := server.NewRequest(req)
+			require.NoError(t, err)
+			serverRes := server.NewResponse(res)
+			ctx := server.NewRequestContext(serverReq, serverRes, nil)
+
+			// Create and run middleware
+			middleware.OnRequest(ctx, func() {})
+
+			// Verify response
+			assert.Equal(t, http.StatusOK, ctx.Response.Status)
+			assert.Contains(t, ctx.Response.Headers.Get(server.HeaderXOwnProxyDebug), "io-overlay=http://example.com/static/pexels-100.webp")
+			assert.Contains(t, ctx.Response.Headers.Get(server.HeaderXOwnProxyDebug), "io-width=200")
+		})
+
+		t.Run("should validate overlay", func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/__ownstak__/image?url=/static/pexels.jpg&overlay=/static/pexels-100.webp&overlay-opacity=2", nil)
+			req.Header.Set(server.HeaderXOwnDebug, "true")
+			res := httptest.NewRecorder()
+
+			// Create request context
+			serverReq, err := server.NewRequest(req)
+			require.NoError(t, err)
+			serverRes := server.NewResponse(res)
+			ctx := server.NewRequestContext(serverReq, serverRes, nil)
+
+			// Create and run middleware
+			middleware.OnRequest(ctx, func() {})
+
+			// Verify response
+			assert.Equal(t, http.StatusBadRequest, ctx.Response.Status)
+			assert.Contains(t, string(ctx.Response.Body), "Overlay opacity must be a number between 0 and 1")
+		})
+
+		t.Run("should return error for missing overlay", func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/__ownstak__/image?url=/static/pexels.jpg&overlay=/static/missing.png", nil)
+			req.Header.Set(server.HeaderXOwnDebug, "true")
+			res := httptest.NewRecorder()
+
+			// Create request context
+			serverReq, err := server.NewRequest(req)
+			require.NoError(t, err)
+			serverRes := server.NewResponse(res)
+			ctx := server.NewRequestContext(serverReq, serverRes, nil)
+
+			// Create and run middleware
+			middleware.OnRequest(ctx, func() {})
+
+			// Verify response
+			assert.Equal(t, http.StatusBadRequest, ctx.Response.Status)
+			assert.Contains(t, string(ctx.Response.Body), "Failed to fetch overlay")
+		})
+
+		t.Run("should apply preset", func(t *testing.T) {
+			middleware.presets = map[string]ImagePresets{
+				"example.com": {Presets: map[string]ImagePreset{"broken": {"q": "500"}}},
+			}
+			defer func() { middleware.presets = map[string]ImagePresets{} }()
+
+			req := httptest.NewRequest("GET", "/__ownstak__/image?url=/image.webp&preset=broken", nil)
+			req.Header.Set(server.HeaderXOwnDebug, "true")
+			res := httptest.NewRecorder()
+
+			// Create request context
+			serverReq, err := server.NewRequest(req)
+			require.NoError(t, err)
+			serverRes := server.NewResponse(res)
+			ctx := server.NewRequestContext(serverReq, serverRes, nil)
+
+			// Create and run middleware
+			middleware.OnRequest(ctx, func() {})
+
+			// Verify response
+			assert.Equal(t, http.StatusBadRequest, ctx.Response.Status)
+			assert.Contains(t, string(ctx.Response.Body), "Quality must be a number between 1 and 100")
+		})
+
+		t.Run("should allow only presets", func(t *testing.T) {
+			middleware.presets = map[string]ImagePresets{
+				"example.com": {Presets: map[string]ImagePreset{"thumbnail": {"w": "100"}}, PresetsOnly: true},
+			}
+			defer func() { middleware.presets = map[string]ImagePresets{} }()
+
+			for _, path := range []string{"/__ownstak__/image?url=/image.webp&w=100", "/__ownstak__/image/srcset?url=/image.webp"} {
+				req := httptest.NewRequest("GET", path, nil)
+				res := httptest.NewRecorder()
+
+				// Create request context
+				serverReq, err := server.NewRequest(req)
+				require.NoError(t, err)
+				serverRes := server.NewResponse(res)
+				ctx := server.NewRequestContext(serverReq, serverRes, nil)
+
+				// Create and run middleware
+				middleware.OnRequest(ctx, func() {})
+
+				// Verify response
+				assert.Equal(t, http.StatusBadRequest, ctx.Response.Status)
+				assert.Contains(t, string(ctx.Response.Body), "Only presets are allowed for this project")
+			}
+		})
+
+		t.Run("should shed load when the queue is full", func(t *testing.T) {
+			middleware.queueTimeout = 10 * time.Millisecond
+			defer func() { middleware.queueTimeout = imageQueueTimeout }()
+			limit := middleware.fetchQueue.Limit()
+			for i := 0; i < limit; i++ {
+				require.NoError(t, middleware.fetchQueue.Acquire(context.Background(), time.Second))
+			}
+			defer func() {
+				for i := 0; i < limit; i++ {
+					middleware.fetchQueue.Release()
+				}
+			}()
+
+			req := httptest.NewRequest("GET", "/__ownstak__/image?url=/image.webp", nil)
+			res := httptest.NewRecorder()
+
+			// Create request context
+			serverReq, err := server.NewRequest(req)
+			require.NoError(t, err)
+			serverRes := server.NewResponse(res)
+			ctx := server.NewRequestContext(serverReq, serverRes, nil)
+
+			// Create and run middleware
+			middleware.OnRequest(ctx, func() {})
+
+			// Verify response
+			assert.Equal(t, server.StatusServiceOverloaded, ctx.Response.Status)
+			assert.Equal(t, imageQueueRetryAfter, res.Result().Header.Get(server.HeaderRetryAfter))
+			assert.Equal(t, imageQueueRetryAfter, ctx.Response.Headers.Get(server.HeaderRetryAfter))
+			assert.Contains(t, string(ctx.Response.Body), "Server is overloaded")
+		})
+
+		t.Run("should return blurred placeholder", func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/__ownstak__/image/placeholder?url=/static/pexels.jpg", nil)
+			req.Header.Set(server.HeaderXOwnDebug, "true")
+			res := httptest.NewRecorder()
+
+			// Create request context
+			serverReq, err := server.NewRequest(req)
+			require.NoError(t, err)
+			serverRes := server.NewResponse(res)
+			ctx := server.NewRequestContext(serverReq, serverRes, nil)
+
+			// Create and run middleware
+			middleware.OnRequest(ctx, func() {})
+
+			// Verify response
+			assert.Equal(t, http.StatusOK, ctx.Response.Status)
+			assert.Equal(t, server.ContentTypeJSON, ctx.Response.Headers.Get(server.HeaderContentType))
+			assert.Contains(t, ctx.Response.Headers.Get(server.HeaderXOwnProxyDebug), "io-placeholder=blur")
+
+			var placeholder ImagePlaceholderResponse
+			require.NoError(t, json.Unmarshal(ctx.Response.Body, &placeholder))
+			assert.Equal(t, placeholderBlur, placeholder.Type)
+			assert.True(t, strings.HasPrefix(placeholder.DataURI, "data:image/webp;base64,"))
+			assert.Equal(t, 11, placeholder.Width)
+			assert.Equal(t, 16, placeholder.Height)
+			assert.Equal(t, 640, placeholder.SrcWidth)
+			assert.Equal(t, 960, placeholder.SrcHeight)
+		})
+
+		t.Run("should return average color placeholder", func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/__ownstak__/image/placeholder?url=/static/pexels.jpg&type=color", nil)
+			req.Header.Set(server.HeaderXOwnDebug, "true")
+			res := httptest.NewRecorder()
+
+			// Create request context
+			serverReq, err := server.NewRequest(req)
+			require.NoError(t, err)
+			serverRes := server.NewResponse(res)
+			ctx := server.NewRequestContext(serverReq, serverRes, nil)
+
+			// Create and run middleware
+			middleware.OnRequest(ctx, func() {})
+
+			// Verify response
+			assert.Equal(t, http.StatusOK, ctx.Response.Status)
+
+			var placeholder ImagePlaceholderResponse
+			require.NoError(t, json.Unmarshal(ctx.Response.Body, &placeholder))
+			assert.Equal(t, placeholderColor, placeholder.Type)
+			assert.Regexp(t, "^#[0-9a-f]{6}$", placeholder.Color)
+			assert.Empty(t, placeholder.DataURI)
+		})
+
+		t.Run("should validate placeholder type", func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/__ownstak__/image/placeholder?url=/static/pexels.jpg&type=gradient", nil)
+			req.Header.Set(server.HeaderXOwnDebug, "true")
+			res := httptest.NewRecorder()
+
+			// Create request context
+			serverReq, err := server.NewRequest(req)
+			require.NoError(t, err)
+			serverRes := server.NewResponse(res)
+			ctx := server.NewRequestContext(serverReq, serverRes, nil)
+
+			// Create and run middleware
+			middleware.OnRequest(ctx, func() {})
+
+			// Verify response
+			assert.Equal(t, http.StatusBadRequest, ctx.Response.Status)
+			assert.Contains(t, string(ctx.Response.Body), "Unsupported placeholder type")
+		})
+
+		t.Run("should return image info", func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/__ownstak__/image/info?url=/static/pexels.jpg&w=100", nil)
+			req.Header.Set(server.HeaderXOwnDebug, "true")
+			res := httptest.NewRecorder()
+
+			// Create request context
+			serverReq, err := server.NewRequest(req)
+			require.NoError(t, err)
+			serverRes := server.NewResponse(res)
+			ctx := server.NewRequestContext(serverReq, serverRes, nil)
+
+			// Create and run middleware
+			middleware.OnRequest(ctx, func() {})
+
+			// Verify response
+			assert.Equal(t, http.StatusOK, ctx.Response.Status)
+			assert.Equal(t, server.ContentTypeJSON, ctx.Response.Headers.Get(server.HeaderContentType))
+			assert.Contains(t, ctx.Response.Headers.Get(server.HeaderXOwnProxyDebug), "io-info=true")
+
+			var info ImageInfoResponse
+			require.NoError(t, json.Unmarshal(ctx.Response.Body, &info))
+			assert.Equal(t, "jpeg", info.Format)
+			assert.Equal(t, 640, info.Width)
+			assert.Equal(t, 960, info.Height)
+			assert.Equal(t, "srgb", info.Colorspace)
+			assert.Equal(t, 1, info.Pages)
+			assert.False(t, info.HasAlpha)
+			assert.Greater(t, info.Size, int64(0))
+		})
+
+		t.Run("should return number of frames in image info", func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/__ownstak__/image/info?url=/static/animated.gif", nil)
+			res := httptest.NewRecorder()
+
+			// Create request context
+			serverReq, err := server.NewRequest(req)
+			require.NoError(t, err)
+			serverRes := server.NewResponse(res)
+			ctx := server.NewRequestContext(serverReq, serverRes, nil)
+
+			// Create and run middleware
+			middleware.OnRequest(ctx, func() {})
+
+			// Verify response
+			assert.Equal(t, http.StatusOK, ctx.Response.Status)
+
+			var info ImageInfoResponse
+			require.NoError(t, json.Unmarshal(ctx.Response.Body, &info))
+			assert.Equal(t, "gif", info.Format)
+			assert.Equal(t, 40, info.Width)
+			assert.Equal(t, 30, info.Height)
+			assert.Equal(t, 3, info.Pages)
+		})
+
+		t.Run("should not return image info when disabled", func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/__ownstak__/image/info?url=/static/pexels.jpg&enabled=false", nil)
+			res := httptest.NewRecorder()
+
+			// Create request context
+			serverReq, err := server.NewRequest(req)
+			require.NoError(t, err)
+			serverRes := server.NewResponse(res)
+			ctx := server.NewRequestContext(serverReq, serverRes, nil)
+
+			// Create and run middleware
+			middleware.OnRequest(ctx, func() {})
+
+			// Verify response
+			assert.Equal(t, http.StatusUnprocessableEntity, ctx.Response.Status)
+			assert.Contains(t, string(ctx.Response.Body), "Info is not available for this image")
 		})
 
-		t.Run("should work with enabled parameter", func(t *testing.T) {
-			// Create test request
-			req := httptest.NewRequest("GET", "/__ownstak__/image?url=/image.webp&enabled=true", nil)
+		t.Run("should reject images exceeding max pixels", func(t *testing.T) {
+			middleware.maxPixels = 100
+			defer func() { middleware.maxPixels = defaultMaxImagePixels }()
+
+			req := httptest.NewRequest("GET", "/__ownstak__/image?url=/image.webp&w=10", nil)
+			res := httptest.NewRecorder()
+
+			// Create request context
+			serverReq, err := server.NewRequest(req)
+			require.NoError(t, err)
+			serverRes := server.NewResponse(res)
+			ctx := server.NewRequestContext(serverReq, serverRes, nil)
+
+			// Create and run middleware
+			middleware.OnRequest(ctx, func() {})
+
+			// Verify response
+			assert.Equal(t, http.StatusBadRequest, ctx.Response.Status)
+			assert.Contains(t, string(ctx.Response.Body), "exceed maximum limit of 100 pixels")
+		})
+
+		t.Run("should reject truncated images", func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/__ownstak__/image?url=/truncated.jpg&w=100", nil)
+			res := httptest.NewRecorder()
+
+			// Create request context
+			serverReq, err := server.NewRequest(req)
+			require.NoError(t, err)
+			serverRes := server.NewResponse(res)
+			ctx := server.NewRequestContext(serverReq, serverRes, nil)
+
+			// Create and run middleware
+			middleware.OnRequest(ctx, func() {})
+
+			// Verify response
+			assert.Equal(t, http.StatusBadRequest, ctx.Response.Status)
+			assert.Contains(t, string(ctx.Response.Body), "The image is truncated or corrupt")
+		})
+
+		t.Run("should keep frames of animated images", func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/__ownstak__/image?url=/static/animated.gif&w=20&f=webp", nil)
 			req.Header.Set(server.HeaderXOwnDebug, "true")
 			res := httptest.NewRecorder()
 
@@ -255,13 +978,13 @@ func TestImageOptimizerMiddleware(t *testing.T) {
 
 			// Verify response
 			assert.Equal(t, http.StatusOK, ctx.Response.Status)
-			assert.Equal(t, "image/webp", ctx.Response.Headers.Get("Content-Type"))
-			assert.Contains(t, ctx.Response.Headers.Get(server.HeaderXOwnProxyDebug), "io-enabled=true")
+			assert.Contains(t, ctx.Response.Headers.Get(server.HeaderXOwnProxyDebug), "io-frames=3")
+			assert.Contains(t, ctx.Response.Headers.Get(server.HeaderXOwnProxyDebug), "io-width=20")
+			assert.Contains(t, ctx.Response.Headers.Get(server.HeaderXOwnProxyDebug), "io-height=15")
 		})
 
-		t.Run("should work with e parameter (alias for enabled)", func(t *testing.T) {
-			// Create test request
-			req := httptest.NewRequest("GET", "/__ownstak__/image?url=/image.webp&e=true", nil)
+		t.Run("should extract single frame of animated images", func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/__ownstak__/image?url=/static/animated.gif&frame=0&f=webp", nil)
 			req.Header.Set(server.HeaderXOwnDebug, "true")
 			res := httptest.NewRecorder()
 
@@ -276,13 +999,12 @@ func TestImageOptimizerMiddleware(t *testing.T) {
 
 			// Verify response
 			assert.Equal(t, http.StatusOK, ctx.Response.Status)
-			assert.Equal(t, "image/webp", ctx.Response.Headers.Get("Content-Type"))
-			assert.Contains(t, ctx.Response.Headers.Get(server.HeaderXOwnProxyDebug), "io-enabled=true")
+			assert.NotContains(t, ctx.Response.Headers.Get(server.HeaderXOwnProxyDebug), "io-frames")
+			assert.Contains(t, ctx.Response.Headers.Get(server.HeaderXOwnProxyDebug), "io-height=30")
 		})
 
-		t.Run("should work with all parameters together", func(t *testing.T) {
-			// Create test request
-			req := httptest.NewRequest("GET", "/__ownstak__/image?url=/image.webp&w=100&h=150&q=80&f=jpeg&e=true", nil)
+		t.Run("should validate frame", func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/__ownstak__/image?url=/static/animated.gif&frame=-1", nil)
 			req.Header.Set(server.HeaderXOwnDebug, "true")
 			res := httptest.NewRecorder()
 
@@ -296,19 +1018,12 @@ func TestImageOptimizerMiddleware(t *testing.T) {
 			middleware.OnRequest(ctx, func() {})
 
 			// Verify response
-			assert.Equal(t, http.StatusOK, ctx.Response.Status)
-			assert.Equal(t, "image/jpeg", ctx.Response.Headers.Get("Content-Type"))
-			optimizerHeader := ctx.Response.Headers.Get(server.HeaderXOwnProxyDebug)
-			assert.Contains(t, optimizerHeader, "io-width=100")
-			assert.Contains(t, optimizerHeader, "io-height=150")
-			assert.Contains(t, optimizerHeader, "io-quality=80")
-			assert.Contains(t, optimizerHeader, "io-format=jpeg")
-			assert.Contains(t, optimizerHeader, "io-enabled=true")
+			assert.Equal(t, http.StatusBadRequest, ctx.Response.Status)
+			assert.Contains(t, string(ctx.Response.Body), "Frame must be a positive number")
 		})
 
-		t.Run("should validate quality range", func(t *testing.T) {
-			// Create test request with invalid quality
-			req := httptest.NewRequest("GET", "/__ownstak__/image?url=/image.webp&q=0", nil)
+		t.Run("should validate metadata", func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/__ownstak__/image?url=/static/pexels.jpg&metadata=exif", nil)
 			req.Header.Set(server.HeaderXOwnDebug, "true")
 			res := httptest.NewRecorder()
 
@@ -323,12 +1038,11 @@ func TestImageOptimizerMiddleware(t *testing.T) {
 
 			// Verify response
 			assert.Equal(t, http.StatusBadRequest, ctx.Response.Status)
-			assert.Contains(t, string(ctx.Response.Body), "Quality must be a number between 1 and 100")
+			assert.Contains(t, string(ctx.Response.Body), "Unsupported metadata")
 		})
 
-		t.Run("should validate width range", func(t *testing.T) {
-			// Create test request with invalid width
-			req := httptest.NewRequest("GET", "/__ownstak__/image?url=/image.webp&w=-1", nil)
+		t.Run("should validate fit", func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/__ownstak__/image?url=/image.webp&w=50&h=50&fit=stretch", nil)
 			req.Header.Set(server.HeaderXOwnDebug, "true")
 			res := httptest.NewRecorder()
 
@@ -343,12 +1057,11 @@ func TestImageOptimizerMiddleware(t *testing.T) {
 
 			// Verify response
 			assert.Equal(t, http.StatusBadRequest, ctx.Response.Status)
-			assert.Contains(t, string(ctx.Response.Body), "Width must be a positive number")
+			assert.Contains(t, string(ctx.Response.Body), "Unsupported fit")
 		})
 
-		t.Run("should validate height range", func(t *testing.T) {
-			// Create test request with invalid height
-			req := httptest.NewRequest("GET", "/__ownstak__/image?url=/image.webp&h=-1", nil)
+		t.Run("should validate position", func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/__ownstak__/image?url=/image.webp&w=50&h=50&position=middle", nil)
 			req.Header.Set(server.HeaderXOwnDebug, "true")
 			res := httptest.NewRecorder()
 
@@ -363,12 +1076,11 @@ func TestImageOptimizerMiddleware(t *testing.T) {
 
 			// Verify response
 			assert.Equal(t, http.StatusBadRequest, ctx.Response.Status)
-			assert.Contains(t, string(ctx.Response.Body), "Height must be a positive number")
+			assert.Contains(t, string(ctx.Response.Body), "Unsupported position")
 		})
 
-		t.Run("should validate output format", func(t *testing.T) {
-			// Create test request with invalid format
-			req := httptest.NewRequest("GET", "/__ownstak__/image?url=/image.webp&f=bmp", nil)
+		t.Run("should validate focal point", func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/__ownstak__/image?url=/image.webp&w=50&h=50&fp-x=1.5", nil)
 			req.Header.Set(server.HeaderXOwnDebug, "true")
 			res := httptest.NewRecorder()
 
@@ -383,7 +1095,7 @@ func TestImageOptimizerMiddleware(t *testing.T) {
 
 			// Verify response
 			assert.Equal(t, http.StatusBadRequest, ctx.Response.Status)
-			assert.Contains(t, string(ctx.Response.Body), "Unsupported output format")
+			assert.Contains(t, string(ctx.Response.Body), "Focal point fp-x must be a number between 0 and 1")
 		})
 
 		t.Run("should prevent fetching from internal endpoints", func(t *testing.T) {
@@ -622,6 +1334,402 @@ func TestImageOptimizerMiddleware(t *testing.T) {
 			assert.Contains(t, string(ctx.Response.Body), "content-length header exceeds maximum limit")
 		})
 	})
+
+	t.Run("Cache drop", func(t *testing.T) {
+		originalApiToken := os.Getenv(constants.EnvInternalApiToken)
+		os.Setenv(constants.EnvInternalApiToken, "secret-token")
+		defer os.Setenv(constants.EnvInternalApiToken, originalApiToken)
+
+		sendDropRequest := func(t *testing.T, method, apiToken string) *server.RequestContext {
+			req := httptest.NewRequest(method, "/__ownstak__/image/cache/drop", nil)
+			if apiToken != "" {
+				req.Header.Set(server.HeaderXOwnApiToken, apiToken)
+			}
+			res := httptest.NewRecorder()
+
+			serverReq, err := server.NewRequest(req)
+			require.NoError(t, err)
+			serverRes := server.NewResponse(res)
+			ctx := server.NewRequestContext(serverReq, serverRes, nil)
+
+			middleware.OnRequest(ctx, func() {})
+			return ctx
+		}
+
+		t.Run("should require POST method", func(t *testing.T) {
+			ctx := sendDropRequest(t, "GET", "secret-token")
+			assert.Equal(t, http.StatusMethodNotAllowed, ctx.Response.Status)
+		})
+
+		t.Run("should require valid api token", func(t *testing.T) {
+			ctx := sendDropRequest(t, "POST", "")
+			assert.Equal(t, http.StatusUnauthorized, ctx.Response.Status)
+
+			ctx = sendDropRequest(t, "POST", "wrong-token")
+			assert.Equal(t, http.StatusUnauthorized, ctx.Response.Status)
+		})
+
+		t.Run("should drop the cache and return memory stats", func(t *testing.T) {
+			ctx := sendDropRequest(t, "POST", "secret-token")
+			require.Equal(t, http.StatusOK, ctx.Response.Status)
+
+			var stats map[string]map[string]any
+			require.NoError(t, json.Unmarshal(ctx.Response.Body, &stats))
+			assert.Contains(t, stats["before"], "mem")
+			assert.Contains(t, stats["after"], "cacheSize")
+			assert.Equal(t, float64(0), stats["after"]["cacheSize"])
+		})
+	})
+
+	t.Run("Fetch errors", func(t *testing.T) {
+		runRequest := func(t *testing.T, path string) *server.RequestContext {
+			req := httptest.NewRequest("GET", path, nil)
+			req.Header.Set(server.HeaderXOwnDebug, "true")
+			res := httptest.NewRecorder()
+
+			serverReq, err := server.NewRequest(req)
+			require.NoError(t, err)
+			serverRes := server.NewResponse(res)
+			ctx := server.NewRequestContext(serverReq, serverRes, nil)
+
+			middleware.OnRequest(ctx, func() {})
+			return ctx
+		}
+
+		t.Run("should propagate 404 and 410 of the source image", func(t *testing.T) {
+			ctx := runRequest(t, "/__ownstak__/image?url=/missing.jpg")
+			assert.Equal(t, http.StatusNotFound, ctx.Response.Status)
+			assert.Contains(t, string(ctx.Response.Body), "Server returned status code 404")
+
+			ctx = runRequest(t, "/__ownstak__/image?url=/gone.jpg")
+			assert.Equal(t, http.StatusGone, ctx.Response.Status)
+		})
+
+		t.Run("should return 502 for server errors of the source image", func(t *testing.T) {
+			ctx := runRequest(t, "/__ownstak__/image?url=/server-error.jpg")
+			assert.Equal(t, http.StatusBadGateway, ctx.Response.Status)
+			assert.Contains(t, string(ctx.Response.Body), "Server returned status code 503")
+		})
+
+		t.Run("should return 502 when the connection fails", func(t *testing.T) {
+			ctx := runRequest(t, "/__ownstak__/image?url=/refused.jpg")
+			assert.Equal(t, http.StatusBadGateway, ctx.Response.Status)
+			assert.Contains(t, string(ctx.Response.Body), "connection refused")
+		})
+
+		t.Run("should return 504 when the fetch times out", func(t *testing.T) {
+			ctx := runRequest(t, "/__ownstak__/image?url=/timeout.jpg")
+			assert.Equal(t, http.StatusGatewayTimeout, ctx.Response.Status)
+		})
+	})
+
+	t.Run("Conditional requests", func(t *testing.T) {
+		runRequest := func(t *testing.T, path string, headers map[string]string) *server.RequestContext {
+			req := httptest.NewRequest("GET", path, nil)
+			req.Header.Set(server.HeaderXOwnDebug, "true")
+			for key, value := range headers {
+				req.Header.Set(key, value)
+			}
+			res := httptest.NewRecorder()
+
+			serverReq, err := server.NewRequest(req)
+			require.NoError(t, err)
+			serverRes := server.NewResponse(res)
+			ctx := server.NewRequestContext(serverReq, serverRes, nil)
+
+			middleware.OnRequest(ctx, func() {})
+			return ctx
+		}
+
+		t.Run("should return deterministic ETag derived from source ETag and params", func(t *testing.T) {
+			ctx := runRequest(t, "/__ownstak__/image?url=/versioned.jpg&w=100", nil)
+			require.Equal(t, http.StatusOK, ctx.Response.Status)
+			etag := ctx.Response.Headers.Get(server.HeaderETag)
+			assert.Equal(t, "Mon, 02 Jan 2006 15:04:05 GMT", ctx.Response.Headers.Get(server.HeaderLastModified))
+
+			ctx = runRequest(t, "/__ownstak__/image?url=/versioned.jpg&w=100", nil)
+			assert.Equal(t, etag, ctx.Response.Headers.Get(server.HeaderETag))
+
+			ctx = runRequest(t, "/__ownstak__/image?url=/versioned.jpg&w=200", nil)
+			assert.NotEqual(t, etag, ctx.Response.Headers.Get(server.HeaderETag))
+		})
+
+		t.Run("should return 304 when the origin says the source image didn't change", func(t *testing.T) {
+			ctx := runRequest(t, "/__ownstak__/image?url=/versioned.jpg&w=100&f=auto", nil)
+			require.Equal(t, http.StatusOK, ctx.Response.Status)
+			etag := ctx.Response.Headers.Get(server.HeaderETag)
+
+			ctx = runRequest(t, "/__ownstak__/image?url=/versioned.jpg&w=100&f=auto", map[string]string{server.HeaderIfNoneMatch: etag})
+			assert.Equal(t, http.StatusNotModified, ctx.Response.Status)
+			assert.Contains(t, ctx.Response.Headers.Get(server.HeaderXOwnProxyDebug), "io-cache=NOT-MODIFIED")
+			assert.Equal(t, etag, ctx.Response.Headers.Get(server.HeaderETag))
+			assert.Equal(t, server.HeaderAccept, ctx.Response.Headers.Get(server.HeaderVary))
+			assert.Empty(t, ctx.Response.Body)
+		})
+
+		t.Run("should forward If-Modified-Since to the origin", func(t *testing.T) {
+			ctx := runRequest(t, "/__ownstak__/image?url=/versioned.jpg&w=100", map[string]string{server.HeaderIfModifiedSince: "Mon, 02 Jan 2006 15:04:05 GMT"})
+			assert.Equal(t, http.StatusNotModified, ctx.Response.Status)
+			assert.Equal(t, defaultCacheControl, ctx.Response.Headers.Get(server.HeaderCacheControl))
+		})
+
+		t.Run("should ignore If-Modified-Since with foreign If-None-Match", func(t *testing.T) {
+			ctx := runRequest(t, "/__ownstak__/image?url=/versioned.jpg&w=100", map[string]string{
+				server.HeaderIfNoneMatch:     `"foreign"`,
+				server.HeaderIfModifiedSince: "Mon, 02 Jan 2006 15:04:05 GMT",
+			})
+			assert.Equal(t, http.StatusOK, ctx.Response.Status)
+		})
+
+		t.Run("should not forward ETags issued for other params", func(t *testing.T) {
+			ctx := runRequest(t, "/__ownstak__/image?url=/versioned.jpg&w=100", nil)
+			require.Equal(t, http.StatusOK, ctx.Response.Status)
+			etag := ctx.Response.Headers.Get(server.HeaderETag)
+
+			ctx = runRequest(t, "/__ownstak__/image?url=/versioned.jpg&w=200", map[string]string{server.HeaderIfNoneMatch: etag})
+			assert.Equal(t, http.StatusOK, ctx.Response.Status)
+		})
+	})
+
+	t.Run("Caching", func(t *testing.T) {
+		cache, err := newImageCache(t.TempDir(), 10*1024*1024, time.Hour)
+		require.NoError(t, err)
+		cachedMiddleware := NewImageOptimizerMiddleware()
+		cachedMiddleware.client = http.DefaultClient
+		cachedMiddleware.cache = cache
+
+		runRequest := func(t *testing.T, path string, headers map[string]string) *server.RequestContext {
+			req := httptest.NewRequest("GET", path, nil)
+			req.Header.Set(server.HeaderXOwnDebug, "true")
+			for key, value := range headers {
+				req.Header.Set(key, value)
+			}
+			res := httptest.NewRecorder()
+
+			serverReq, err := server.NewRequest(req)
+			require.NoError(t, err)
+			serverRes := server.NewResponse(res)
+			ctx := server.NewRequestContext(serverReq, serverRes, nil)
+
+			cachedMiddleware.OnRequest(ctx, func() {})
+			return ctx
+		}
+
+		t.Run("should serve repeated requests from the cache", func(t *testing.T) {
+			ctx := runRequest(t, "/__ownstak__/image?url=/image.webp&w=50", nil)
+			assert.Equal(t, http.StatusOK, ctx.Response.Status)
+			assert.Contains(t, ctx.Response.Headers.Get(server.HeaderXOwnProxyDebug), "io-cache=MISS")
+			etag := ctx.Response.Headers.Get(server.HeaderETag)
+			assert.NotEmpty(t, etag)
+			assert.NotEmpty(t, ctx.Response.Headers.Get(server.HeaderLastModified))
+
+			ctx = runRequest(t, "/__ownstak__/image?url=/image.webp&w=50", nil)
+			assert.Equal(t, http.StatusOK, ctx.Response.Status)
+			assert.Contains(t, ctx.Response.Headers.Get(server.HeaderXOwnProxyDebug), "io-cache=HIT")
+			assert.Equal(t, etag, ctx.Response.Headers.Get(server.HeaderETag))
+			assert.Equal(t, "image/webp", ctx.Response.Headers.Get(server.HeaderContentType))
+		})
+
+		t.Run("should return 304 for matching ETag", func(t *testing.T) {
+			ctx := runRequest(t, "/__ownstak__/image?url=/image.webp&w=40", nil)
+			etag := ctx.Response.Headers.Get(server.HeaderETag)
+
+			ctx = runRequest(t, "/__ownstak__/image?url=/image.webp&w=40", map[string]string{server.HeaderIfNoneMatch: etag})
+			assert.Equal(t, http.StatusNotModified, ctx.Response.Status)
+			assert.Empty(t, ctx.Response.Body)
+		})
+
+		t.Run("should revalidate stale images", func(t *testing.T) {
+			runRequest(t, "/__ownstak__/image?url=/image.webp&w=30", nil)
+			cache.ttl = 0
+			defer func() { cache.ttl = time.Hour }()
+
+			// The mocked image has no validators, so it's processed again
+			ctx := runRequest(t, "/__ownstak__/image?url=/image.webp&w=30", nil)
+			assert.Equal(t, http.StatusOK, ctx.Response.Status)
+			assert.Contains(t, ctx.Response.Headers.Get(server.HeaderXOwnProxyDebug), "io-cache=MISS")
+		})
+	})
+}
+
+func TestNegotiateOutputFormat(t *testing.T) {
+	t.Run("should prefer avif", func(t *testing.T) {
+		assert.Equal(t, "avif", negotiateOutputFormat("image/avif,image/webp,image/apng,image/*,*/*;q=0.8", false))
+	})
+
+	t.Run("should fallback to webp", func(t *testing.T) {
+		assert.Equal(t, "webp", negotiateOutputFormat("image/webp,*/*", true))
+	})
+
+	t.Run("should fallback to png for transparent images", func(t *testing.T) {
+		assert.Equal(t, "png", negotiateOutputFormat("image/*,*/*;q=0.8", true))
+	})
+
+	t.Run("should fallback to jpeg for opaque images", func(t *testing.T) {
+		assert.Equal(t, "jpeg", negotiateOutputFormat("", false))
+	})
+
+	t.Run("should prefer webp for animated images", func(t *testing.T) {
+		assert.Equal(t, "webp", negotiateAnimatedOutputFormat("image/avif,image/webp,*/*"))
+		assert.Equal(t, "gif", negotiateAnimatedOutputFormat("image/*,*/*;q=0.8"))
+	})
+}
+
+func TestImageOptimizerSrcset(t *testing.T) {
+	middleware := &ImageOptimizerMiddleware{}
+
+	runSrcset := func(t *testing.T, path string) (*server.RequestContext, ImageSrcsetResponse) {
+		req := httptest.NewRequest("GET", path, nil)
+		res := httptest.NewRecorder()
+
+		serverReq, err := server.NewRequest(req)
+		require.NoError(t, err)
+		serverRes := server.NewResponse(res)
+		ctx := server.NewRequestContext(serverReq, serverRes, nil)
+
+		middleware.OnRequest(ctx, func() {})
+
+		var srcset ImageSrcsetResponse
+		if ctx.Response.Status == http.StatusOK {
+			require.NoError(t, json.Unmarshal(ctx.Response.Body, &srcset))
+		}
+		return ctx, srcset
+	}
+
+	t.Run("should return width descriptors for breakpoints", func(t *testing.T) {
+		ctx, srcset := runSrcset(t, "/__ownstak__/image/srcset?url=/image.jpg&widths=1080,640&q=80")
+
+		assert.Equal(t, http.StatusOK, ctx.Response.Status)
+		assert.Equal(t, server.ContentTypeJSON, ctx.Response.Headers.Get(server.HeaderContentType))
+		assert.Equal(t, "/__ownstak__/image?q=80&url=%2Fimage.jpg&w=640 640w, /__ownstak__/image?q=80&url=%2Fimage.jpg&w=1080 1080w", srcset.Srcset)
+		require.Len(t, srcset.Sources, 2)
+		assert.Equal(t, 640, srcset.Sources[0].Width)
+		assert.Equal(t, "1080w", srcset.Sources[1].Descriptor)
+	})
+
+	t.Run("should use default breakpoints capped at max dimension", func(t *testing.T) {
+		_, srcset := runSrcset(t, "/__ownstak__/image/srcset?url=/image.jpg&widths=640,5000,3840")
+
+		require.Len(t, srcset.Sources, 2)
+		assert.Equal(t, maxDimension, srcset.Sources[1].Width)
+
+		_, srcset = runSrcset(t, "/__ownstak__/image/srcset?url=/image.jpg")
+		assert.Len(t, srcset.Sources, len(defaultSrcsetWidths))
+	})
+
+	t.Run("should return density descriptors for fixed width", func(t *testing.T) {
+		_, srcset := runSrcset(t, "/__ownstak__/image/srcset?url=/image.jpg&w=300&dprs=1,1.5,3&f=avif")
+
+		assert.Equal(t, "/__ownstak__/image?f=avif&url=%2Fimage.jpg&w=300 1x, /__ownstak__/image?dpr=1.5&f=avif&url=%2Fimage.jpg&w=300 1.5x, /__ownstak__/image?dpr=3&f=avif&url=%2Fimage.jpg&w=300 3x", srcset.Srcset)
+		require.Len(t, srcset.Sources, 3)
+		assert.Equal(t, 900, srcset.Sources[2].Width)
+		assert.Equal(t, 3.0, srcset.Sources[2].Dpr)
+	})
+
+	t.Run("should require url parameter", func(t *testing.T) {
+		ctx, _ := runSrcset(t, "/__ownstak__/image/srcset?widths=640")
+		assert.Equal(t, http.StatusBadRequest, ctx.Response.Status)
+		assert.Contains(t, string(ctx.Response.Body), "URL parameter is required")
+	})
+
+	t.Run("should validate widths and dprs", func(t *testing.T) {
+		ctx, _ := runSrcset(t, "/__ownstak__/image/srcset?url=/image.jpg&widths=640,abc")
+		assert.Equal(t, http.StatusBadRequest, ctx.Response.Status)
+		assert.Contains(t, string(ctx.Response.Body), "Widths must be")
+
+		ctx, _ = runSrcset(t, "/__ownstak__/image/srcset?url=/image.jpg&w=100&dprs=1,5")
+		assert.Equal(t, http.StatusBadRequest, ctx.Response.Status)
+		assert.Contains(t, string(ctx.Response.Body), "DPRs must be")
+	})
+}
+
+func TestPlanImageResize(t *testing.T) {
+	center := positionFocalPoints[positionCenter]
+
+	t.Run("should preserve aspect ratio when only width is provided", func(t *testing.T) {
+		plan := planImageResize(1000, 500, 200, 0, fitCover, center)
+		assert.Equal(t, imageResizePlan{fit: fitInside, resizeWidth: 200, resizeHeight: 100, width: 200, height: 100}, plan)
+	})
+
+	t.Run("should preserve aspect ratio when only height is provided", func(t *testing.T) {
+		plan := planImageResize(1000, 500, 0, 100, fitCover, center)
+		assert.Equal(t, imageResizePlan{fit: fitInside, resizeWidth: 200, resizeHeight: 100, width: 200, height: 100}, plan)
+	})
+
+	t.Run("should limit dimensions to max dimension", func(t *testing.T) {
+		plan := planImageResize(5120, 2560, 0, 0, fitCover, center)
+		assert.Equal(t, maxDimension, plan.width)
+		assert.Equal(t, maxDimension/2, plan.height)
+	})
+
+	t.Run("should crop the center for cover fit", func(t *testing.T) {
+		plan := planImageResize(1000, 500, 200, 200, fitCover, center)
+		assert.Equal(t, imageResizePlan{fit: fitCover, resizeWidth: 400, resizeHeight: 200, width: 200, height: 200, left: 100, top: 0}, plan)
+	})
+
+	t.Run("should crop around the position for cover fit", func(t *testing.T) {
+		plan := planImageResize(1000, 500, 200, 200, fitCover, positionFocalPoints["right"])
+		assert.Equal(t, 200, plan.left)
+
+		plan = planImageResize(1000, 500, 200, 200, fitCover, positionFocalPoints["left"])
+		assert.Equal(t, 0, plan.left)
+	})
+
+	t.Run("should keep the crop area within the image for focal point", func(t *testing.T) {
+		plan := planImageResize(1000, 500, 200, 200, fitCover, imageFocalPoint{0.3, 0.5})
+		assert.Equal(t, 20, plan.left)
+
+		plan = planImageResize(1000, 500, 200, 200, fitCover, imageFocalPoint{0.95, 0.5})
+		assert.Equal(t, 200, plan.left)
+	})
+
+	t.Run("should not upscale the image for cover fit", func(t *testing.T) {
+		plan := planImageResize(100, 100, 400, 200, fitCover, center)
+		assert.Equal(t, imageResizePlan{fit: fitCover, resizeWidth: 100, resizeHeight: 100, width: 100, height: 50, left: 0, top: 25}, plan)
+	})
+
+	t.Run("should embed the image for contain fit", func(t *testing.T) {
+		plan := planImageResize(1000, 500, 200, 200, fitContain, center)
+		assert.Equal(t, imageResizePlan{fit: fitContain, resizeWidth: 200, resizeHeight: 100, width: 200, height: 200, left: 0, top: 50}, plan)
+
+		plan = planImageResize(1000, 500, 200, 200, fitContain, positionFocalPoints["bottom"])
+		assert.Equal(t, 100, plan.top)
+	})
+
+	t.Run("should stretch the image for fill fit", func(t *testing.T) {
+		plan := planImageResize(1000, 500, 200, 200, fitFill, center)
+		assert.Equal(t, imageResizePlan{fit: fitFill, resizeWidth: 200, resizeHeight: 200, width: 200, height: 200}, plan)
+	})
+
+	t.Run("should resize the image for inside and outside fit", func(t *testing.T) {
+		plan := planImageResize(1000, 500, 200, 200, fitInside, center)
+		assert.Equal(t, imageResizePlan{fit: fitInside, resizeWidth: 200, resizeHeight: 100, width: 200, height: 100}, plan)
+
+		plan = planImageResize(1000, 500, 200, 200, fitOutside, center)
+		assert.Equal(t, imageResizePlan{fit: fitOutside, resizeWidth: 400, resizeHeight: 200, width: 400, height: 200}, plan)
+	})
+}
+
+func TestParseFocalPoint(t *testing.T) {
+	t.Run("should parse both coordinates", func(t *testing.T) {
+		focalPoint, err := parseFocalPoint("0.25", "1")
+		require.NoError(t, err)
+		assert.Equal(t, imageFocalPoint{0.25, 1}, focalPoint)
+	})
+
+	t.Run("should default missing coordinate to center", func(t *testing.T) {
+		focalPoint, err := parseFocalPoint("", "0.1")
+		require.NoError(t, err)
+		assert.Equal(t, imageFocalPoint{0.5, 0.1}, focalPoint)
+	})
+
+	t.Run("should reject invalid coordinates", func(t *testing.T) {
+		_, err := parseFocalPoint("abc", "")
+		assert.Error(t, err)
+
+		_, err = parseFocalPoint("0.5", "-0.1")
+		assert.Error(t, err)
+	})
 }
 
 func setupImageOptimizerMockClient(t *testing.T) func() {
@@ -656,6 +1764,56 @@ func setupImageOptimizerMockClient(t *testing.T) func() {
 			resp.Header.Set("Content-Type", "image/svg+xml") // Set correct MIME type
 			return resp, nil
 		}
+		if strings.HasPrefix(req.URL.Path, "/static/") {
+			// Serve the fixture images from mocks/static folder
+			staticBytes, err := os.ReadFile(filepath.Join("mocks", req.URL.Path))
+			if err != nil {
+				return httpmock.NewStringResponse(404, "Not Found"), nil
+			}
+			resp := httpmock.NewBytesResponse(200, staticBytes)
+			resp.Header.Set("Content-Type", "image/"+strings.TrimPrefix(filepath.Ext(req.URL.Path), "."))
+			resp.Header.Set("Content-Length", strconv.Itoa(len(staticBytes)))
+			return resp, nil
+		}
+		if req.URL.Path == "/truncated.jpg" {
+			// Serve just the first half of the JPEG image
+			jpegBytes, err := os.ReadFile("mocks/static/pexels.jpg")
+			if err != nil {
+				return nil, err
+			}
+			resp := httpmock.NewBytesResponse(200, jpegBytes[:len(jpegBytes)/2])
+			resp.Header.Set("Content-Type", "image/jpeg")
+			return resp, nil
+		}
+		if req.URL.Path == "/gone.jpg" {
+			return httpmock.NewStringResponse(410, "Gone"), nil
+		}
+		if req.URL.Path == "/server-error.jpg" {
+			return httpmock.NewStringResponse(503, "Service Unavailable"), nil
+		}
+		if req.URL.Path == "/timeout.jpg" {
+			return nil, context.DeadlineExceeded
+		}
+		if req.URL.Path == "/refused.jpg" {
+			return nil, errors.New("connection refused")
+		}
+		if req.URL.Path == "/versioned.jpg" {
+			// Serve the image with validators and answer the conditional requests
+			if req.Header.Get("If-None-Match") == `"v1"` || req.Header.Get("If-Modified-Since") == "Mon, 02 Jan 2006 15:04:05 GMT" {
+				resp := httpmock.NewStringResponse(304, "")
+				resp.Header.Set("ETag", `"v1"`)
+				return resp, nil
+			}
+			jpegBytes, err := os.ReadFile("mocks/static/pexels.jpg")
+			if err != nil {
+				return nil, err
+			}
+			resp := httpmock.NewBytesResponse(200, jpegBytes)
+			resp.Header.Set("Content-Type", "image/jpeg")
+			resp.Header.Set("ETag", `"v1"`)
+			resp.Header.Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+			return resp, nil
+		}
 		if req.URL.Path == "/robots.txt" {
 			resp := httpmock.NewStringResponse(200, "User-agent: *\nDisallow: /")
 			resp.Header.Set("Content-Type", "text/plain")
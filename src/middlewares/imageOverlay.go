@@ -0,0 +1,303 @@
+package middlewares
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ownstak-proxy/src/constants"
+	"ownstak-proxy/src/server"
+	"ownstak-proxy/src/utils"
+	"ownstak-proxy/src/vips"
+)
+
+// Maximum accepted size of the overlay image in bytes.
+// The overlays are small logos or watermarks, so the limit is much lower than for the source images.
+const maxOverlayImageSize = 1024 * 1024 // 1MB
+
+// Max total size of the overlay images kept in memory
+// and how long they're used without fetching them again.
+const (
+	overlayCacheSize = 32 * 1024 * 1024 // 32MB
+	overlayCacheTTL  = 5 * time.Minute
+)
+
+// The watermarks are usually placed in the corner.
+const defaultOverlayPosition = "bottom-right"
+
+// imageOverlay is the image (e.g. logo or watermark) composited over the optimized image.
+// It's fetched with the same allowlist rules as the source image.
+type imageOverlay struct {
+	url      *url.URL
+	position string  // One of positionFocalPoints
+	opacity  float64 // 0 = invisible, 1 = opaque
+	scale    float64 // The width of the overlay relative to the output image, 0 = original size
+}
+
+// parseImageOverlay reads and validates the overlay params from the query.
+// Returns nil if the overlay param is not set.
+// The relative overlay URL is resolved against the scheme and host of the request.
+func parseImageOverlay(query map[string][]string, scheme, host string, policy *imageFetchPolicy) (*imageOverlay, error) {
+	overlayURL := GetQueryParam(query, "overlay", "", "")
+	if overlayURL == "" {
+		return nil, nil
+	}
+
+	parsedURL, err := url.Parse(overlayURL)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid overlay URL: %v", err)
+	}
+	if strings.Contains(parsedURL.Path, constants.InternalPathPrefix) {
+		return nil, fmt.Errorf("Fetching overlay from %s path is not allowed", constants.InternalPathPrefix)
+	}
+	if !parsedURL.IsAbs() {
+		parsedURL.Scheme = scheme
+		parsedURL.Host = host
+	}
+	if policy != nil && !policy.Allows(parsedURL) {
+		return nil, fmt.Errorf("Overlay URL must be from the same domain or match the allowed remote patterns")
+	}
+
+	overlay := &imageOverlay{
+		url:      parsedURL,
+		position: strings.ToLower(GetQueryParam(query, "overlay-position", "", defaultOverlayPosition)),
+		opacity:  1,
+	}
+	if _, ok := positionFocalPoints[overlay.position]; !ok {
+		return nil, fmt.Errorf("Unsupported overlay position: %s. Supported positions are: %s", overlay.position, strings.Join(sortedKeys(positionFocalPoints), ", "))
+	}
+
+	if opacity := GetQueryParam(query, "overlay-opacity", "", ""); opacity != "" {
+		overlay.opacity, err = strconv.ParseFloat(opacity, 64)
+		if err != nil || overlay.opacity < 0 || overlay.opacity > 1 {
+			return nil, fmt.Errorf("Overlay opacity must be a number between 0 and 1")
+		}
+	}
+
+	if scale := GetQueryParam(query, "overlay-scale", "", ""); scale != "" {
+		overlay.scale, err = strconv.ParseFloat(scale, 64)
+		if err != nil || overlay.scale < 0 || overlay.scale > 1 {
+			return nil, fmt.Errorf("Overlay scale must be a number between 0 and 1")
+		}
+	}
+
+	return overlay, nil
+}
+
+// String returns all the overlay params.
+// It's used in the cache key and it's empty if there's no overlay.
+// e.g: https://example.com/logo.png,bottom-right,0.5,0.2
+func (o *imageOverlay) String() string {
+	if o == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s,%s,%g,%g", o.url.String(), o.position, o.opacity, o.scale)
+}
+
+// operation returns the operation that composites the overlay image over the output image.
+// The animated images get the overlay on each frame.
+func (o *imageOverlay) operation(overlayImage *vips.VipsImage) imageOperation {
+	return imageOperation{
+		name: "overlay",
+		apply: func(img *vips.VipsImage) (*vips.VipsImage, error) {
+			focalPoint := positionFocalPoints[o.position]
+			left := int(math.Round(float64(vips.GetImageWidth(img)-vips.GetImageWidth(overlayImage)) * focalPoint.x))
+			top := int(math.Round(float64(vips.GetImageHeight(img)-vips.GetImageHeight(overlayImage)) * focalPoint.y))
+			return vips.CompositeImage(img, overlayImage, max(0, left), max(0, top))
+		},
+	}
+}
+
+// prepareOverlayImage loads the overlay image, scales it for the output image of given dimensions
+// and applies the opacity. The overlay never exceeds the output image.
+// The overlay with more than maxPixels is rejected before its pixels are decoded.
+// The data needs to stay alive until the returned image is freed by the caller.
+func prepareOverlayImage(data []byte, overlay *imageOverlay, width, height int, maxPixels int64) (*vips.VipsImage, error) {
+	img, err := vips.LoadImageFromBuffer(data)
+	if err != nil {
+		return nil, err
+	}
+
+	overlayWidth := vips.GetImageWidth(img)
+	overlayHeight := vips.GetImageHeight(img)
+	if overlayWidth == 0 || overlayHeight == 0 {
+		img.Free()
+		return nil, fmt.Errorf("failed to get overlay dimensions")
+	}
+	if int64(overlayWidth)*int64(overlayHeight) > maxPixels {
+		img.Free()
+		return nil, fmt.Errorf("The overlay dimensions %dx%d exceed maximum limit of %d pixels", overlayWidth, overlayHeight, maxPixels)
+	}
+	if overlay.scale > 0 {
+		scaledWidth := max(1, int(math.Round(float64(width)*overlay.scale)))
+		overlayHeight = max(1, int(math.Round(float64(overlayHeight)*float64(scaledWidth)/float64(overlayWidth))))
+		overlayWidth = scaledWidth
+	}
+
+	operations := []imageOperation{}
+	if boxWidth, boxHeight := min(overlayWidth, width), min(overlayHeight, height); boxWidth != vips.GetImageWidth(img) || boxHeight != vips.GetImageHeight(img) {
+		// The thumbnail fits the overlay into the box and preserves its aspect ratio
+		operations = append(operations, imageOperation{
+			name: "resize",
+			apply: func(img *vips.VipsImage) (*vips.VipsImage, error) {
+				return vips.ThumbnailImage(img, boxWidth, boxHeight, vips.VIPS_SIZE_BOTH)
+			},
+		})
+	}
+	if !vips.ImageHasAlpha(img) {
+		operations = append(operations, imageOperation{name: "alpha", apply: vips.AddAlphaImage})
+	}
+	if overlay.opacity < 1 {
+		operations = append(operations, imageOperation{
+			name: "opacity",
+			apply: func(img *vips.VipsImage) (*vips.VipsImage, error) {
+				// Multiply just the alpha channel, which is the last band
+				a := make([]float64, vips.GetImageBands(img))
+				b := make([]float64, len(a))
+				for i := range a {
+					a[i] = 1
+				}
+				a[len(a)-1] = overlay.opacity
+				return vips.LinearImage(img, a, b)
+			},
+		})
+	}
+
+	out, err := applyImageOperations(img, operations)
+	if out != img {
+		img.Free()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// fetchOverlay returns the overlay image from the memory cache or fetches it
+// with the same fetch policy as the source image.
+func (m *ImageOptimizerMiddleware) fetchOverlay(ctx context.Context, overlay *imageOverlay, policy *imageFetchPolicy) ([]byte, error) {
+	overlayURL := overlay.url.String()
+	if data, ok := m.overlayCache.Get(overlayURL); ok {
+		return data, nil
+	}
+
+	// The uncached overlays are fetched within the fetch queue limits the same way as the source images
+	if err := m.fetchQueue.Acquire(ctx, m.queueTimeout); err != nil {
+		return nil, err
+	}
+	defer m.fetchQueue.Release()
+
+	if policy != nil {
+		// Pass the policy to the client, so it can check the redirects and resolved IPs
+		ctx = context.WithValue(ctx, imageFetchPolicyKey{}, policy)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, overlayURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Server returned status code %d", resp.StatusCode)
+	}
+	contentType := resp.Header.Get(server.HeaderContentType)
+	if !strings.HasPrefix(contentType, "image/") || strings.Contains(contentType, "svg") {
+		return nil, fmt.Errorf("URL does not point to a raster image. Server returned content type: %s", contentType)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxOverlayImageSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxOverlayImageSize {
+		return nil, fmt.Errorf("The overlay exceeds maximum limit of %s", utils.FormatBytes(uint64(maxOverlayImageSize)))
+	}
+
+	m.overlayCache.Set(overlayURL, data)
+	return data, nil
+}
+
+// imageOverlayCache keeps the recently used overlay images in memory,
+// so the same watermark isn't fetched again for every optimized image.
+// The cache is bounded by the total size of the overlays and the least recently used ones are evicted first.
+type imageOverlayCache struct {
+	mutex   sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+	size    int64
+	maxSize int64
+	ttl     time.Duration
+}
+
+type imageOverlayCacheEntry struct {
+	key      string
+	data     []byte
+	storedAt time.Time
+}
+
+// newImageOverlayCache creates the memory cache for overlay images.
+func newImageOverlayCache(maxSize int64, ttl time.Duration) *imageOverlayCache {
+	return &imageOverlayCache{
+		entries: map[string]*list.Element{},
+		lru:     list.New(),
+		maxSize: maxSize,
+		ttl:     ttl,
+	}
+}
+
+// Get returns the overlay with given key if it was stored less than ttl ago.
+func (c *imageOverlayCache) Get(key string) ([]byte, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*imageOverlayCacheEntry)
+	if time.Since(entry.storedAt) > c.ttl {
+		c.remove(element)
+		return nil, false
+	}
+	c.lru.MoveToFront(element)
+	return entry.data, true
+}
+
+// Set stores the overlay and evicts the least recently used overlays if the cache exceeds its max size.
+func (c *imageOverlayCache) Set(key string, data []byte) {
+	if int64(len(data)) > c.maxSize {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+	c.entries[key] = c.lru.PushFront(&imageOverlayCacheEntry{key: key, data: data, storedAt: time.Now()})
+	c.size += int64(len(data))
+	for c.size > c.maxSize {
+		c.remove(c.lru.Back())
+	}
+}
+
+// remove deletes the entry. The mutex needs to be locked.
+func (c *imageOverlayCache) remove(element *list.Element) {
+	entry := element.Value.(*imageOverlayCacheEntry)
+	c.lru.Remove(element)
+	delete(c.entries, entry.key)
+	c.size -= int64(len(entry.data))
+}
@@ -0,0 +1,194 @@
+package middlewares
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseImageOverlay(t *testing.T) {
+	policy := &imageFetchPolicy{host: "example.com"}
+
+	t.Run("should return nil without overlay param", func(t *testing.T) {
+		overlay, err := parseImageOverlay(url.Values{"url": {"/image.jpg"}}, "https", "example.com", policy)
+		require.NoError(t, err)
+		assert.Nil(t, overlay)
+		assert.Equal(t, "", overlay.String())
+	})
+
+	t.Run("should resolve relative URL and use defaults", func(t *testing.T) {
+		overlay, err := parseImageOverlay(url.Values{"overlay": {"/logo.png"}}, "https", "example.com", policy)
+		require.NoError(t, err)
+		assert.Equal(t, "https://example.com/logo.png", overlay.url.String())
+		assert.Equal(t, defaultOverlayPosition, overlay.position)
+		assert.Equal(t, 1.0, overlay.opacity)
+		assert.Equal(t, 0.0, overlay.scale)
+		assert.Equal(t, "https://example.com/logo.png,bottom-right,1,0", overlay.String())
+	})
+
+	t.Run("should parse all params", func(t *testing.T) {
+		query := url.Values{
+			"overlay":          {"/logo.png"},
+			"overlay-position": {"Top-Left"},
+			"overlay-opacity":  {"0.5"},
+			"overlay-scale":    {"0.2"},
+		}
+		overlay, err := parseImageOverlay(query, "https", "example.com", policy)
+		require.NoError(t, err)
+		assert.Equal(t, "https://example.com/logo.png,top-left,0.5,0.2", overlay.String())
+	})
+
+	t.Run("should validate params", func(t *testing.T) {
+		tests := map[string]url.Values{
+			"Unsupported overlay position":                     {"overlay": {"/logo.png"}, "overlay-position": {"attention"}},
+			"Overlay opacity must be a number between 0 and 1": {"overlay": {"/logo.png"}, "overlay-opacity": {"2"}},
+			"Overlay scale must be a number between 0 and 1":   {"overlay": {"/logo.png"}, "overlay-scale": {"abc"}},
+			"Fetching overlay from /__ownstak__ path":          {"overlay": {"/__ownstak__/image?url=/logo.png"}},
+			"Overlay URL must be from the same domain":         {"overlay": {"https://other.com/logo.png"}},
+		}
+		for message, query := range tests {
+			_, err := parseImageOverlay(query, "https", "example.com", policy)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), message)
+		}
+	})
+
+	t.Run("should allow remote overlays matching the remote patterns", func(t *testing.T) {
+		policy := &imageFetchPolicy{host: "example.com", remotePatterns: []ImageRemotePattern{{Hostname: "cdn.other.com"}}}
+		overlay, err := parseImageOverlay(url.Values{"overlay": {"https://cdn.other.com/logo.png"}}, "https", "example.com", policy)
+		require.NoError(t, err)
+		assert.Equal(t, "https://cdn.other.com/logo.png", overlay.url.String())
+	})
+
+	t.Run("should allow any overlay without the policy", func(t *testing.T) {
+		_, err := parseImageOverlay(url.Values{"overlay": {"https://other.com/logo.png"}}, "https", "example.com", nil)
+		assert.NoError(t, err)
+	})
+}
+
+func TestImageOverlayCache(t *testing.T) {
+	t.Run("should store and read overlays", func(t *testing.T) {
+		cache := newImageOverlayCache(100, time.Hour)
+		cache.Set("logo", []byte("data"))
+
+		data, ok := cache.Get("logo")
+		require.True(t, ok)
+		assert.Equal(t, []byte("data"), data)
+
+		_, ok = cache.Get("missing")
+		assert.False(t, ok)
+	})
+
+	t.Run("should evict least recently used overlays", func(t *testing.T) {
+		cache := newImageOverlayCache(25, time.Hour)
+		cache.Set("first", make([]byte, 10))
+		cache.Set("second", make([]byte, 10))
+		cache.Get("first")
+		cache.Set("third", make([]byte, 10))
+
+		_, ok := cache.Get("second")
+		assert.False(t, ok)
+		_, ok = cache.Get("first")
+		assert.True(t, ok)
+		_, ok = cache.Get("third")
+		assert.True(t, ok)
+		assert.Equal(t, int64(20), cache.size)
+	})
+
+	t.Run("should not store overlays larger than the cache", func(t *testing.T) {
+		cache := newImageOverlayCache(5, time.Hour)
+		cache.Set("large", make([]byte, 10))
+		_, ok := cache.Get("large")
+		assert.False(t, ok)
+	})
+
+	t.Run("should expire overlays", func(t *testing.T) {
+		cache := newImageOverlayCache(100, time.Millisecond)
+		cache.Set("logo", []byte("data"))
+		time.Sleep(5 * time.Millisecond)
+
+		_, ok := cache.Get("logo")
+		assert.False(t, ok)
+		assert.Equal(t, int64(0), cache.size)
+	})
+}
+
+func TestFetchOverlay(t *testing.T) {
+	requests := 0
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/logo.png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("png"))
+		case "/logo.svg":
+			w.Header().Set("Content-Type", "image/svg+xml")
+			w.Write([]byte("<svg></svg>"))
+		case "/large.png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write(make([]byte, maxOverlayImageSize+1))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer origin.Close()
+
+	middleware := &ImageOptimizerMiddleware{
+		client:       origin.Client(),
+		overlayCache: newImageOverlayCache(overlayCacheSize, overlayCacheTTL),
+		fetchQueue:   newImageQueue(1),
+		queueTimeout: 10 * time.Millisecond,
+	}
+	overlayFor := func(path string) *imageOverlay {
+		overlayURL, err := url.Parse(origin.URL + path)
+		require.NoError(t, err)
+		return &imageOverlay{url: overlayURL, position: defaultOverlayPosition, opacity: 1}
+	}
+
+	t.Run("should fetch overlay once and cache it in memory", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			data, err := middleware.fetchOverlay(context.Background(), overlayFor("/logo.png"), nil)
+			require.NoError(t, err)
+			assert.Equal(t, []byte("png"), data)
+		}
+		assert.Equal(t, 1, requests)
+	})
+
+	t.Run("should reject non-raster images", func(t *testing.T) {
+		_, err := middleware.fetchOverlay(context.Background(), overlayFor("/logo.svg"), nil)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "does not point to a raster image")
+	})
+
+	t.Run("should reject missing overlays", func(t *testing.T) {
+		_, err := middleware.fetchOverlay(context.Background(), overlayFor("/missing.png"), nil)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "status code 404")
+	})
+
+	t.Run("should fetch uncached overlays within the fetch queue limit", func(t *testing.T) {
+		require.NoError(t, middleware.fetchQueue.Acquire(context.Background(), time.Second))
+		defer middleware.fetchQueue.Release()
+
+		_, err := middleware.fetchOverlay(context.Background(), overlayFor("/other.png"), nil)
+		assert.Equal(t, errImageQueueTimeout, err)
+
+		// The cached overlays don't need the slot
+		data, err := middleware.fetchOverlay(context.Background(), overlayFor("/logo.png"), nil)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("png"), data)
+		assert.Equal(t, 1, middleware.fetchQueue.Stats().Active)
+	})
+
+	t.Run("should reject too large overlays", func(t *testing.T) {
+		_, err := middleware.fetchOverlay(context.Background(), overlayFor("/large.png"), nil)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "exceeds maximum limit")
+	})
+}
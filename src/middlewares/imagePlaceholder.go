@@ -0,0 +1,106 @@
+package middlewares
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+
+	"ownstak-proxy/src/vips"
+)
+
+// The placeholder types returned by the /__ownstak__/image/placeholder endpoint.
+// - blur: The data URI of tiny blurred WebP image (default).
+// - color: The average color of the image in #rrggbb format.
+const (
+	placeholderBlur  = "blur"
+	placeholderColor = "color"
+)
+
+var supportedPlaceholders = map[string]bool{
+	placeholderBlur:  true,
+	placeholderColor: true,
+}
+
+// The max width or height of the placeholder image in pixels.
+// The browser scales it up and the blur hides the missing details.
+const placeholderSize = 16
+
+// The default quality and blur of the placeholder image.
+// The placeholder needs to be as small as possible, so SSR can inline it into HTML.
+const (
+	placeholderQuality   = 30
+	placeholderBlurSigma = 1
+)
+
+type ImagePlaceholderResponse struct {
+	Type      string `json:"type"`
+	DataURI   string `json:"dataUri,omitempty"`
+	Color     string `json:"color,omitempty"`
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+	SrcWidth  int    `json:"srcWidth"`
+	SrcHeight int    `json:"srcHeight"`
+}
+
+// placeholderDimensions returns the dimensions and fit of the placeholder image.
+// The requested dimensions are scaled down to placeholderSize while preserving their aspect ratio,
+// so the placeholder has the same shape as the optimized image.
+// Without both dimensions, the whole image is scaled down to fit into placeholderSize square.
+func placeholderDimensions(width, height int, fit string) (int, int, string) {
+	if width == 0 || height == 0 {
+		return placeholderSize, placeholderSize, fitInside
+	}
+	scale := float64(placeholderSize) / float64(max(width, height))
+	return max(1, int(math.Round(float64(width)*scale))), max(1, int(math.Round(float64(height)*scale))), fit
+}
+
+// buildImagePlaceholder returns the placeholder JSON for the already resized image.
+func buildImagePlaceholder(img *vips.VipsImage, placeholderType string, quality int, srcWidth, srcHeight int) ([]byte, error) {
+	placeholder := ImagePlaceholderResponse{
+		Type:      placeholderType,
+		Width:     vips.GetImageWidth(img),
+		Height:    vips.GetImageHeight(img),
+		SrcWidth:  srcWidth,
+		SrcHeight: srcHeight,
+	}
+
+	switch placeholderType {
+	case placeholderColor:
+		means, err := vips.GetImageBandMeans(img)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get image colors: %v", err)
+		}
+		placeholder.Color = formatHexColor(means, vips.ImageHasAlpha(img))
+	default:
+		data, err := vips.SaveImageToBuffer(img, "webp", quality, vips.VIPS_FOREIGN_KEEP_NONE)
+		if err != nil {
+			return nil, fmt.Errorf("failed to save placeholder: %v", err)
+		}
+		placeholder.DataURI = "data:image/webp;base64," + base64.StdEncoding.EncodeToString(data)
+	}
+
+	return json.Marshal(placeholder)
+}
+
+// formatHexColor returns the color in #rrggbb format from the band values.
+// The alpha band is ignored and the grayscale images have the same value for all colors.
+// e.g: formatHexColor([]float64{255, 128, 0}, false) => "#ff8000"
+func formatHexColor(bands []float64, hasAlpha bool) string {
+	colorBands := len(bands)
+	if hasAlpha {
+		colorBands--
+	}
+	if colorBands < 1 {
+		return "#000000"
+	}
+
+	var color strings.Builder
+	color.WriteString("#")
+	for i := 0; i < 3; i++ {
+		value := bands[min(i, colorBands-1)]
+		fmt.Fprintf(&color, "%02x", uint8(math.Round(max(0, min(255, value)))))
+	}
+	return color.String()
+}
@@ -0,0 +1,34 @@
+package middlewares
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlaceholderDimensions(t *testing.T) {
+	t.Run("should fit the whole image into placeholder size without both dimensions", func(t *testing.T) {
+		width, height, fit := placeholderDimensions(0, 0, fitCover)
+		assert.Equal(t, []any{placeholderSize, placeholderSize, fitInside}, []any{width, height, fit})
+
+		width, height, fit = placeholderDimensions(640, 0, fitCover)
+		assert.Equal(t, []any{placeholderSize, placeholderSize, fitInside}, []any{width, height, fit})
+	})
+
+	t.Run("should preserve the requested aspect ratio and fit", func(t *testing.T) {
+		width, height, fit := placeholderDimensions(1600, 900, fitCover)
+		assert.Equal(t, []any{16, 9, fitCover}, []any{width, height, fit})
+
+		width, height, fit = placeholderDimensions(100, 1000, fitContain)
+		assert.Equal(t, []any{2, 16, fitContain}, []any{width, height, fit})
+	})
+}
+
+func TestFormatHexColor(t *testing.T) {
+	assert.Equal(t, "#ff8000", formatHexColor([]float64{255, 128, 0}, false))
+	assert.Equal(t, "#ff8000", formatHexColor([]float64{254.6, 127.7, 0.2, 10}, true))
+	assert.Equal(t, "#808080", formatHexColor([]float64{128}, false))
+	assert.Equal(t, "#808080", formatHexColor([]float64{128, 255}, true))
+	assert.Equal(t, "#ff0000", formatHexColor([]float64{300, -5, 0}, false))
+	assert.Equal(t, "#000000", formatHexColor([]float64{}, false))
+}
@@ -0,0 +1,120 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// The query param with the name of the preset.
+// e.g: /__ownstak__/image?url=/image.jpg&preset=thumbnail
+const imagePresetParam = "preset"
+
+// The only query params allowed for the projects that accept just the presets.
+// The type param selects the placeholder type and it doesn't change the image itself.
+var presetsOnlyParams = map[string]bool{
+	"url":               true,
+	imagePresetParam:    true,
+	imageSignatureParam: true,
+	"type":              true,
+}
+
+// The short names of the params mapped to their long names.
+// The presets and the query can use either of them, so both are compared by the long name.
+var imageParamAliases = map[string]string{
+	"q":         "quality",
+	"w":         "width",
+	"h":         "height",
+	"f":         "format",
+	"gravity":   "position",
+	"e":         "enabled",
+	"greyscale": "grayscale",
+}
+
+// canonicalImageParam returns the long name of the given param.
+func canonicalImageParam(param string) string {
+	if canonical, ok := imageParamAliases[param]; ok {
+		return canonical
+	}
+	return param
+}
+
+// ImagePreset is the named combination of the Image Optimizer params such as w, h, q, f or fit.
+// The values can be written as JSON strings, numbers or booleans.
+//
+// Example:
+//
+//	{"w": 200, "h": 200, "fit": "cover", "q": "70"}
+type ImagePreset map[string]string
+
+// UnmarshalJSON converts the number and boolean values to strings,
+// so they're handled the same way as the query params.
+func (p *ImagePreset) UnmarshalJSON(data []byte) error {
+	values := map[string]any{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return err
+	}
+
+	preset := ImagePreset{}
+	for name, value := range values {
+		switch value := value.(type) {
+		case string:
+			preset[name] = value
+		case float64, bool:
+			preset[name] = fmt.Sprint(value)
+		default:
+			return fmt.Errorf("invalid value of preset param %s: %v", name, value)
+		}
+	}
+	*p = preset
+	return nil
+}
+
+// ImagePresets are the named presets of single project.
+// When PresetsOnly is enabled, the requests with any other params than url and preset are rejected,
+// so nobody can burn our CPU with arbitrary combinations of the params.
+//
+// Example:
+//
+//	{"presets": {"thumbnail": {"w": 200, "h": 200, "fit": "cover"}}, "presetsOnly": true}
+type ImagePresets struct {
+	Presets     map[string]ImagePreset `json:"presets"`
+	PresetsOnly bool                   `json:"presetsOnly,omitempty"`
+}
+
+// applyImagePreset returns the query with the params of the requested preset.
+// The params in the query take precedence over the preset params with the same name,
+// including their long or short variants, e.g. the query w=100 overrides the preset width=200.
+// The query is returned unchanged if there's no preset param.
+func applyImagePreset(query url.Values, presets ImagePresets) (url.Values, error) {
+	if presets.PresetsOnly {
+		for _, param := range sortedKeys(query) {
+			if !presetsOnlyParams[param] {
+				return nil, fmt.Errorf("Only presets are allowed for this project. Unsupported param: %s", param)
+			}
+		}
+	}
+
+	name := query.Get(imagePresetParam)
+	if name == "" {
+		return query, nil
+	}
+	preset, ok := presets.Presets[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown preset: %s. Available presets are: %s", name, strings.Join(sortedKeys(presets.Presets), ", "))
+	}
+
+	queryParams := map[string]bool{}
+	for param := range query {
+		queryParams[canonicalImageParam(param)] = true
+	}
+
+	merged := cloneQuery(query)
+	for param, value := range preset {
+		if !queryParams[canonicalImageParam(param)] {
+			merged.Set(param, value)
+		}
+	}
+	return merged, nil
+}
@@ -0,0 +1,85 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImagePresets(t *testing.T) {
+	presets := ImagePresets{}
+	require.NoError(t, json.Unmarshal([]byte(`{"presets": {"thumbnail": {"w": 200, "h": 200, "fit": "cover", "sharpen": true}, "hero": {"w": "1920", "q": 80}}}`), &presets))
+
+	t.Run("should parse preset values of any type", func(t *testing.T) {
+		assert.Equal(t, ImagePreset{"w": "200", "h": "200", "fit": "cover", "sharpen": "true"}, presets.Presets["thumbnail"])
+		assert.Equal(t, ImagePreset{"w": "1920", "q": "80"}, presets.Presets["hero"])
+		assert.False(t, presets.PresetsOnly)
+
+		invalid := ImagePresets{}
+		assert.Error(t, json.Unmarshal([]byte(`{"presets": {"thumbnail": {"w": [200]}}}`), &invalid))
+	})
+
+	t.Run("should return query unchanged without preset", func(t *testing.T) {
+		query := url.Values{"url": {"/image.jpg"}, "w": {"100"}}
+		merged, err := applyImagePreset(query, presets)
+		require.NoError(t, err)
+		assert.Equal(t, query, merged)
+	})
+
+	t.Run("should expand preset params", func(t *testing.T) {
+		query := url.Values{"url": {"/image.jpg"}, "preset": {"thumbnail"}}
+		merged, err := applyImagePreset(query, presets)
+		require.NoError(t, err)
+		assert.Equal(t, "200", merged.Get("w"))
+		assert.Equal(t, "cover", merged.Get("fit"))
+		assert.Equal(t, "true", merged.Get("sharpen"))
+		assert.False(t, query.Has("w"), "should not modify the original query")
+	})
+
+	t.Run("should prefer query params over preset params", func(t *testing.T) {
+		merged, err := applyImagePreset(url.Values{"url": {"/image.jpg"}, "preset": {"hero"}, "q": {"50"}}, presets)
+		require.NoError(t, err)
+		assert.Equal(t, "50", merged.Get("q"))
+		assert.Equal(t, "1920", merged.Get("w"))
+	})
+
+	t.Run("should prefer short query params over long preset params", func(t *testing.T) {
+		presets := ImagePresets{Presets: map[string]ImagePreset{"card": {"width": "200", "quality": "70", "gravity": "north"}}}
+		merged, err := applyImagePreset(url.Values{"url": {"/image.jpg"}, "preset": {"card"}, "w": {"100"}, "position": {"south"}}, presets)
+		require.NoError(t, err)
+		assert.Equal(t, "100", GetQueryParam(merged, "width", "w", ""))
+		assert.Equal(t, "south", GetQueryParam(merged, "position", "gravity", ""))
+		assert.Equal(t, "70", GetQueryParam(merged, "quality", "q", ""))
+		assert.False(t, merged.Has("width"))
+		assert.False(t, merged.Has("gravity"))
+	})
+
+	t.Run("should prefer long query params over short preset params", func(t *testing.T) {
+		merged, err := applyImagePreset(url.Values{"url": {"/image.jpg"}, "preset": {"thumbnail"}, "width": {"100"}}, presets)
+		require.NoError(t, err)
+		assert.Equal(t, "100", GetQueryParam(merged, "width", "w", ""))
+		assert.False(t, merged.Has("w"))
+	})
+
+	t.Run("should reject unknown preset", func(t *testing.T) {
+		_, err := applyImagePreset(url.Values{"url": {"/image.jpg"}, "preset": {"banner"}}, presets)
+		require.Error(t, err)
+		assert.Equal(t, "Unknown preset: banner. Available presets are: hero, thumbnail", err.Error())
+	})
+
+	t.Run("should reject other params in presets-only mode", func(t *testing.T) {
+		presetsOnly := presets
+		presetsOnly.PresetsOnly = true
+
+		_, err := applyImagePreset(url.Values{"url": {"/image.jpg"}, "preset": {"thumbnail"}, "w": {"100"}}, presetsOnly)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "Unsupported param: w")
+
+		merged, err := applyImagePreset(url.Values{"url": {"/image.jpg"}, "preset": {"thumbnail"}, "s": {"signature"}}, presetsOnly)
+		require.NoError(t, err)
+		assert.Equal(t, "200", merged.Get("w"))
+	})
+}
@@ -0,0 +1,184 @@
+package middlewares
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// How long the request can wait for a slot in the fetch or process queue
+// before it's rejected with 529 status code and Retry-After header.
+const (
+	imageQueueTimeout    = 10 * time.Second
+	imageQueueRetryAfter = "5" // seconds
+)
+
+// Each concurrent thread that processes the image consumes around 100MB of RAM memory
+// depending on image size, format etc...
+const imageProcessMemory = 100 * 1024 * 1024 // 100MB
+
+// The process queue limit is halved when the memory usage is above the shrink threshold
+// and it grows by one slot when the memory usage is below the grow threshold.
+// The fetch queue limit always follows the process queue limit.
+const (
+	imageQueueShrinkMemoryPct = 80
+	imageQueueGrowMemoryPct   = 60
+	imageQueueAdjustInterval  = 250 * time.Millisecond
+	imageFetchQueueMultiplier = 10
+)
+
+var errImageQueueTimeout = errors.New("image queue slot timeout")
+
+// imageQueue limits how many requests can fetch or process the images at the same time.
+// Unlike the buffered channel, its limit can be changed at runtime without losing the slots that are already taken.
+// The waiting requests get the slot in the FIFO order.
+type imageQueue struct {
+	mutex    sync.Mutex
+	active   int
+	limit    int
+	maxLimit int
+	waiters  []chan struct{}
+}
+
+// ImageQueueStats is the current occupancy of the queue.
+type ImageQueueStats struct {
+	Active   int `json:"active"`
+	Waiting  int `json:"waiting"`
+	Limit    int `json:"limit"`
+	MaxLimit int `json:"maxLimit"`
+}
+
+// ImageOptimizerQueueStats is the occupancy of the Image Optimizer queues.
+type ImageOptimizerQueueStats struct {
+	Fetch   ImageQueueStats `json:"fetch"`
+	Process ImageQueueStats `json:"process"`
+}
+
+// newImageQueue creates the queue with given number of slots.
+func newImageQueue(limit int) *imageQueue {
+	limit = max(1, limit)
+	return &imageQueue{limit: limit, maxLimit: limit}
+}
+
+// Acquire waits for a free slot in the queue.
+// Returns errImageQueueTimeout if there's no free slot in given time
+// or the context error if the context is cancelled before that.
+func (q *imageQueue) Acquire(ctx context.Context, timeout time.Duration) error {
+	q.mutex.Lock()
+	if q.active < q.limit && len(q.waiters) == 0 {
+		q.active++
+		q.mutex.Unlock()
+		return nil
+	}
+	// The slot is handed over to the waiter by closing its channel
+	ready := make(chan struct{})
+	q.waiters = append(q.waiters, ready)
+	q.mutex.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	var err error
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-timer.C:
+		err = errImageQueueTimeout
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	select {
+	case <-ready:
+		// We got the slot in the meantime, give it to the next one
+		q.active--
+		q.dispatch()
+	default:
+		q.removeWaiter(ready)
+	}
+	return err
+}
+
+// Release frees the slot taken by Acquire.
+func (q *imageQueue) Release() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.active--
+	q.dispatch()
+}
+
+// SetLimit changes the number of slots in the range 1..maxLimit.
+// The requests that already hold the slot over the new limit keep it until they release it.
+func (q *imageQueue) SetLimit(limit int) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.limit = min(max(1, limit), q.maxLimit)
+	q.dispatch()
+}
+
+// SetMaxLimit changes the max number of slots and resets the limit to it.
+func (q *imageQueue) SetMaxLimit(maxLimit int) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.maxLimit = max(1, maxLimit)
+	q.limit = q.maxLimit
+	q.dispatch()
+}
+
+// Limit returns the current number of slots.
+func (q *imageQueue) Limit() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.limit
+}
+
+// Stats returns the current occupancy of the queue.
+func (q *imageQueue) Stats() ImageQueueStats {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return ImageQueueStats{
+		Active:   q.active,
+		Waiting:  len(q.waiters),
+		Limit:    q.limit,
+		MaxLimit: q.maxLimit,
+	}
+}
+
+// dispatch hands over the free slots to the waiting requests. The mutex needs to be locked.
+func (q *imageQueue) dispatch() {
+	for q.active < q.limit && len(q.waiters) > 0 {
+		q.active++
+		close(q.waiters[0])
+		q.waiters = q.waiters[1:]
+	}
+}
+
+// removeWaiter removes the waiter that gave up. The mutex needs to be locked.
+func (q *imageQueue) removeWaiter(ready chan struct{}) {
+	for i, waiter := range q.waiters {
+		if waiter == ready {
+			q.waiters = append(q.waiters[:i], q.waiters[i+1:]...)
+			return
+		}
+	}
+}
+
+// nextImageQueueLimit returns the new process queue limit for the current memory usage.
+// The limit is halved quickly under memory pressure and it grows back slowly one slot at a time.
+// e.g: nextImageQueueLimit(8, 8, 900MB, 1GB) => 4
+func nextImageQueueLimit(limit, maxLimit int, usedMemory, maxMemory uint64) int {
+	if maxMemory == 0 {
+		return limit
+	}
+	switch {
+	case usedMemory >= maxMemory*imageQueueShrinkMemoryPct/100:
+		return max(1, limit/2)
+	case usedMemory < maxMemory*imageQueueGrowMemoryPct/100:
+		return min(maxLimit, limit+1)
+	default:
+		return limit
+	}
+}
@@ -0,0 +1,133 @@
+package middlewares
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImageQueue(t *testing.T) {
+	t.Run("should acquire and release slots", func(t *testing.T) {
+		queue := newImageQueue(2)
+		require.NoError(t, queue.Acquire(context.Background(), time.Second))
+		require.NoError(t, queue.Acquire(context.Background(), time.Second))
+		assert.Equal(t, ImageQueueStats{Active: 2, Waiting: 0, Limit: 2, MaxLimit: 2}, queue.Stats())
+
+		queue.Release()
+		assert.Equal(t, 1, queue.Stats().Active)
+	})
+
+	t.Run("should time out when there's no free slot", func(t *testing.T) {
+		queue := newImageQueue(1)
+		require.NoError(t, queue.Acquire(context.Background(), time.Second))
+
+		err := queue.Acquire(context.Background(), 10*time.Millisecond)
+		assert.Equal(t, errImageQueueTimeout, err)
+		assert.Equal(t, ImageQueueStats{Active: 1, Waiting: 0, Limit: 1, MaxLimit: 1}, queue.Stats())
+	})
+
+	t.Run("should stop waiting when the context is cancelled", func(t *testing.T) {
+		queue := newImageQueue(1)
+		require.NoError(t, queue.Acquire(context.Background(), time.Second))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		err := queue.Acquire(ctx, time.Second)
+		assert.Equal(t, context.Canceled, err)
+		assert.Equal(t, 0, queue.Stats().Waiting)
+	})
+
+	t.Run("should hand over released slot to waiting request", func(t *testing.T) {
+		queue := newImageQueue(1)
+		require.NoError(t, queue.Acquire(context.Background(), time.Second))
+
+		acquired := make(chan error)
+		go func() { acquired <- queue.Acquire(context.Background(), time.Second) }()
+		assert.Eventually(t, func() bool { return queue.Stats().Waiting == 1 }, time.Second, time.Millisecond)
+
+		queue.Release()
+		require.NoError(t, <-acquired)
+		assert.Equal(t, ImageQueueStats{Active: 1, Waiting: 0, Limit: 1, MaxLimit: 1}, queue.Stats())
+	})
+
+	t.Run("should wake up waiting requests when the limit grows", func(t *testing.T) {
+		queue := newImageQueue(2)
+		queue.SetLimit(1)
+		require.NoError(t, queue.Acquire(context.Background(), time.Second))
+
+		acquired := make(chan error)
+		go func() { acquired <- queue.Acquire(context.Background(), time.Second) }()
+		assert.Eventually(t, func() bool { return queue.Stats().Waiting == 1 }, time.Second, time.Millisecond)
+
+		queue.SetLimit(2)
+		require.NoError(t, <-acquired)
+		assert.Equal(t, 2, queue.Stats().Active)
+	})
+
+	t.Run("should keep the limit between 1 and max limit", func(t *testing.T) {
+		queue := newImageQueue(4)
+		queue.SetLimit(10)
+		assert.Equal(t, 4, queue.Limit())
+		queue.SetLimit(0)
+		assert.Equal(t, 1, queue.Limit())
+
+		queue.SetMaxLimit(8)
+		assert.Equal(t, ImageQueueStats{Active: 0, Waiting: 0, Limit: 8, MaxLimit: 8}, queue.Stats())
+	})
+
+	t.Run("should not start new requests over shrunk limit", func(t *testing.T) {
+		queue := newImageQueue(2)
+		require.NoError(t, queue.Acquire(context.Background(), time.Second))
+		require.NoError(t, queue.Acquire(context.Background(), time.Second))
+		queue.SetLimit(1)
+
+		queue.Release()
+		assert.Equal(t, errImageQueueTimeout, queue.Acquire(context.Background(), 10*time.Millisecond))
+		queue.Release()
+		assert.NoError(t, queue.Acquire(context.Background(), time.Second))
+	})
+}
+
+func TestNextImageQueueLimit(t *testing.T) {
+	const maxMemory = 1000
+
+	t.Run("should halve the limit under memory pressure", func(t *testing.T) {
+		assert.Equal(t, 4, nextImageQueueLimit(8, 8, 800, maxMemory))
+		assert.Equal(t, 1, nextImageQueueLimit(1, 8, 950, maxMemory))
+	})
+
+	t.Run("should grow the limit when there's enough free memory", func(t *testing.T) {
+		assert.Equal(t, 5, nextImageQueueLimit(4, 8, 500, maxMemory))
+		assert.Equal(t, 8, nextImageQueueLimit(8, 8, 100, maxMemory))
+	})
+
+	t.Run("should keep the limit between thresholds", func(t *testing.T) {
+		assert.Equal(t, 4, nextImageQueueLimit(4, 8, 700, maxMemory))
+	})
+
+	t.Run("should keep the limit without max memory", func(t *testing.T) {
+		assert.Equal(t, 4, nextImageQueueLimit(4, 8, 700, 0))
+	})
+}
+
+func TestImageOptimizerQueues(t *testing.T) {
+	t.Run("should adjust queue limits to memory usage", func(t *testing.T) {
+		middleware := &ImageOptimizerMiddleware{
+			fetchQueue:   newImageQueue(40),
+			processQueue: newImageQueue(4),
+		}
+
+		middleware.adjustQueues(900, 1000)
+		assert.Equal(t, ImageOptimizerQueueStats{
+			Fetch:   ImageQueueStats{Limit: 20, MaxLimit: 40},
+			Process: ImageQueueStats{Limit: 2, MaxLimit: 4},
+		}, middleware.QueueStats())
+
+		middleware.adjustQueues(100, 1000)
+		assert.Equal(t, 30, middleware.fetchQueue.Limit())
+		assert.Equal(t, 3, middleware.processQueue.Limit())
+	})
+}
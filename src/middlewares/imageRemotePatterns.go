@@ -0,0 +1,198 @@
+package middlewares
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"ownstak-proxy/src/utils"
+)
+
+// Maximum number of redirects the Image Optimizer follows when fetching the source image.
+// It's the same as the default of Next.js images.maximumRedirects option.
+const maxImageRedirects = 3
+
+// ImageRemotePattern describes the remote images the Image Optimizer is allowed to fetch
+// in addition to the images from the same domain. It has the same semantics as Next.js images.remotePatterns option.
+// The hostname supports "*" wildcard for single subdomain and "**" for any number of subdomains.
+// The pathname supports "*" wildcard for single path segment and "**" for any number of path segments.
+// The empty protocol and pathname, or missing port and search match any value.
+//
+// Example:
+//
+//	{"protocol": "https", "hostname": "**.amazonaws.com", "pathname": "/my-bucket/**"}
+type ImageRemotePattern struct {
+	Protocol string  `json:"protocol,omitempty"`
+	Hostname string  `json:"hostname"`
+	Port     *string `json:"port,omitempty"`
+	Pathname string  `json:"pathname,omitempty"`
+	Search   *string `json:"search,omitempty"`
+}
+
+// Match returns true if the URL matches the remote pattern.
+func (p ImageRemotePattern) Match(u *url.URL) bool {
+	if p.Hostname == "" {
+		return false
+	}
+	if p.Protocol != "" && !strings.EqualFold(strings.TrimSuffix(p.Protocol, ":"), u.Scheme) {
+		return false
+	}
+	if p.Port != nil && *p.Port != u.Port() {
+		return false
+	}
+	if !utils.MatchHost(p.Hostname, u.Hostname()) {
+		return false
+	}
+	if p.Search != nil {
+		search := ""
+		if u.RawQuery != "" {
+			search = "?" + u.RawQuery
+		}
+		if *p.Search != search {
+			return false
+		}
+	}
+	pathname := p.Pathname
+	if pathname == "" {
+		pathname = "**"
+	}
+	return utils.MatchPattern(pathname, u.EscapedPath(), '/')
+}
+
+// imageFetchPolicy decides which URLs the Image Optimizer can fetch the source images from.
+// The policy is passed to the fetch client in the request context,
+// so it can check the redirects and resolved IP addresses too.
+type imageFetchPolicy struct {
+	// The host of the project. The images from the same host are always allowed.
+	host string
+	// The allowed remote images
+	remotePatterns []ImageRemotePattern
+}
+
+type imageFetchPolicyKey struct{}
+
+// Allows returns true if the source image can be fetched from given URL.
+func (p *imageFetchPolicy) Allows(u *url.URL) bool {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	}
+	if p.isSameHost(u.Host) {
+		return true
+	}
+	for _, pattern := range p.remotePatterns {
+		if pattern.Match(u) {
+			return true
+		}
+	}
+	return false
+}
+
+// isSameHost returns true if given host (with or without port) is the host of the project.
+func (p *imageFetchPolicy) isSameHost(host string) bool {
+	return strings.EqualFold(host, p.host) || strings.EqualFold(stripPort(host), stripPort(p.host))
+}
+
+// checkImageRedirect limits the number of redirects
+// and doesn't allow to redirect to the URLs that are not allowed by the fetch policy.
+func checkImageRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) > maxImageRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxImageRedirects)
+	}
+	if policy, ok := req.Context().Value(imageFetchPolicyKey{}).(*imageFetchPolicy); ok && !policy.Allows(req.URL) {
+		return newImageFetchPolicyError("redirect to %s is not allowed", req.URL.Redacted())
+	}
+	return nil
+}
+
+// newImageDialContext returns the dial function that blocks connections to private, loopback and link-local IPs
+// for remote images after the DNS resolution, so the allowed hostnames can't point to the internal network.
+// The connections to the project host are not restricted as they go through our proxy/CDN anyway.
+func newImageDialContext() func(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		policy, ok := ctx.Value(imageFetchPolicyKey{}).(*imageFetchPolicy)
+		if !ok || policy.isSameHost(addr) {
+			return dialer.DialContext(ctx, network, addr)
+		}
+
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		if len(ips) == 0 {
+			return nil, fmt.Errorf("no IP addresses found for %s", host)
+		}
+		for _, ip := range ips {
+			if isBlockedImageIP(ip.IP) {
+				return nil, newImageFetchPolicyError("host %s resolves to the blocked IP address %s", host, ip.IP)
+			}
+		}
+
+		// Connect to the resolved IP, so the DNS can't return different IP in the meantime
+		return dialer.DialContext(ctx, network, net.JoinHostPort(ips[0].IP.String(), port))
+	}
+}
+
+// Carrier-grade NAT range isn't covered by net.IP.IsPrivate
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// The special-purpose IPv4 ranges that aren't covered by net.IP methods either:
+// "this network", IETF protocol assignments, benchmarking and reserved ranges.
+var reservedAddressSpaces = []*net.IPNet{
+	{IP: net.IPv4(0, 0, 0, 0), Mask: net.CIDRMask(8, 32)},
+	{IP: net.IPv4(192, 0, 0, 0), Mask: net.CIDRMask(24, 32)},
+	{IP: net.IPv4(198, 18, 0, 0), Mask: net.CIDRMask(15, 32)},
+	{IP: net.IPv4(240, 0, 0, 0), Mask: net.CIDRMask(4, 32)},
+}
+
+// The NAT64 well-known prefix embeds the IPv4 address in the last 4 bytes,
+// e.g: 64:ff9b::a9fe:a9fe => 169.254.169.254
+var nat64AddressSpace = &net.IPNet{IP: net.ParseIP("64:ff9b::"), Mask: net.CIDRMask(96, 128)}
+
+// The local-use NAT64 prefix can embed the IPv4 address at any position chosen by the network operator,
+// so the whole range is blocked.
+var nat64LocalAddressSpace = &net.IPNet{IP: net.ParseIP("64:ff9b:1::"), Mask: net.CIDRMask(48, 128)}
+
+// isBlockedImageIP returns true if the IP address points to the internal network
+// such as private, loopback, link-local (cloud metadata endpoints), reserved or unspecified addresses.
+// The NAT64 addresses are blocked if the embedded IPv4 address is blocked.
+func isBlockedImageIP(ip net.IP) bool {
+	if nat64AddressSpace.Contains(ip) {
+		return isBlockedImageIP(net.IP(ip[12:16]))
+	}
+	for _, reserved := range reservedAddressSpaces {
+		if reserved.Contains(ip) {
+			return true
+		}
+	}
+	return nat64LocalAddressSpace.Contains(ip) ||
+		ip.IsPrivate() ||
+		ip.IsLoopback() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() ||
+		ip.IsUnspecified() ||
+		sharedAddressSpace.Contains(ip)
+}
+
+// stripPort returns the host without the port.
+// e.g: stripPort("example.com:443") => "example.com"
+func stripPort(host string) string {
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		return hostname
+	}
+	return host
+}
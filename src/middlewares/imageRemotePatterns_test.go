@@ -0,0 +1,167 @@
+package middlewares
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"ownstak-proxy/src/constants"
+	"ownstak-proxy/src/server"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImageRemotePattern(t *testing.T) {
+	match := func(pattern ImageRemotePattern, rawURL string) bool {
+		parsedURL, err := url.Parse(rawURL)
+		require.NoError(t, err)
+		return pattern.Match(parsedURL)
+	}
+	ptr := func(value string) *string { return &value }
+
+	t.Run("should match hostname wildcards", func(t *testing.T) {
+		pattern := ImageRemotePattern{Hostname: "*.example.com"}
+		assert.True(t, match(pattern, "https://cdn.example.com/image.jpg"))
+		assert.False(t, match(pattern, "https://a.cdn.example.com/image.jpg"))
+		assert.False(t, match(pattern, "https://example.com/image.jpg"))
+
+		pattern = ImageRemotePattern{Hostname: "**.example.com"}
+		assert.True(t, match(pattern, "https://a.cdn.example.com/image.jpg"))
+		assert.False(t, match(pattern, "https://example.org/image.jpg"))
+	})
+
+	t.Run("should match protocol, port and search", func(t *testing.T) {
+		pattern := ImageRemotePattern{Protocol: "https", Hostname: "cdn.example.com"}
+		assert.True(t, match(pattern, "https://cdn.example.com/image.jpg"))
+		assert.False(t, match(pattern, "http://cdn.example.com/image.jpg"))
+
+		pattern = ImageRemotePattern{Hostname: "cdn.example.com", Port: ptr("")}
+		assert.True(t, match(pattern, "https://cdn.example.com/image.jpg"))
+		assert.False(t, match(pattern, "https://cdn.example.com:8080/image.jpg"))
+
+		pattern = ImageRemotePattern{Hostname: "cdn.example.com", Search: ptr("?v=1")}
+		assert.True(t, match(pattern, "https://cdn.example.com/image.jpg?v=1"))
+		assert.False(t, match(pattern, "https://cdn.example.com/image.jpg?v=2"))
+	})
+
+	t.Run("should match pathname wildcards", func(t *testing.T) {
+		pattern := ImageRemotePattern{Hostname: "s3.amazonaws.com", Pathname: "/my-bucket/**"}
+		assert.True(t, match(pattern, "https://s3.amazonaws.com/my-bucket/images/image.jpg"))
+		assert.False(t, match(pattern, "https://s3.amazonaws.com/other-bucket/image.jpg"))
+
+		pattern = ImageRemotePattern{Hostname: "s3.amazonaws.com", Pathname: "/my-bucket/*"}
+		assert.True(t, match(pattern, "https://s3.amazonaws.com/my-bucket/image.jpg"))
+		assert.False(t, match(pattern, "https://s3.amazonaws.com/my-bucket/images/image.jpg"))
+	})
+
+	t.Run("should not match pattern without hostname", func(t *testing.T) {
+		assert.False(t, match(ImageRemotePattern{}, "https://cdn.example.com/image.jpg"))
+	})
+}
+
+func TestImageFetchPolicy(t *testing.T) {
+	policy := &imageFetchPolicy{
+		host:           "my-app.ownstak.link",
+		remotePatterns: []ImageRemotePattern{{Protocol: "https", Hostname: "cdn.example.com"}},
+	}
+	allows := func(rawURL string) bool {
+		parsedURL, err := url.Parse(rawURL)
+		require.NoError(t, err)
+		return policy.Allows(parsedURL)
+	}
+
+	t.Run("should allow same host and remote patterns", func(t *testing.T) {
+		assert.True(t, allows("https://my-app.ownstak.link/image.jpg"))
+		assert.True(t, allows("http://my-app.ownstak.link:8080/image.jpg"))
+		assert.True(t, allows("https://cdn.example.com/image.jpg"))
+	})
+
+	t.Run("should reject other hosts and schemes", func(t *testing.T) {
+		assert.False(t, allows("https://other.ownstak.link/image.jpg"))
+		assert.False(t, allows("http://cdn.example.com/image.jpg"))
+		assert.False(t, allows("file:///etc/passwd"))
+	})
+
+	t.Run("should limit redirects to allowed URLs", func(t *testing.T) {
+		ctx := context.WithValue(context.Background(), imageFetchPolicyKey{}, policy)
+		newRequest := func(rawURL string) *http.Request {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+			require.NoError(t, err)
+			return req
+		}
+
+		via := []*http.Request{newRequest("https://my-app.ownstak.link/image.jpg")}
+		assert.NoError(t, checkImageRedirect(newRequest("https://cdn.example.com/image.jpg"), via))
+		assert.Error(t, checkImageRedirect(newRequest("http://169.254.169.254/latest/meta-data"), via))
+
+		for len(via) <= maxImageRedirects {
+			via = append(via, via[0])
+		}
+		assert.Error(t, checkImageRedirect(newRequest("https://cdn.example.com/image.jpg"), via))
+	})
+
+	t.Run("should block connections to internal IPs of remote hosts", func(t *testing.T) {
+		dial := newImageDialContext()
+		ctx := context.WithValue(context.Background(), imageFetchPolicyKey{}, policy)
+
+		_, err := dial(ctx, "tcp", "127.0.0.1:80")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "blocked IP address")
+
+		_, err = dial(ctx, "tcp", "localhost:80")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "blocked IP address")
+	})
+}
+
+func TestIsBlockedImageIP(t *testing.T) {
+	for _, ip := range []string{"127.0.0.1", "10.0.0.1", "172.16.0.1", "192.168.1.1", "169.254.169.254", "100.64.0.1", "0.0.0.0", "::1", "fe80::1", "fd00::1", "::ffff:127.0.0.1",
+		"0.1.2.3", "192.0.0.170", "198.18.0.1", "198.19.255.255", "240.0.0.1", "255.255.255.255",
+		"64:ff9b::a9fe:a9fe", "64:ff9b::7f00:1", "64:ff9b::a00:1", "64:ff9b:1::808:808"} {
+		assert.True(t, isBlockedImageIP(net.ParseIP(ip)), ip)
+	}
+	for _, ip := range []string{"8.8.8.8", "1.1.1.1", "2606:4700:4700::1111", "198.20.0.1", "192.0.1.1", "64:ff9b::808:808"} {
+		assert.False(t, isBlockedImageIP(net.ParseIP(ip)), ip)
+	}
+}
+
+func TestImageOptimizerRemotePatterns(t *testing.T) {
+	originalMode := constants.Mode
+	constants.Mode = "production"
+	defer func() { constants.Mode = originalMode }()
+
+	middleware := &ImageOptimizerMiddleware{
+		enabled:       true,
+		defaultFormat: defaultFormat,
+		remotePatterns: map[string][]ImageRemotePattern{
+			"*.ownstak.link": {{Protocol: "https", Hostname: "cdn.example.com"}},
+		},
+	}
+
+	run := func(t *testing.T, path string) *server.RequestContext {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Host = "my-app.ownstak.link"
+		res := httptest.NewRecorder()
+
+		serverReq, err := server.NewRequest(req)
+		require.NoError(t, err)
+		serverRes := server.NewResponse(res)
+		ctx := server.NewRequestContext(serverReq, serverRes, nil)
+
+		middleware.OnRequest(ctx, func() {})
+		return ctx
+	}
+
+	t.Run("should reject images from not allowed hosts in production mode", func(t *testing.T) {
+		ctx := run(t, "/__ownstak__/image?url=https://other.example.com/image.jpg")
+		assert.Equal(t, http.StatusBadRequest, ctx.Response.Status)
+		assert.Contains(t, string(ctx.Response.Body), "allowed remote patterns")
+
+		ctx = run(t, "/__ownstak__/image?url=http://cdn.example.com/image.jpg")
+		assert.Equal(t, http.StatusBadRequest, ctx.Response.Status)
+	})
+}
@@ -0,0 +1,114 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"ownstak-proxy/src/server"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignImageURL(t *testing.T) {
+	t.Run("should sign the url and verify the signature", func(t *testing.T) {
+		signedURL, err := SignImageURL("secret", "/__ownstak__/image?url=/image.jpg&w=100&q=80")
+		require.NoError(t, err)
+
+		parsedURL, err := url.Parse(signedURL)
+		require.NoError(t, err)
+		assert.NotEmpty(t, parsedURL.Query().Get(imageSignatureParam))
+		assert.True(t, verifyImageSignature("secret", parsedURL.Path, parsedURL.Query()))
+		assert.True(t, verifyImageSignature("secret", parsedURL.Path+"/", parsedURL.Query()))
+	})
+
+	t.Run("should not depend on the order of params", func(t *testing.T) {
+		first, err := SignImageURL("secret", "/__ownstak__/image?url=/image.jpg&w=100")
+		require.NoError(t, err)
+		second, err := SignImageURL("secret", "/__ownstak__/image?w=100&url=/image.jpg")
+		require.NoError(t, err)
+		assert.Equal(t, first, second)
+	})
+
+	t.Run("should reject tampered or unsigned params", func(t *testing.T) {
+		signedURL, err := SignImageURL("secret", "/__ownstak__/image?url=/image.jpg&w=100")
+		require.NoError(t, err)
+		parsedURL, err := url.Parse(signedURL)
+		require.NoError(t, err)
+
+		query := parsedURL.Query()
+		assert.False(t, verifyImageSignature("other-secret", parsedURL.Path, query))
+		assert.False(t, verifyImageSignature("secret", "/__ownstak__/image/srcset", query))
+
+		query.Set("w", "3840")
+		assert.False(t, verifyImageSignature("secret", parsedURL.Path, query))
+
+		query.Del(imageSignatureParam)
+		assert.False(t, verifyImageSignature("secret", parsedURL.Path, query))
+	})
+
+	t.Run("should return error for invalid url", func(t *testing.T) {
+		_, err := SignImageURL("secret", "://invalid")
+		assert.Error(t, err)
+	})
+}
+
+func TestImageOptimizerSignedURLs(t *testing.T) {
+	middleware := &ImageOptimizerMiddleware{
+		signingSecrets: map[string]string{"*.signed.com": "secret"},
+	}
+
+	run := func(t *testing.T, host string, path string) *server.RequestContext {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Host = host
+		res := httptest.NewRecorder()
+
+		serverReq, err := server.NewRequest(req)
+		require.NoError(t, err)
+		serverRes := server.NewResponse(res)
+		ctx := server.NewRequestContext(serverReq, serverRes, nil)
+
+		middleware.OnRequest(ctx, func() {})
+		return ctx
+	}
+
+	t.Run("should reject unsigned requests", func(t *testing.T) {
+		ctx := run(t, "project.signed.com", "/__ownstak__/image?url=/image.jpg&w=100")
+		assert.Equal(t, http.StatusForbidden, ctx.Response.Status)
+		assert.Contains(t, string(ctx.Response.Body), "invalid signature")
+	})
+
+	t.Run("should reject tampered requests", func(t *testing.T) {
+		signedURL, err := SignImageURL("secret", "/__ownstak__/image?url=/image.jpg&w=100")
+		require.NoError(t, err)
+
+		ctx := run(t, "project.signed.com", signedURL+"&h=3840")
+		assert.Equal(t, http.StatusForbidden, ctx.Response.Status)
+	})
+
+	t.Run("should accept signed srcset requests and sign returned urls", func(t *testing.T) {
+		signedURL, err := SignImageURL("secret", "/__ownstak__/image/srcset?url=/image.jpg&widths=640,1080")
+		require.NoError(t, err)
+
+		ctx := run(t, "project.signed.com", signedURL)
+		require.Equal(t, http.StatusOK, ctx.Response.Status)
+
+		var srcset ImageSrcsetResponse
+		require.NoError(t, json.Unmarshal(ctx.Response.Body, &srcset))
+		require.Len(t, srcset.Sources, 2)
+		for _, source := range srcset.Sources {
+			parsedURL, err := url.Parse(source.URL)
+			require.NoError(t, err)
+			assert.True(t, verifyImageSignature("secret", parsedURL.Path, parsedURL.Query()))
+			assert.Contains(t, srcset.Srcset, source.URL)
+		}
+	})
+
+	t.Run("should not require signature for hosts without secret", func(t *testing.T) {
+		ctx := run(t, "project.unsigned.com", "/__ownstak__/image/srcset?url=/image.jpg&widths=640")
+		assert.Equal(t, http.StatusOK, ctx.Response.Status)
+	})
+}
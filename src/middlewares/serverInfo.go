@@ -39,6 +39,8 @@ type ServerInfoResponse struct {
 	Uptime       time.Duration `json:"uptime"`
 	UptimeString string        `json:"uptimeString"`
 	System       SystemInfo    `json:"system"`
+	// The supported formats and occupancy of queues, if the Image Optimizer is enabled
+	ImageOptimizer *ImageOptimizerInfo `json:"imageOptimizer,omitempty"`
 }
 
 // ServerInfoMiddleware provides information about the server
@@ -108,6 +110,16 @@ func (m *ServerInfoMiddleware) OnRequest(ctx *server.RequestContext, next func()
 		},
 	}
 
+	// Add the supported formats and current occupancy of Image Optimizer queues
+	if s.MiddlewaresChain != nil {
+		for i := 0; i < s.MiddlewaresChain.Count(); i++ {
+			if imageOptimizer, ok := s.MiddlewaresChain.GetMiddleware(i).(*ImageOptimizerMiddleware); ok && imageOptimizer.enabled {
+				imageOptimizerInfo := imageOptimizer.Info()
+				info.ImageOptimizer = &imageOptimizerInfo
+			}
+		}
+	}
+
 	// Convert to JSON
 	jsonData, err := json.MarshalIndent(info, "", "  ")
 	if err != nil {
@@ -1,15 +1,18 @@
 package middlewares
 
 import (
+	"context"
 	"encoding/json"
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
 	"ownstak-proxy/src/constants"
 	"ownstak-proxy/src/server"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestServerInfoMiddleware(t *testing.T) {
@@ -82,6 +85,43 @@ func TestServerInfoMiddleware(t *testing.T) {
 		assert.Greater(t, info.System.GoroutinesCount, 0, "goroutines count should be positive")
 	})
 
+	t.Run("should return image optimizer info", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/__ownstak__/info", nil)
+		res := httptest.NewRecorder()
+
+		serverReq, _ := server.NewRequest(req)
+		serverRes := server.NewResponse(res)
+
+		// Create a mock server with the enabled image optimizer
+		srv := server.NewServer()
+		imageOptimizer := &ImageOptimizerMiddleware{
+			enabled:      true,
+			fetchQueue:   newImageQueue(20),
+			processQueue: newImageQueue(2),
+		}
+		imageOptimizer.processQueue.Acquire(context.Background(), time.Second)
+		srv.MiddlewaresChain.Add(imageOptimizer)
+		ctx := &server.RequestContext{
+			Request:  serverReq,
+			Response: serverRes,
+			Server:   srv,
+		}
+
+		middleware := NewServerInfoMiddleware()
+		middleware.OnRequest(ctx, func() {})
+
+		var info ServerInfoResponse
+		err := json.Unmarshal(ctx.Response.Body, &info)
+		assert.NoError(t, err, "response should be valid JSON")
+		require.NotNil(t, info.ImageOptimizer)
+		assert.NotNil(t, info.ImageOptimizer.InputFormats)
+		assert.NotNil(t, info.ImageOptimizer.OutputFormats)
+		assert.Equal(t, ImageOptimizerQueueStats{
+			Fetch:   ImageQueueStats{Active: 0, Waiting: 0, Limit: 20, MaxLimit: 20},
+			Process: ImageQueueStats{Active: 1, Waiting: 0, Limit: 2, MaxLimit: 2},
+		}, info.ImageOptimizer.Queues)
+	})
+
 	t.Run("should not call next for info endpoint", func(t *testing.T) {
 		// Set required environment variable
 		os.Setenv(constants.EnvProvider, "test")
@@ -11,6 +11,8 @@ const (
 	HeaderLocation           = "Location"
 	HeaderHost               = "Host"
 	HeaderAccept             = "Accept"
+	HeaderAcceptEncoding     = "Accept-Encoding"
+	HeaderVary               = "Vary"
 	HeaderRequestID          = "X-Request-ID"
 	HeaderUserAgent          = "User-Agent"
 	HeaderXForwardedHost     = "X-Forwarded-Host"
@@ -22,7 +24,13 @@ const (
 	HeaderContentRange       = "Content-Range"
 	HeaderETag               = "ETag"
 	HeaderLastModified       = "Last-Modified"
+	HeaderIfNoneMatch        = "If-None-Match"
+	HeaderIfModifiedSince    = "If-Modified-Since"
+	HeaderIfRange            = "If-Range"
+	HeaderRange              = "Range"
+	HeaderSetCookie          = "Set-Cookie"
 	HeaderExpires            = "Expires"
+	HeaderDate               = "Date"
 	HeaderServer             = "Server"
 	HeaderRetryAfter         = "Retry-After"
 	HeaderServerTiming       = "Server-Timing"
@@ -33,9 +41,12 @@ const (
 	HeaderXOwnProxyVersion   = "X-Own-Proxy-Version"   // Present in req/res headers when the request is proxied
 	HeaderXOwnHost           = "X-Own-Host"            // Works as replacement for Host header and preffered way of specifying the host for the proxy in the req
 	HeaderXOwnStreaming      = "X-Own-Streaming"       // "true" or "false" - tells the ownstak-cli whatever it can return response in streaming format.
+	HeaderXOwnCompression    = "X-Own-Compression"     // e.g. "gzip,br" - tells the ownstak-cli which compressions of the response body the proxy can handle. The compressed body needs to be flagged in the response head.
 	HeaderXOwnMergeHeaders   = "X-Own-Merge-Headers"   // When present in the req, the proxy will merge the headers from the original headers when following a redirect
 	HeaderXOwnMergeStatus    = "X-Own-Merge-Status"    // When present in the req, the proxy will merge the status code from the original headers when following a redirect
 	HeaderXOwnFollowRedirect = "X-Own-Follow-Redirect" // When detected in the res from lambda, the proxy will follow the redirect
+	HeaderXOwnWarmup         = "X-Own-Warmup"          // Present in the req when the proxy sends warm-up ping invocation to the lambda function. The function should return right away
+	HeaderXOwnApiToken       = "X-Own-Api-Token"       // Secret token that authorizes the req to internal management endpoints. See INTERNAL_API_TOKEN env variable
 
 	HeaderXOwnDebug      = "X-Own-Debug"       // Requests debug headers for all the OwnStak components when present in the req (proxy, project etc...)
 	HeaderXOwnProxyDebug = "X-Own-Proxy-Debug" // Requests debug header just for the proxy when present in the req and as result, the proxy returns the same header in the res with the debug information
@@ -12,6 +12,7 @@ import (
 	"ownstak-proxy/src/logger"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type Request struct {
@@ -297,3 +298,70 @@ func (req *Request) ContentLength() (int, error) {
 	}
 	return contentLength, nil
 }
+
+// AcceptsEncoding returns true if the client accepts the given content encoding
+// based on the Accept-Encoding header. e.g: gzip, deflate, br;q=0.9
+func (req *Request) AcceptsEncoding(encoding string) bool {
+	encoding = strings.ToLower(encoding)
+	wildcardAccepted := false
+
+	for _, part := range strings.Split(strings.Join(req.Headers.Values(HeaderAcceptEncoding), ","), ",") {
+		params := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(params[0]))
+
+		// The encoding with q=0 is explicitly refused by the client
+		accepted := true
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil && q <= 0 {
+					accepted = false
+				}
+			}
+		}
+
+		if name == encoding {
+			return accepted
+		}
+		if name == "*" {
+			wildcardAccepted = accepted
+		}
+	}
+
+	return wildcardAccepted
+}
+
+// IsNotModified returns true if the client already has the current version of the response
+// based on the If-None-Match and If-Modified-Since headers, so it can be answered with 304 Not Modified.
+// The If-None-Match header takes precedence over If-Modified-Since when both are present.
+// See: https://www.rfc-editor.org/rfc/rfc9110#section-13.2.2
+func (req *Request) IsNotModified(etag string, lastModified time.Time) bool {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+
+	if ifNoneMatch := req.Headers.Get(HeaderIfNoneMatch); ifNoneMatch != "" {
+		if etag == "" {
+			return false
+		}
+		for _, candidate := range strings.Split(ifNoneMatch, ",") {
+			candidate = strings.TrimSpace(candidate)
+			// Use weak comparison, W/"abc" matches "abc"
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	if ifModifiedSince := req.Headers.Get(HeaderIfModifiedSince); ifModifiedSince != "" && !lastModified.IsZero() {
+		since, err := http.ParseTime(ifModifiedSince)
+		if err != nil {
+			return false
+		}
+		// The HTTP dates have just one second precision
+		return !lastModified.Truncate(time.Second).After(since)
+	}
+
+	return false
+}
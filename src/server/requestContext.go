@@ -1,6 +1,7 @@
 package server
 
 import (
+	"crypto/subtle"
 	"encoding/json"
 	"fmt"
 	"html"
@@ -310,6 +311,21 @@ func (ctx *RequestContext) Debug(value string) bool {
 	return true
 }
 
+// IsAuthorized returns true if the request carries X-Own-Api-Token header
+// matching the INTERNAL_API_TOKEN env variable.
+// Internal management endpoints are always unauthorized when the INTERNAL_API_TOKEN is not set.
+// @example: if !ctx.IsAuthorized() { ctx.Error("Unauthorized", StatusUnauthorized); return }
+func (ctx *RequestContext) IsAuthorized() bool {
+	apiToken := utils.GetEnv(constants.EnvInternalApiToken)
+	reqApiToken := ctx.Request.Headers.Get(HeaderXOwnApiToken)
+	if apiToken == "" || reqApiToken == "" {
+		return false
+	}
+
+	// Use constant time comparison, so the token cannot be guessed by measuring response times
+	return subtle.ConstantTimeCompare([]byte(apiToken), []byte(reqApiToken)) == 1
+}
+
 // CloseConnection immediately closes the TCP connection to indicate the response is broken
 // This sends a TCP RST (reset) packet to the browser, signaling that the connection
 // should be terminated abnormally and the response is invalid/incomplete.
@@ -2,6 +2,7 @@ package server
 
 import (
 	"net/http"
+	"ownstak-proxy/src/constants"
 	"strings"
 	"testing"
 
@@ -144,4 +145,39 @@ func TestRequestContext(t *testing.T) {
 		})
 
 	})
+
+	t.Run("IsAuthorized", func(t *testing.T) {
+		createContext := func(apiToken string) *RequestContext {
+			req, err := http.NewRequest("POST", "http://example.com/__ownstak__/lambda/cache/flush", nil)
+			assert.NoError(t, err)
+			if apiToken != "" {
+				req.Header.Set(HeaderXOwnApiToken, apiToken)
+			}
+
+			serverReq, err := NewRequest(req)
+			assert.NoError(t, err)
+			return NewRequestContext(serverReq, NewResponse(), nil)
+		}
+
+		t.Run("should return true when the token matches", func(t *testing.T) {
+			t.Setenv(constants.EnvInternalApiToken, "secret-token")
+			assert.True(t, createContext("secret-token").IsAuthorized())
+		})
+
+		t.Run("should return false when the token doesn't match", func(t *testing.T) {
+			t.Setenv(constants.EnvInternalApiToken, "secret-token")
+			assert.False(t, createContext("wrong-token").IsAuthorized())
+		})
+
+		t.Run("should return false when the token is missing in the request", func(t *testing.T) {
+			t.Setenv(constants.EnvInternalApiToken, "secret-token")
+			assert.False(t, createContext("").IsAuthorized())
+		})
+
+		t.Run("should return false when the INTERNAL_API_TOKEN is not set", func(t *testing.T) {
+			t.Setenv(constants.EnvInternalApiToken, "")
+			assert.False(t, createContext("").IsAuthorized())
+			assert.False(t, createContext("secret-token").IsAuthorized())
+		})
+	})
 }
@@ -8,6 +8,7 @@ import (
 	"ownstak-proxy/src/constants"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -794,4 +795,83 @@ func TestRequest(t *testing.T) {
 			})
 		})
 	})
+
+	t.Run("AcceptsEncoding", func(t *testing.T) {
+		newRequestWithAcceptEncoding := func(acceptEncoding string) *Request {
+			req, _ := http.NewRequest("GET", "http://example.com/", nil)
+			if acceptEncoding != "" {
+				req.Header.Set(HeaderAcceptEncoding, acceptEncoding)
+			}
+			serverReq, _ := NewRequest(req)
+			return serverReq
+		}
+
+		t.Run("should accept listed encodings", func(t *testing.T) {
+			req := newRequestWithAcceptEncoding("gzip, deflate, BR")
+			assert.True(t, req.AcceptsEncoding("gzip"))
+			assert.True(t, req.AcceptsEncoding("br"))
+			assert.False(t, req.AcceptsEncoding("zstd"))
+		})
+
+		t.Run("should not accept encodings with zero quality", func(t *testing.T) {
+			req := newRequestWithAcceptEncoding("gzip;q=0.8, br;q=0")
+			assert.True(t, req.AcceptsEncoding("gzip"))
+			assert.False(t, req.AcceptsEncoding("br"))
+		})
+
+		t.Run("should accept any encoding with wildcard", func(t *testing.T) {
+			req := newRequestWithAcceptEncoding("*;q=0.1, gzip;q=0")
+			assert.True(t, req.AcceptsEncoding("br"))
+			assert.False(t, req.AcceptsEncoding("gzip"))
+		})
+
+		t.Run("should not accept any encoding without header", func(t *testing.T) {
+			req := newRequestWithAcceptEncoding("")
+			assert.False(t, req.AcceptsEncoding("gzip"))
+		})
+	})
+
+	t.Run("IsNotModified", func(t *testing.T) {
+		lastModified := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+		newConditionalRequest := func(method string, headers map[string]string) *Request {
+			req, _ := http.NewRequest(method, "http://example.com/", nil)
+			for key, value := range headers {
+				req.Header.Set(key, value)
+			}
+			serverReq, _ := NewRequest(req)
+			return serverReq
+		}
+
+		t.Run("should match If-None-Match etag", func(t *testing.T) {
+			req := newConditionalRequest("GET", map[string]string{HeaderIfNoneMatch: `"abc", W/"def"`})
+			assert.True(t, req.IsNotModified(`"abc"`, time.Time{}))
+			assert.True(t, req.IsNotModified(`"def"`, time.Time{}))
+			assert.False(t, req.IsNotModified(`"xyz"`, time.Time{}))
+		})
+
+		t.Run("should match any etag with wildcard", func(t *testing.T) {
+			req := newConditionalRequest("HEAD", map[string]string{HeaderIfNoneMatch: "*"})
+			assert.True(t, req.IsNotModified(`"abc"`, time.Time{}))
+		})
+
+		t.Run("should prefer If-None-Match over If-Modified-Since", func(t *testing.T) {
+			req := newConditionalRequest("GET", map[string]string{
+				HeaderIfNoneMatch:     `"xyz"`,
+				HeaderIfModifiedSince: lastModified.Format(http.TimeFormat),
+			})
+			assert.False(t, req.IsNotModified(`"abc"`, lastModified))
+		})
+
+		t.Run("should compare If-Modified-Since date", func(t *testing.T) {
+			req := newConditionalRequest("GET", map[string]string{HeaderIfModifiedSince: lastModified.Format(http.TimeFormat)})
+			assert.True(t, req.IsNotModified("", lastModified.Add(500*time.Millisecond)))
+			assert.True(t, req.IsNotModified("", lastModified.Add(-time.Hour)))
+			assert.False(t, req.IsNotModified("", lastModified.Add(time.Second)))
+		})
+
+		t.Run("should ignore conditional headers for other methods", func(t *testing.T) {
+			req := newConditionalRequest("POST", map[string]string{HeaderIfNoneMatch: `"abc"`})
+			assert.False(t, req.IsNotModified(`"abc"`, lastModified))
+		})
+	})
 }
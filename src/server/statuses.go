@@ -2,7 +2,8 @@ package server
 
 // HTTP Status codes
 const (
-	StatusOK = 200
+	StatusOK       = 200
+	StatusAccepted = 202
 
 	StatusMovedPermanently  = 301
 	StatusFound             = 302
@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"encoding/json"
+	"fmt"
 	"os"
 
 	"github.com/joho/godotenv"
@@ -25,6 +27,20 @@ func GetEnv(key string) string {
 	return os.Getenv(key)
 }
 
+// Parses the JSON value of the ENV variable into the target.
+// When the variable is empty/not set, the target is left unchanged.
+// e.g: GetEnvJSON("LAMBDA_ASYNC_ROUTES", &asyncRoutes)
+func GetEnvJSON(key string, target interface{}) error {
+	val := GetEnv(key)
+	if val == "" {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(val), target); err != nil {
+		return fmt.Errorf("failed to parse %s env variable: %v", key, err)
+	}
+	return nil
+}
+
 func SetEnv(key, value string) {
 	os.Setenv(key, value)
 }
@@ -287,3 +287,37 @@ func TestGetEnvWithDefaultIntegration(t *testing.T) {
 		assert.Equal(t, defaultValue, result)
 	})
 }
+
+func TestGetEnvJSON(t *testing.T) {
+	t.Run("parses JSON value into the target", func(t *testing.T) {
+		key := "TEST_GET_ENV_JSON"
+		os.Setenv(key, `{"*.example.com": ["/api/**"]}`)
+		defer os.Unsetenv(key)
+
+		var result map[string][]string
+		err := GetEnvJSON(key, &result)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string][]string{"*.example.com": {"/api/**"}}, result)
+	})
+
+	t.Run("leaves target unchanged when env var is not set", func(t *testing.T) {
+		key := "TEST_GET_ENV_JSON_NONEXISTENT"
+		os.Unsetenv(key)
+
+		result := map[string]string{"default": "value"}
+		err := GetEnvJSON(key, &result)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"default": "value"}, result)
+	})
+
+	t.Run("returns error for invalid JSON", func(t *testing.T) {
+		key := "TEST_GET_ENV_JSON_INVALID"
+		os.Setenv(key, `{invalid`)
+		defer os.Unsetenv(key)
+
+		var result map[string]string
+		err := GetEnvJSON(key, &result)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), key)
+	})
+}
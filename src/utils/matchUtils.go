@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Compiled patterns are cached, so we don't need to compile them on every request
+var compiledPatterns sync.Map
+
+// MatchPattern returns true if the value matches the glob-like pattern.
+// The "*" wildcard matches any characters except the separator
+// and the "**" wildcard matches any characters including the separator.
+// e.g: MatchPattern("/api/webhooks/**", "/api/webhooks/stripe/events", '/') => true
+// e.g: MatchPattern("/api/*", "/api/webhooks/stripe", '/') => false
+// e.g: MatchPattern("*.ownstak.link", "my-app.ownstak.link", '.') => true
+func MatchPattern(pattern, value string, separator byte) bool {
+	cacheKey := string(separator) + pattern
+	if compiled, ok := compiledPatterns.Load(cacheKey); ok {
+		return compiled.(*regexp.Regexp).MatchString(value)
+	}
+
+	anyChars := ".*"
+	anyCharsExceptSeparator := "[^" + regexp.QuoteMeta(string(separator)) + "]*"
+
+	var regex strings.Builder
+	regex.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != '*' {
+			regex.WriteString(regexp.QuoteMeta(string(pattern[i])))
+			continue
+		}
+		if i+1 < len(pattern) && pattern[i+1] == '*' {
+			regex.WriteString(anyChars)
+			i++
+			continue
+		}
+		regex.WriteString(anyCharsExceptSeparator)
+	}
+	regex.WriteString("$")
+
+	compiled := regexp.MustCompile(regex.String())
+	compiledPatterns.Store(cacheKey, compiled)
+	return compiled.MatchString(value)
+}
+
+// MatchHost returns true if the host matches the host pattern.
+// The "*" wildcard matches single subdomain and "**" any number of subdomains.
+// e.g: MatchHost("*.aws-primary.my-org.ownstak.link", "nextjs-app-prod.aws-primary.my-org.ownstak.link") => true
+func MatchHost(pattern, host string) bool {
+	return MatchPattern(strings.ToLower(pattern), strings.ToLower(host), '.')
+}
+
+// GetHostConfig returns the value from the map of host patterns
+// for the most specific pattern that matches given host.
+// The exact match always wins, otherwise the longest matching pattern is used.
+// e.g: GetHostConfig(map[string]int{"*": 1, "*.ownstak.link": 2}, "my-app.ownstak.link") => 2, true
+func GetHostConfig[T any](configs map[string]T, host string) (T, bool) {
+	var zero T
+	if len(configs) == 0 {
+		return zero, false
+	}
+
+	// Sort patterns from the longest to the shortest,
+	// so we always get the same result for the same host.
+	patterns := make([]string, 0, len(configs))
+	for pattern := range configs {
+		if strings.EqualFold(pattern, host) {
+			return configs[pattern], true
+		}
+		patterns = append(patterns, pattern)
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		if len(patterns[i]) != len(patterns[j]) {
+			return len(patterns[i]) > len(patterns[j])
+		}
+		return patterns[i] < patterns[j]
+	})
+
+	for _, pattern := range patterns {
+		// The single "*" pattern matches all hosts
+		if pattern == "*" || MatchHost(pattern, host) {
+			return configs[pattern], true
+		}
+	}
+
+	return zero, false
+}
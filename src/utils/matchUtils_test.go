@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchPattern(t *testing.T) {
+	t.Run("matches exact value", func(t *testing.T) {
+		assert.True(t, MatchPattern("/api/webhooks", "/api/webhooks", '/'))
+		assert.False(t, MatchPattern("/api/webhooks", "/api/webhooks/stripe", '/'))
+	})
+
+	t.Run("matches single segment with *", func(t *testing.T) {
+		assert.True(t, MatchPattern("/api/*", "/api/webhooks", '/'))
+		assert.True(t, MatchPattern("/api/*/events", "/api/stripe/events", '/'))
+		assert.False(t, MatchPattern("/api/*", "/api/webhooks/stripe", '/'))
+	})
+
+	t.Run("matches multiple segments with **", func(t *testing.T) {
+		assert.True(t, MatchPattern("/api/**", "/api/webhooks/stripe/events", '/'))
+		assert.True(t, MatchPattern("/api/**", "/api/", '/'))
+		assert.False(t, MatchPattern("/api/**", "/other/webhooks", '/'))
+	})
+
+	t.Run("escapes special regex characters", func(t *testing.T) {
+		assert.True(t, MatchPattern("/image.png", "/image.png", '/'))
+		assert.False(t, MatchPattern("/image.png", "/image-png", '/'))
+		assert.False(t, MatchPattern("/(a|b)", "/a", '/'))
+	})
+
+	t.Run("uses given separator", func(t *testing.T) {
+		assert.True(t, MatchPattern("*.example.com", "cdn.example.com", '.'))
+		assert.False(t, MatchPattern("*.example.com", "a.cdn.example.com", '.'))
+		assert.True(t, MatchPattern("**.example.com", "a.cdn.example.com", '.'))
+	})
+}
+
+func TestMatchHost(t *testing.T) {
+	t.Run("matches hosts case insensitively", func(t *testing.T) {
+		assert.True(t, MatchHost("*.Example.com", "CDN.example.com"))
+	})
+
+	t.Run("matches single subdomain with *", func(t *testing.T) {
+		assert.True(t, MatchHost("*.aws-primary.org.ownstak.link", "app-prod.aws-primary.org.ownstak.link"))
+		assert.False(t, MatchHost("*.aws-primary.org.ownstak.link", "aws-primary.org.ownstak.link"))
+	})
+}
+
+func TestGetHostConfig(t *testing.T) {
+	configs := map[string]string{
+		"*":                                "default",
+		"*.ownstak.link":                   "ownstak",
+		"*.aws-primary.org.ownstak.link":   "aws-primary",
+		"app.aws-primary.org.ownstak.link": "app",
+	}
+
+	t.Run("returns exact match", func(t *testing.T) {
+		value, ok := GetHostConfig(configs, "app.aws-primary.org.ownstak.link")
+		assert.True(t, ok)
+		assert.Equal(t, "app", value)
+	})
+
+	t.Run("returns the most specific pattern", func(t *testing.T) {
+		value, ok := GetHostConfig(configs, "other.aws-primary.org.ownstak.link")
+		assert.True(t, ok)
+		assert.Equal(t, "aws-primary", value)
+
+		value, ok = GetHostConfig(configs, "docs.ownstak.link")
+		assert.True(t, ok)
+		assert.Equal(t, "ownstak", value)
+	})
+
+	t.Run("returns default for * pattern", func(t *testing.T) {
+		value, ok := GetHostConfig(configs, "example.com")
+		assert.True(t, ok)
+		assert.Equal(t, "default", value)
+	})
+
+	t.Run("returns false when nothing matches", func(t *testing.T) {
+		value, ok := GetHostConfig(map[string]string{"*.ownstak.link": "ownstak"}, "example.com")
+		assert.False(t, ok)
+		assert.Equal(t, "", value)
+	})
+
+	t.Run("returns false for empty configs", func(t *testing.T) {
+		_, ok := GetHostConfig(map[string]string{}, "example.com")
+		assert.False(t, ok)
+	})
+}
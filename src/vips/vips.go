@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -46,51 +48,102 @@ var (
 	errorMutex  sync.Mutex // New mutex for error buffer access
 	initialized bool
 	debug       bool = false // Debug mode flag
+	// The "keep" save option is available since libvips 8.15,
+	// older versions support only stripping all metadata with "strip" option.
+	supportsKeep bool
+	// The "fail_on" load option is available since libvips 8.12,
+	// older versions support only failing on any error with "fail" option.
+	supportsFailOn bool
+	// How sensitive the loaders are to the truncated or corrupt images, see VIPS_FAIL_ON_* constants.
+	failOn = VIPS_FAIL_ON_ERROR
+	// The input and output formats supported by the loaded library, detected at Initialize.
+	// The optional loaders such as HEIF or JPEG XL depend on how the library was built.
+	supportedInputFormats  = map[ImageFormat]bool{}
+	supportedOutputFormats = map[ImageFormat]bool{}
 
 	// libvips functions
-	vipsImageNewFromBuffer     func(unsafe.Pointer, int, string, unsafe.Pointer) unsafe.Pointer
-	vipsImageWriteToBuffer     func(unsafe.Pointer, *byte, unsafe.Pointer, unsafe.Pointer, unsafe.Pointer) int
-	vipsImageNewFromFile       func(string, unsafe.Pointer) unsafe.Pointer
-	vipsInit                   func(string) int
-	vipsVersionString          func() string
-	vipsTrackedGetMem          func() int64
-	vipsTrackedGetMemHighwater func() int64
-	vipsTrackedGetAllocs       func() int64
-	vipsTrackedGetFiles        func() int64
-	vipsCacheGetSize           func() int64
-	vipsCacheGetMax            func() int64
-	vipsConcurrencyGet         func() int
-	vipsErrorBuffer            func() string
-	vipsErrorClear             func()
-	vipsObjectPrintAll         func()
-	vipsObjectUnrefOutputs     func(unsafe.Pointer)
-	vipsThreadShutdown         func()
-	vipsCacheDropAll           func()
-	vipsShutdown               func()
-	vipsResize                 func(unsafe.Pointer, unsafe.Pointer, float64, unsafe.Pointer) int
-	imageGetBlob               func(unsafe.Pointer, *byte, unsafe.Pointer) uintptr
-	vipsCacheSetMax            func(int)
-	vipsCacheSetMaxMem         func(int)
-	vipsConcurrencySet         func(int)
-	vipsLeakSet                func(int)
-	vipsImageGetWidth          func(unsafe.Pointer) int
-	vipsImageGetHeight         func(unsafe.Pointer) int
-	vipsCacheGetMaxMem         func() int64
-	vipsCacheGetMaxFiles       func() int64
-	vipsJpegLoadBuffer         func(unsafe.Pointer, int, unsafe.Pointer, *byte, int, unsafe.Pointer) int
-	vipsJpegSaveBuffer         func(unsafe.Pointer, unsafe.Pointer, unsafe.Pointer, string, int, string, int, unsafe.Pointer) int
-	vipsWebpLoadBuffer         func(unsafe.Pointer, int, unsafe.Pointer, *byte, int, unsafe.Pointer) int
-	vipsWebpSaveBuffer         func(unsafe.Pointer, unsafe.Pointer, unsafe.Pointer, string, int, string, int, unsafe.Pointer) int
-	vipsGifLoadBuffer          func(unsafe.Pointer, int, unsafe.Pointer, *byte, int, unsafe.Pointer) int
-	vipsGifSaveBuffer          func(unsafe.Pointer, unsafe.Pointer, unsafe.Pointer, unsafe.Pointer) int
-	vipsJpegLoad               func(*byte, unsafe.Pointer, *byte, int, unsafe.Pointer) int
-	vipsJpegSave               func(unsafe.Pointer, *byte, *byte, int, *byte, int, unsafe.Pointer) int
-	vipsWebpLoad               func(*byte, unsafe.Pointer, *byte, int, unsafe.Pointer) int
-	vipsWebpSave               func(unsafe.Pointer, *byte, *byte, int, *byte, int, unsafe.Pointer) int
-	vipsGifLoad                func(*byte, unsafe.Pointer, *byte, int, unsafe.Pointer) int
-	vipsGifSave                func(unsafe.Pointer, *byte, *byte, int, *byte, int, unsafe.Pointer) int
-	vipsTiffLoad               func(*byte, unsafe.Pointer, *byte, int, unsafe.Pointer) int
-	vipsTiffSave               func(unsafe.Pointer, *byte, *byte, int, *byte, int, unsafe.Pointer) int
+	vipsImageNewFromBuffer      func(unsafe.Pointer, int, string, unsafe.Pointer) unsafe.Pointer
+	vipsImageNewFromBufferPages func(unsafe.Pointer, int, string, string, int, string, int, unsafe.Pointer) unsafe.Pointer
+	vipsImageWriteToBuffer      func(unsafe.Pointer, *byte, unsafe.Pointer, unsafe.Pointer, unsafe.Pointer) int
+	vipsImageNewFromFile        func(string, unsafe.Pointer) unsafe.Pointer
+	vipsImageNewFromFilePages   func(string, string, int, string, int, unsafe.Pointer) unsafe.Pointer
+	vipsForeignFindLoad         func(string) string
+	vipsForeignFindLoadBuffer   func(unsafe.Pointer, int) string
+	vipsTypeFind                func(string, string) uintptr
+	vipsInit                    func(string) int
+	vipsVersionString           func() string
+	vipsTrackedGetMem           func() int64
+	vipsTrackedGetMemHighwater  func() int64
+	vipsTrackedGetAllocs        func() int64
+	vipsTrackedGetFiles         func() int64
+	vipsCacheGetSize            func() int64
+	vipsCacheGetMax             func() int64
+	vipsConcurrencyGet          func() int
+	vipsErrorBuffer             func() string
+	vipsErrorClear              func()
+	vipsObjectPrintAll          func()
+	vipsObjectUnrefOutputs      func(unsafe.Pointer)
+	vipsThreadShutdown          func()
+	vipsCacheDropAll            func()
+	vipsShutdown                func()
+	vipsResize                  func(unsafe.Pointer, unsafe.Pointer, float64, unsafe.Pointer) int
+	vipsThumbnailImage          func(unsafe.Pointer, unsafe.Pointer, int, string, int, string, int, unsafe.Pointer) int
+	vipsCrop                    func(unsafe.Pointer, unsafe.Pointer, int, int, int, int, unsafe.Pointer) int
+	vipsSmartCrop               func(unsafe.Pointer, unsafe.Pointer, int, int, string, int, unsafe.Pointer) int
+	vipsEmbed                   func(unsafe.Pointer, unsafe.Pointer, int, int, int, int, string, int, unsafe.Pointer) int
+	vipsAutorot                 func(unsafe.Pointer, unsafe.Pointer, unsafe.Pointer) int
+	vipsIccTransform            func(unsafe.Pointer, unsafe.Pointer, string, string, int, unsafe.Pointer) int
+	vipsImageGetTypeof          func(unsafe.Pointer, string) uintptr
+	vipsVersion                 func(int) int
+	vipsGaussblur               func(unsafe.Pointer, unsafe.Pointer, float64, unsafe.Pointer) int
+	vipsSharpen                 func(unsafe.Pointer, unsafe.Pointer, unsafe.Pointer) int
+	vipsRot                     func(unsafe.Pointer, unsafe.Pointer, int, unsafe.Pointer) int
+	vipsFlip                    func(unsafe.Pointer, unsafe.Pointer, int, unsafe.Pointer) int
+	vipsColourspace             func(unsafe.Pointer, unsafe.Pointer, int, unsafe.Pointer) int
+	vipsLinear                  func(unsafe.Pointer, unsafe.Pointer, *float64, *float64, int, string, int, unsafe.Pointer) int
+	vipsComposite2              func(unsafe.Pointer, unsafe.Pointer, unsafe.Pointer, int, string, int, string, int, unsafe.Pointer) int
+	vipsAddalpha                func(unsafe.Pointer, unsafe.Pointer, unsafe.Pointer) int
+	vipsImageGetBands           func(unsafe.Pointer) int
+	vipsStats                   func(unsafe.Pointer, unsafe.Pointer, unsafe.Pointer) int
+	vipsGetpoint                func(unsafe.Pointer, unsafe.Pointer, unsafe.Pointer, int, int, unsafe.Pointer) int
+	vipsImageGetPageHeight      func(unsafe.Pointer) int
+	vipsImageGetInterpretation  func(unsafe.Pointer) int
+	vipsImageGetInt             func(unsafe.Pointer, string, unsafe.Pointer) int
+	vipsImageGetString          func(unsafe.Pointer, string, unsafe.Pointer) int
+	vipsImageSetInt             func(unsafe.Pointer, string, int)
+	vipsImageSetKill            func(unsafe.Pointer, int)
+	vipsCopy                    func(unsafe.Pointer, unsafe.Pointer, unsafe.Pointer) int
+	vipsArrayjoin               func(unsafe.Pointer, unsafe.Pointer, int, string, int, unsafe.Pointer) int
+	imageGetBlob                func(unsafe.Pointer, *byte, unsafe.Pointer) uintptr
+	vipsCacheSetMax             func(int)
+	vipsCacheSetMaxMem          func(int)
+	vipsConcurrencySet          func(int)
+	vipsLeakSet                 func(int)
+	vipsImageGetWidth           func(unsafe.Pointer) int
+	vipsImageGetHeight          func(unsafe.Pointer) int
+	vipsImageHasAlpha           func(unsafe.Pointer) int
+	vipsCacheGetMaxMem          func() int64
+	vipsCacheGetMaxFiles        func() int64
+	vipsJpegLoadBuffer          func(unsafe.Pointer, int, unsafe.Pointer, *byte, int, unsafe.Pointer) int
+	vipsJpegSaveBuffer          func(unsafe.Pointer, unsafe.Pointer, unsafe.Pointer, string, int, string, int, string, int, unsafe.Pointer) int
+	vipsWebpLoadBuffer          func(unsafe.Pointer, int, unsafe.Pointer, *byte, int, unsafe.Pointer) int
+	vipsWebpSaveBuffer          func(unsafe.Pointer, unsafe.Pointer, unsafe.Pointer, string, int, string, int, string, int, unsafe.Pointer) int
+	vipsGifLoadBuffer           func(unsafe.Pointer, int, unsafe.Pointer, *byte, int, unsafe.Pointer) int
+	vipsGifSaveBuffer           func(unsafe.Pointer, unsafe.Pointer, unsafe.Pointer, string, int, unsafe.Pointer) int
+	vipsHeifLoadBuffer          func(unsafe.Pointer, int, unsafe.Pointer, string, int, unsafe.Pointer) int
+	vipsJxlLoadBuffer           func(unsafe.Pointer, int, unsafe.Pointer, string, int, unsafe.Pointer) int
+	vipsJpegLoad                func(*byte, unsafe.Pointer, *byte, int, unsafe.Pointer) int
+	vipsJpegSave                func(unsafe.Pointer, *byte, *byte, int, *byte, int, unsafe.Pointer) int
+	vipsWebpLoad                func(*byte, unsafe.Pointer, *byte, int, unsafe.Pointer) int
+	vipsWebpSave                func(unsafe.Pointer, *byte, *byte, int, *byte, int, *byte, int, unsafe.Pointer) int
+	vipsGifLoad                 func(*byte, unsafe.Pointer, *byte, int, unsafe.Pointer) int
+	vipsGifSave                 func(unsafe.Pointer, *byte, *byte, int, *byte, int, unsafe.Pointer) int
+	vipsTiffLoad                func(*byte, unsafe.Pointer, *byte, int, unsafe.Pointer) int
+	vipsTiffSave                func(unsafe.Pointer, *byte, *byte, int, *byte, int, unsafe.Pointer) int
+	vipsPngSave                 func(unsafe.Pointer, *byte, *byte, int, *byte, int, *byte, int, unsafe.Pointer) int
+	vipsPngSaveBuffer           func(unsafe.Pointer, unsafe.Pointer, unsafe.Pointer, string, int, string, int, string, int, unsafe.Pointer) int
+	vipsHeifSave                func(unsafe.Pointer, *byte, *byte, int, *byte, int, *byte, int, *byte, int, unsafe.Pointer) int
+	vipsHeifSaveBuffer          func(unsafe.Pointer, unsafe.Pointer, unsafe.Pointer, string, int, string, int, string, int, string, int, unsafe.Pointer) int
 
 	// libglib functions
 	gFree        func(ptr unsafe.Pointer)
@@ -99,7 +152,86 @@ var (
 )
 
 const (
-	VIPS_ACCESS_RANDOM = 1
+	VIPS_ACCESS_RANDOM     = 1
+	VIPS_ACCESS_SEQUENTIAL = 2
+
+	// How sensitive the loaders are to the truncated or corrupt images.
+	// The loaders decode the pixels lazily, so the errors are usually returned when the image is processed or saved.
+	// See: https://www.libvips.org/API/current/enum.FailOn.html
+	VIPS_FAIL_ON_NONE      = "none"      // Never stop
+	VIPS_FAIL_ON_TRUNCATED = "truncated" // Stop on image truncated, nothing else
+	VIPS_FAIL_ON_ERROR     = "error"     // Stop on serious error or truncation
+	VIPS_FAIL_ON_WARNING   = "warning"   // Stop on anything, even warnings
+
+	// See: https://www.libvips.org/API/current/enum.ForeignHeifCompression.html
+	VIPS_FOREIGN_HEIF_COMPRESSION_AV1 = 4
+
+	// See: https://www.libvips.org/API/current/enum.Size.html
+	VIPS_SIZE_BOTH  = 0
+	VIPS_SIZE_UP    = 1
+	VIPS_SIZE_DOWN  = 2
+	VIPS_SIZE_FORCE = 3
+
+	// See: https://www.libvips.org/API/current/enum.Interesting.html
+	VIPS_INTERESTING_NONE      = 0
+	VIPS_INTERESTING_CENTRE    = 1
+	VIPS_INTERESTING_ENTROPY   = 2
+	VIPS_INTERESTING_ATTENTION = 3
+
+	// See: https://www.libvips.org/API/current/enum.Extend.html
+	VIPS_EXTEND_BLACK = 0
+	VIPS_EXTEND_COPY  = 1
+	VIPS_EXTEND_WHITE = 4
+
+	// See: https://www.libvips.org/API/current/enum.Angle.html
+	VIPS_ANGLE_D0   = 0
+	VIPS_ANGLE_D90  = 1
+	VIPS_ANGLE_D180 = 2
+	VIPS_ANGLE_D270 = 3
+
+	// See: https://www.libvips.org/API/current/enum.Direction.html
+	VIPS_DIRECTION_HORIZONTAL = 0
+	VIPS_DIRECTION_VERTICAL   = 1
+
+	// See: https://www.libvips.org/API/current/enum.Interpretation.html
+	VIPS_INTERPRETATION_B_W  = 1
+	VIPS_INTERPRETATION_SRGB = 22
+
+	// The blend mode that places the overlay over the base image like a layer.
+	// See: https://www.libvips.org/API/current/enum.BlendMode.html
+	VIPS_BLEND_MODE_OVER = 2
+
+	// The column with the mean value in the output of vips_stats.
+	// See: https://www.libvips.org/API/current/libvips-arithmetic.html#vips-stats
+	VIPS_STATS_MEAN = 4
+
+	// The image fields with the height of single frame and number of frames of animated images
+	VIPS_META_PAGE_HEIGHT = "page-height"
+	VIPS_META_N_PAGES     = "n-pages"
+
+	// The image field with the EXIF orientation in the range 1-8
+	VIPS_META_ORIENTATION = "orientation"
+
+	// Flags for the metadata that is kept in the saved image.
+	// See: https://www.libvips.org/API/current/flags.ForeignKeep.html
+	VIPS_FOREIGN_KEEP_NONE  = 0
+	VIPS_FOREIGN_KEEP_EXIF  = 1 << 0
+	VIPS_FOREIGN_KEEP_XMP   = 1 << 1
+	VIPS_FOREIGN_KEEP_IPTC  = 1 << 2
+	VIPS_FOREIGN_KEEP_ICC   = 1 << 3
+	VIPS_FOREIGN_KEEP_OTHER = 1 << 4
+	VIPS_FOREIGN_KEEP_ALL   = 31
+
+	// The name of the image field with embedded ICC profile
+	VIPS_META_ICC_NAME = "icc-profile-data"
+)
+
+// Default compression options for the lossless/slow formats.
+// The higher effort results in smaller files but takes more CPU time.
+const (
+	DefaultPngCompression = 6 // zlib compression level 0-9
+	DefaultPngEffort      = 7 // 1-10
+	DefaultAvifEffort     = 4 // 0-9, AVIF encoding is very CPU intensive
 )
 
 // Image represents a VIPS image object
@@ -118,14 +250,14 @@ func (e *Error) Error() string {
 }
 
 type Stats struct {
-	Version     string // VIPS version
-	Mem         int64  // Current allocated memory in bytes
-	MemHigh     int64  // High water mark of allocated memory
-	Allocs      int64  // Number of active allocations
-	Files       int64  // Number of open files
-	CacheSize   int64  // Current cache size in bytes
-	CacheMax    int64  // Maximum cache size in bytes
-	Concurrency int    // Number of concurrent operations
+	Version     string `json:"version"`     // VIPS version
+	Mem         int64  `json:"mem"`         // Current allocated memory in bytes
+	MemHigh     int64  `json:"memHigh"`     // High water mark of allocated memory
+	Allocs      int64  `json:"allocs"`      // Number of active allocations
+	Files       int64  `json:"files"`       // Number of open files
+	CacheSize   int64  `json:"cacheSize"`   // Current number of operations in the cache
+	CacheMax    int64  `json:"cacheMax"`    // Maximum number of operations in the cache
+	Concurrency int    `json:"concurrency"` // Number of concurrent operations
 }
 
 // ImageFormat represents an image type value.
@@ -270,6 +402,7 @@ func Initialize() error {
 	// Register all libvips functions
 	purego.RegisterLibFunc(&vipsInit, libvips, "vips_init")
 	purego.RegisterLibFunc(&vipsImageNewFromBuffer, libvips, "vips_image_new_from_buffer")
+	purego.RegisterLibFunc(&vipsImageNewFromBufferPages, libvips, "vips_image_new_from_buffer")
 	purego.RegisterLibFunc(&vipsImageWriteToBuffer, libvips, "vips_image_write_to_buffer")
 	purego.RegisterLibFunc(&vipsVersionString, libvips, "vips_version_string")
 	purego.RegisterLibFunc(&vipsTrackedGetMem, libvips, "vips_tracked_get_mem")
@@ -286,6 +419,33 @@ func Initialize() error {
 	purego.RegisterLibFunc(&vipsCacheDropAll, libvips, "vips_cache_drop_all")
 	purego.RegisterLibFunc(&vipsShutdown, libvips, "vips_shutdown")
 	purego.RegisterLibFunc(&vipsResize, libvips, "vips_resize")
+	purego.RegisterLibFunc(&vipsThumbnailImage, libvips, "vips_thumbnail_image")
+	purego.RegisterLibFunc(&vipsCrop, libvips, "vips_crop")
+	purego.RegisterLibFunc(&vipsSmartCrop, libvips, "vips_smartcrop")
+	purego.RegisterLibFunc(&vipsEmbed, libvips, "vips_embed")
+	purego.RegisterLibFunc(&vipsAutorot, libvips, "vips_autorot")
+	purego.RegisterLibFunc(&vipsIccTransform, libvips, "vips_icc_transform")
+	purego.RegisterLibFunc(&vipsImageGetTypeof, libvips, "vips_image_get_typeof")
+	purego.RegisterLibFunc(&vipsVersion, libvips, "vips_version")
+	purego.RegisterLibFunc(&vipsGaussblur, libvips, "vips_gaussblur")
+	purego.RegisterLibFunc(&vipsSharpen, libvips, "vips_sharpen")
+	purego.RegisterLibFunc(&vipsRot, libvips, "vips_rot")
+	purego.RegisterLibFunc(&vipsFlip, libvips, "vips_flip")
+	purego.RegisterLibFunc(&vipsColourspace, libvips, "vips_colourspace")
+	purego.RegisterLibFunc(&vipsLinear, libvips, "vips_linear")
+	purego.RegisterLibFunc(&vipsComposite2, libvips, "vips_composite2")
+	purego.RegisterLibFunc(&vipsAddalpha, libvips, "vips_addalpha")
+	purego.RegisterLibFunc(&vipsImageGetBands, libvips, "vips_image_get_bands")
+	purego.RegisterLibFunc(&vipsStats, libvips, "vips_stats")
+	purego.RegisterLibFunc(&vipsGetpoint, libvips, "vips_getpoint")
+	purego.RegisterLibFunc(&vipsImageGetPageHeight, libvips, "vips_image_get_page_height")
+	purego.RegisterLibFunc(&vipsImageGetInterpretation, libvips, "vips_image_get_interpretation")
+	purego.RegisterLibFunc(&vipsImageGetInt, libvips, "vips_image_get_int")
+	purego.RegisterLibFunc(&vipsImageGetString, libvips, "vips_image_get_string")
+	purego.RegisterLibFunc(&vipsImageSetInt, libvips, "vips_image_set_int")
+	purego.RegisterLibFunc(&vipsImageSetKill, libvips, "vips_image_set_kill")
+	purego.RegisterLibFunc(&vipsCopy, libvips, "vips_copy")
+	purego.RegisterLibFunc(&vipsArrayjoin, libvips, "vips_arrayjoin")
 	purego.RegisterLibFunc(&vipsObjectUnrefOutputs, libvips, "vips_object_unref_outputs")
 	purego.RegisterLibFunc(&imageGetBlob, libvips, "vips_image_get_blob")
 	purego.RegisterLibFunc(&vipsCacheSetMax, libvips, "vips_cache_set_max")
@@ -305,13 +465,35 @@ func Initialize() error {
 	purego.RegisterLibFunc(&vipsGifSave, libvips, "vips_gifsave")
 	purego.RegisterLibFunc(&vipsTiffLoad, libvips, "vips_tiffload")
 	purego.RegisterLibFunc(&vipsTiffSave, libvips, "vips_tiffsave")
+	purego.RegisterLibFunc(&vipsPngSave, libvips, "vips_pngsave")
+	purego.RegisterLibFunc(&vipsPngSaveBuffer, libvips, "vips_pngsave_buffer")
+	purego.RegisterLibFunc(&vipsHeifSave, libvips, "vips_heifsave")
+	purego.RegisterLibFunc(&vipsHeifSaveBuffer, libvips, "vips_heifsave_buffer")
 	purego.RegisterLibFunc(&vipsLeakSet, libvips, "vips_leak_set")
 	purego.RegisterLibFunc(&vipsImageGetWidth, libvips, "vips_image_get_width")
 	purego.RegisterLibFunc(&vipsImageGetHeight, libvips, "vips_image_get_height")
+	purego.RegisterLibFunc(&vipsImageHasAlpha, libvips, "vips_image_hasalpha")
 	purego.RegisterLibFunc(&vipsImageNewFromFile, libvips, "vips_image_new_from_file")
+	purego.RegisterLibFunc(&vipsImageNewFromFilePages, libvips, "vips_image_new_from_file")
+	purego.RegisterLibFunc(&vipsForeignFindLoad, libvips, "vips_foreign_find_load")
+	purego.RegisterLibFunc(&vipsForeignFindLoadBuffer, libvips, "vips_foreign_find_load_buffer")
+	purego.RegisterLibFunc(&vipsTypeFind, libvips, "vips_type_find")
 	purego.RegisterLibFunc(&vipsCacheGetMaxMem, libvips, "vips_cache_get_max_mem")
 	purego.RegisterLibFunc(&vipsCacheGetMaxFiles, libvips, "vips_cache_get_max_files")
 
+	// Detect the optional features of the loaded libvips version
+	supportsKeep = vipsVersion(0) > 8 || (vipsVersion(0) == 8 && vipsVersion(1) >= 15)
+	supportsFailOn = vipsVersion(0) > 8 || (vipsVersion(0) == 8 && vipsVersion(1) >= 12)
+
+	// The optional loaders are registered only if the library exports them.
+	// Older versions don't have the jxlload at all and RegisterLibFunc panics on missing symbols.
+	if hasSymbol("vips_heifload_buffer") {
+		purego.RegisterLibFunc(&vipsHeifLoadBuffer, libvips, "vips_heifload_buffer")
+	}
+	if hasSymbol("vips_jxlload_buffer") {
+		purego.RegisterLibFunc(&vipsJxlLoadBuffer, libvips, "vips_jxlload_buffer")
+	}
+
 	// Register libglib functions
 	purego.RegisterLibFunc(&gFree, libvips, "g_free")
 	purego.RegisterLibFunc(&gObjectUnref, libvips, "g_object_unref")
@@ -369,6 +551,20 @@ func Initialize() error {
 	}
 	vipsLeakSet(leak)
 
+	// Detect the loaders and savers the library was built with.
+	// The operation types are registered by vips_init, so this needs to run after it.
+	detectSupportedFormats()
+
+	failOn = VIPS_FAIL_ON_ERROR // fail fast on truncated or corrupt images by default
+	if envFailOn := strings.ToLower(utils.GetEnv(constants.EnvVipsFailOn)); envFailOn != "" {
+		switch envFailOn {
+		case VIPS_FAIL_ON_NONE, VIPS_FAIL_ON_TRUNCATED, VIPS_FAIL_ON_ERROR, VIPS_FAIL_ON_WARNING:
+			failOn = envFailOn
+		default:
+			return fmt.Errorf("failed to parse VIPS_FAIL_ON: unsupported value %s", envFailOn)
+		}
+	}
+
 	// Use stub implementation of malloc_trim by default.
 	// There's no such a thing on darwin/windows platforms.
 	mallocTrim = func() int {
@@ -389,13 +585,13 @@ func Initialize() error {
 
 		for _, path := range libcPaths {
 			logger.Debug("Trying to load libc from: %s", path)
-			libc, err := purego.Dlopen(path, purego.RTLD_LAZY|purego.RTLD_GLOBAL)
+			libc, err = purego.Dlopen(path, purego.RTLD_LAZY|purego.RTLD_GLOBAL)
 			if err != nil {
 				continue
 			}
 			logger.Debug("Successfully loaded libc from: %s", path)
 			purego.RegisterLibFunc(&mallocTrim, libc, "malloc_trim")
-			return nil
+			break
 		}
 	}
 
@@ -404,7 +600,7 @@ func Initialize() error {
 	vipsConcurrency := vipsConcurrencyGet()
 
 	maxCacheMemHuman := utils.FormatBytes(uint64(maxCacheMem))
-	logger.Info("VIPS %s initialized successfully (concurrency: %d, max cache size: %d, max cache mem: %s)", vipsVersionStr, vipsConcurrency, maxCacheSize, maxCacheMemHuman)
+	logger.Info("VIPS %s initialized successfully (concurrency: %d, max cache size: %d, max cache mem: %s, input formats: %v)", vipsVersionStr, vipsConcurrency, maxCacheSize, maxCacheMemHuman, GetSupportedInputFormats())
 	initialized = true
 
 	return nil
@@ -451,6 +647,9 @@ func ReadVipsMemStats(stats *Stats) error {
 	if stats == nil {
 		return fmt.Errorf("stats pointer is nil")
 	}
+	if !initialized {
+		return fmt.Errorf("vips is not initialized")
+	}
 
 	// Get version
 	stats.Version = vipsVersionString()
@@ -508,6 +707,8 @@ func ThreadShutdown() {
 	vipsThreadShutdown()
 }
 
+// CacheDrop drops all operations from the libvips operation cache
+// and frees the memory held by them.
 func CacheDrop() {
 	vipsCacheDropAll()
 }
@@ -525,6 +726,9 @@ func Shutdown() {
 }
 
 // LoadImageFromBuffer loads an image from memory (byte slice).
+// libvips doesn't copy the data, so the caller needs to keep the slice alive until the image
+// and all images created from it are freed, e.g. with runtime.KeepAlive(data).
+// The truncated or corrupt images fail based on VIPS_FAIL_ON env variable, see IsDecodeError.
 //
 // Example:
 //
@@ -544,7 +748,14 @@ func LoadImageFromBuffer(data []byte) (*VipsImage, error) {
 	clearError()
 
 	imageFormat := GetImageFormat(data)
-	ptr := vipsImageNewFromBuffer(unsafe.Pointer(&data[0]), len(data), "", nil)
+	switch imageFormat {
+	case HEIF, AVIF:
+		return LoadHeifImageFromBuffer(data)
+	case JXL:
+		return LoadJxlImageFromBuffer(data)
+	}
+
+	ptr := vipsImageNewFromBuffer(unsafe.Pointer(&data[0]), len(data), loadOptions(), nil)
 	if ptr == nil {
 		return nil, getError()
 	}
@@ -560,18 +771,19 @@ func LoadImageFromBuffer(data []byte) (*VipsImage, error) {
 // SaveImage saves an image in the specified format with the given quality.
 // Supported formats: jpeg/jpg, png, webp, avif, gif
 // Quality (1-100) applies to lossy formats like jpeg, webp, and avif.
+// The keep flags control which metadata is kept in the saved image, see VIPS_FOREIGN_KEEP_* constants.
 //
 // Example:
 //
 //	// Save as JPEG with 80% quality
-//	jpegData, err := vips.SaveImage(img, "jpeg", 80)
+//	jpegData, err := vips.SaveImage(img, "jpeg", 80, vips.VIPS_FOREIGN_KEEP_NONE)
 //	if err != nil {
 //	    log.Fatalf("Failed to save as JPEG: %v", err)
 //	}
 //
 //	// Save as WebP with 90% quality
-//	webpData, err := vips.SaveImage(img, "webp", 90)
-func SaveImageToBuffer(img *VipsImage, format string, quality int) ([]byte, error) {
+//	webpData, err := vips.SaveImage(img, "webp", 90, vips.VIPS_FOREIGN_KEEP_ICC)
+func SaveImageToBuffer(img *VipsImage, format string, quality int, keep int) ([]byte, error) {
 	// Default quality if not specified
 	if quality <= 0 {
 		quality = 80 // Default quality
@@ -595,11 +807,15 @@ func SaveImageToBuffer(img *VipsImage, format string, quality int) ([]byte, erro
 	// Format-specific save functions
 	switch format {
 	case "webp":
-		result, data = SaveWebpImageToBuffer(img, quality)
-	case "jpeg":
-		result, data = SaveJpegImageToBuffer(img, quality)
+		result, data = SaveWebpImageToBuffer(img, quality, keep)
+	case "jpeg", "jpg":
+		result, data = SaveJpegImageToBuffer(img, quality, keep)
 	case "gif":
-		result, data = SaveGifImageToBuffer(img)
+		result, data = SaveGifImageToBuffer(img, keep)
+	case "png":
+		result, data = SavePngImageToBuffer(img, DefaultPngCompression, DefaultPngEffort, keep)
+	case "avif":
+		result, data = SaveAvifImageToBuffer(img, quality, DefaultAvifEffort, keep)
 	default:
 		return nil, fmt.Errorf("unsupported format: %s", format)
 	}
@@ -613,13 +829,14 @@ func SaveImageToBuffer(img *VipsImage, format string, quality int) ([]byte, erro
 }
 
 // SaveWebpImage saves an image in WebP format
-func SaveWebpImageToBuffer(img *VipsImage, quality int) (int, []byte) {
+func SaveWebpImageToBuffer(img *VipsImage, quality int, keep int) (int, []byte) {
 	if img == nil || img.ptr == nil {
 		return -1, nil
 	}
 
 	var ptr unsafe.Pointer
 	var size int
+	keepName, keepValue := metadataOption(keep)
 
 	// WebP uses the same quality scale as JPEG (1-100)
 	result := vipsWebpSaveBuffer(
@@ -628,6 +845,7 @@ func SaveWebpImageToBuffer(img *VipsImage, quality int) (int, []byte) {
 		unsafe.Pointer(&size),
 		"Q", quality,
 		"lossless", 0, // Use lossy compression
+		keepName, keepValue,
 		nil)
 
 	if result != 0 || ptr == nil || size == 0 {
@@ -647,13 +865,14 @@ func SaveWebpImageToBuffer(img *VipsImage, quality int) (int, []byte) {
 }
 
 // SaveJpegImage saves an image in JPEG format
-func SaveJpegImageToBuffer(img *VipsImage, quality int) (int, []byte) {
+func SaveJpegImageToBuffer(img *VipsImage, quality int, keep int) (int, []byte) {
 	if img == nil || img.ptr == nil {
 		return -1, nil
 	}
 
 	var ptr unsafe.Pointer
 	var size int
+	keepName, keepValue := metadataOption(keep)
 
 	// Set Q parameter for JPEG quality (1-100) and optimize for progressive display
 	result := vipsJpegSaveBuffer(
@@ -662,6 +881,7 @@ func SaveJpegImageToBuffer(img *VipsImage, quality int) (int, []byte) {
 		unsafe.Pointer(&size),
 		"Q", quality,
 		"optimize_coding", 1,
+		keepName, keepValue,
 		nil)
 
 	if result != 0 || ptr == nil || size == 0 {
@@ -682,19 +902,21 @@ func SaveJpegImageToBuffer(img *VipsImage, quality int) (int, []byte) {
 }
 
 // SaveGifImageToBuffer saves an image in GIF format
-func SaveGifImageToBuffer(img *VipsImage) (int, []byte) {
+func SaveGifImageToBuffer(img *VipsImage, keep int) (int, []byte) {
 	if img == nil || img.ptr == nil {
 		return -1, nil
 	}
 
 	var ptr unsafe.Pointer
 	var size int
+	keepName, keepValue := metadataOption(keep)
 
 	// Call vips_gifsave_buffer
 	result := vipsGifSaveBuffer(
 		img.ptr,
 		unsafe.Pointer(&ptr),
 		unsafe.Pointer(&size),
+		keepName, keepValue,
 		nil,
 	)
 
@@ -715,6 +937,82 @@ func SaveGifImageToBuffer(img *VipsImage) (int, []byte) {
 	return result, data
 }
 
+// SavePngImageToBuffer saves an image in PNG format.
+// PNG is lossless, so there's no quality option.
+// The compression is zlib compression level (0-9) and effort is CPU effort (1-10).
+func SavePngImageToBuffer(img *VipsImage, compression int, effort int, keep int) (int, []byte) {
+	if img == nil || img.ptr == nil {
+		return -1, nil
+	}
+
+	var ptr unsafe.Pointer
+	var size int
+	keepName, keepValue := metadataOption(keep)
+
+	result := vipsPngSaveBuffer(
+		img.ptr,
+		unsafe.Pointer(&ptr),
+		unsafe.Pointer(&size),
+		"compression", compression,
+		"effort", effort,
+		keepName, keepValue,
+		nil)
+
+	if result != 0 || ptr == nil || size == 0 {
+		if debug {
+			logger.Debug("PNG save failed: result=%d, ptr=%v, size=%d", result, ptr, size)
+		}
+		return result, nil
+	}
+
+	// Copy the data before freeing the pointer
+	data := make([]byte, size)
+	copy(data, (*[1 << 30]byte)(ptr)[:size:size])
+
+	// Free the libvips-allocated memory directly with gFree
+	gFree(ptr)
+
+	return result, data
+}
+
+// SaveAvifImageToBuffer saves an image in AVIF format.
+// It uses heifsave with AV1 compression and given quality (1-100) and CPU effort (0-9).
+func SaveAvifImageToBuffer(img *VipsImage, quality int, effort int, keep int) (int, []byte) {
+	if img == nil || img.ptr == nil {
+		return -1, nil
+	}
+
+	var ptr unsafe.Pointer
+	var size int
+	keepName, keepValue := metadataOption(keep)
+
+	result := vipsHeifSaveBuffer(
+		img.ptr,
+		unsafe.Pointer(&ptr),
+		unsafe.Pointer(&size),
+		"Q", quality,
+		"compression", VIPS_FOREIGN_HEIF_COMPRESSION_AV1,
+		"effort", effort,
+		keepName, keepValue,
+		nil)
+
+	if result != 0 || ptr == nil || size == 0 {
+		if debug {
+			logger.Debug("AVIF save failed: result=%d, ptr=%v, size=%d", result, ptr, size)
+		}
+		return result, nil
+	}
+
+	// Copy the data before freeing the pointer
+	data := make([]byte, size)
+	copy(data, (*[1 << 30]byte)(ptr)[:size:size])
+
+	// Free the libvips-allocated memory directly with gFree
+	gFree(ptr)
+
+	return result, data
+}
+
 // GetImageWidth returns the width of the image in pixels.
 func GetImageWidth(img *VipsImage) int {
 	if img == nil || img.ptr == nil {
@@ -743,6 +1041,14 @@ func GetImageHeight(img *VipsImage) int {
 	return height
 }
 
+// ImageHasAlpha returns true if the image has an alpha channel (transparency).
+func ImageHasAlpha(img *VipsImage) bool {
+	if img == nil || img.ptr == nil {
+		return false
+	}
+	return vipsImageHasAlpha(img.ptr) != 0
+}
+
 // Free releases all resources associated with the image, including the parent operation
 // and associated source object. This method should be called when you're done with an image
 // to prevent memory leaks. It follows this order:
@@ -805,6 +1111,8 @@ func StringToFormat(format string) ImageFormat {
 		return PNG
 	case "tiff":
 		return TIFF
+	case "avif":
+		return AVIF
 	}
 	return UNKNOWN
 }
@@ -833,6 +1141,15 @@ func GetImageFormat(buf []byte) ImageFormat {
 		// This is naked jxl file header
 		return JXL
 	}
+	if string(buf[4:8]) == "ftyp" {
+		// This is an ISOBMFF-based container, the brand tells the format of the image
+		switch string(buf[8:12]) {
+		case "avif", "avis":
+			return AVIF
+		case "heic", "heix", "hevc", "hevx", "heim", "heis", "mif1", "msf1":
+			return HEIF
+		}
+	}
 	if buf[0] == 0x0 && buf[1] == 0x0 && buf[2] == 0x0 && buf[3] == 0x0C &&
 		buf[4] == 0x4A && buf[5] == 0x58 && buf[6] == 0x4C && buf[7] == 0x20 &&
 		buf[8] == 0x0D && buf[9] == 0x0A && buf[10] == 0x87 && buf[11] == 0x0A {
@@ -896,113 +1213,1191 @@ func ResizeImage(img *VipsImage, scale float64) (*VipsImage, error) {
 	return image, nil
 }
 
-// LoadImageFromFile loads an image from a file path.
-// Supported formats: JPEG, WebP
+// AutoRotateImage rotates and flips the image based on its EXIF orientation tag,
+// so photos taken by phones are displayed upright. The orientation tag is removed from the output image.
+// Images without the orientation tag are returned unchanged.
 //
 // Example:
 //
-//	img, err := vips2.LoadImageFromFile("image.jpg")
+//	rotatedImg, err := vips.AutoRotateImage(img)
 //	if err != nil {
-//	    log.Fatalf("Failed to load image: %v", err)
+//	    log.Fatalf("Failed to rotate image: %v", err)
 //	}
-func LoadImageFromFile(filePath string) (*VipsImage, error) {
-	if filePath == "" {
-		return nil, fmt.Errorf("invalid empty file path")
+func AutoRotateImage(img *VipsImage) (*VipsImage, error) {
+	if img == nil || img.ptr == nil {
+		return nil, fmt.Errorf("invalid image pointer")
 	}
 
-	// Check if file exists and is readable
-	fileInfo, err := os.Stat(filePath)
-	if err != nil {
-		return nil, fmt.Errorf("error accessing file: %w", err)
+	// Clear any previous errors
+	clearError()
+
+	var out unsafe.Pointer
+	result := vipsAutorot(img.ptr, unsafe.Pointer(&out), nil)
+	if result != 0 || out == nil {
+		return nil, getError()
 	}
-	if fileInfo.IsDir() {
-		return nil, fmt.Errorf("path is a directory, not a file")
+
+	return &VipsImage{
+		ptr:         out,
+		ImageFormat: img.ImageFormat,
+	}, nil
+}
+
+// TransformImageToSrgb converts the image colors from its embedded ICC profile to the sRGB color space,
+// so images with wide-gamut or CMYK profiles are displayed with the same colors in all browsers
+// even after the metadata is stripped.
+//
+// Example:
+//
+//	if vips.ImageHasIccProfile(img) {
+//	    srgbImg, err := vips.TransformImageToSrgb(img)
+//	}
+func TransformImageToSrgb(img *VipsImage) (*VipsImage, error) {
+	if img == nil || img.ptr == nil {
+		return nil, fmt.Errorf("invalid image pointer")
 	}
 
 	// Clear any previous errors
 	clearError()
 
-	// Determine image type from file extension
-	ext := strings.ToLower(filepath.Ext(filePath))
-	if ext == "" {
-		return nil, fmt.Errorf("file has no extension, cannot determine image type")
+	var out unsafe.Pointer
+	result := vipsIccTransform(img.ptr, unsafe.Pointer(&out), "srgb", "embedded", 1, nil)
+	if result != 0 || out == nil {
+		return nil, getError()
 	}
-	ext = ext[1:] // Remove leading dot
 
-	imageFormat := StringToFormat(ext)
+	return &VipsImage{
+		ptr:         out,
+		ImageFormat: img.ImageFormat,
+	}, nil
+}
 
-	imagePtr := vipsImageNewFromFile(filePath, nil)
-	if imagePtr == nil {
+// ImageHasIccProfile returns true if the image has an embedded ICC profile.
+func ImageHasIccProfile(img *VipsImage) bool {
+	if img == nil || img.ptr == nil {
+		return false
+	}
+	return vipsImageGetTypeof(img.ptr, VIPS_META_ICC_NAME) != 0
+}
+
+// metadataOption returns the save option name and value that controls which metadata is kept in the saved image.
+// The older libvips versions don't support the "keep" flags, so we can either strip all metadata or keep all of them.
+func metadataOption(keep int) (string, int) {
+	if supportsKeep {
+		return "keep", keep
+	}
+	if keep == VIPS_FOREIGN_KEEP_NONE {
+		return "strip", 1
+	}
+	return "strip", 0
+}
+
+// ThumbnailImage resizes an already loaded image to fit into the given dimensions.
+// The size argument controls how the image is scaled, see VIPS_SIZE_* constants.
+// With VIPS_SIZE_FORCE the image is scaled exactly to the given dimensions and the aspect ratio is not preserved.
+//
+// Example:
+//
+//	// Resize to exactly 200x100 pixels
+//	thumbnail, err := vips.ThumbnailImage(img, 200, 100, vips.VIPS_SIZE_FORCE)
+//	if err != nil {
+//	    log.Fatalf("Failed to resize image: %v", err)
+//	}
+func ThumbnailImage(img *VipsImage, width int, height int, size int) (*VipsImage, error) {
+	if img == nil || img.ptr == nil {
+		return nil, fmt.Errorf("invalid image pointer")
+	}
+
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("invalid thumbnail dimensions: %dx%d (must be positive)", width, height)
+	}
+
+	// Clear any previous errors
+	clearError()
+
+	var out unsafe.Pointer
+	result := vipsThumbnailImage(img.ptr, unsafe.Pointer(&out), width, "height", height, "size", size, nil)
+	if result != 0 || out == nil {
 		return nil, getError()
 	}
 
-	image := &VipsImage{
-		ptr:         imagePtr,
-		ImageFormat: imageFormat,
+	return &VipsImage{
+		ptr:         out,
+		ImageFormat: img.ImageFormat,
+	}, nil
+}
+
+// CropImage extracts the area of the given dimensions from the image
+// starting at the left and top offset.
+//
+// Example:
+//
+//	// Crop 100x100 pixels from the top-left corner
+//	croppedImg, err := vips.CropImage(img, 0, 0, 100, 100)
+//	if err != nil {
+//	    log.Fatalf("Failed to crop image: %v", err)
+//	}
+func CropImage(img *VipsImage, left int, top int, width int, height int) (*VipsImage, error) {
+	if img == nil || img.ptr == nil {
+		return nil, fmt.Errorf("invalid image pointer")
 	}
 
-	return image, nil
+	if left < 0 || top < 0 || width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("invalid crop area: %dx%d at %d,%d", width, height, left, top)
+	}
+
+	// Clear any previous errors
+	clearError()
+
+	var out unsafe.Pointer
+	result := vipsCrop(img.ptr, unsafe.Pointer(&out), left, top, width, height, nil)
+	if result != 0 || out == nil {
+		return nil, getError()
+	}
+
+	return &VipsImage{
+		ptr:         out,
+		ImageFormat: img.ImageFormat,
+	}, nil
 }
 
-// SaveImageToFile saves an image to a file path.
-// Supported formats: JPEG, WebP
+// SmartCropImage crops the image to the given dimensions
+// and keeps the most interesting part of the image, see VIPS_INTERESTING_* constants.
+// VIPS_INTERESTING_ENTROPY keeps the area with the most details,
+// VIPS_INTERESTING_ATTENTION keeps the area with skin tones, saturated colors and edges.
 //
 // Example:
 //
-//	err := vips2.SaveImageToFile(img, "output.jpg", 80)
+//	croppedImg, err := vips.SmartCropImage(img, 100, 100, vips.VIPS_INTERESTING_ATTENTION)
 //	if err != nil {
-//	    log.Fatalf("Failed to save image: %v", err)
+//	    log.Fatalf("Failed to crop image: %v", err)
 //	}
-func SaveImageToFile(image *VipsImage, filePath string, quality int) error {
-	if image == nil || image.ptr == nil {
-		return fmt.Errorf("invalid image pointer")
+func SmartCropImage(img *VipsImage, width int, height int, interesting int) (*VipsImage, error) {
+	if img == nil || img.ptr == nil {
+		return nil, fmt.Errorf("invalid image pointer")
 	}
 
-	if filePath == "" {
-		return fmt.Errorf("invalid empty file path")
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("invalid crop dimensions: %dx%d (must be positive)", width, height)
 	}
 
-	// Default quality if not specified
-	if quality <= 0 {
-		quality = 80 // Default quality
+	// Clear any previous errors
+	clearError()
+
+	var out unsafe.Pointer
+	result := vipsSmartCrop(img.ptr, unsafe.Pointer(&out), width, height, "interesting", interesting, nil)
+	if result != 0 || out == nil {
+		return nil, getError()
 	}
 
-	// Ensure quality is within reasonable limits
-	if quality > 100 {
-		quality = 100
+	return &VipsImage{
+		ptr:         out,
+		ImageFormat: img.ImageFormat,
+	}, nil
+}
+
+// EmbedImage places the image at the left and top offset within a larger canvas of the given dimensions.
+// The extend argument controls how the new pixels are generated, see VIPS_EXTEND_* constants.
+// VIPS_EXTEND_BLACK fills the canvas with black pixels, or transparent pixels if the image has an alpha channel.
+//
+// Example:
+//
+//	// Center 100x50 image within 100x100 canvas
+//	embeddedImg, err := vips.EmbedImage(img, 0, 25, 100, 100, vips.VIPS_EXTEND_BLACK)
+//	if err != nil {
+//	    log.Fatalf("Failed to embed image: %v", err)
+//	}
+func EmbedImage(img *VipsImage, left int, top int, width int, height int, extend int) (*VipsImage, error) {
+	if img == nil || img.ptr == nil {
+		return nil, fmt.Errorf("invalid image pointer")
+	}
+
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("invalid canvas dimensions: %dx%d (must be positive)", width, height)
 	}
 
 	// Clear any previous errors
 	clearError()
 
-	// Determine format from file extension
-	ext := strings.ToLower(filepath.Ext(filePath))
-	if ext == "" {
-		return fmt.Errorf("file has no extension, cannot determine image format")
+	var out unsafe.Pointer
+	result := vipsEmbed(img.ptr, unsafe.Pointer(&out), left, top, width, height, "extend", extend, nil)
+	if result != 0 || out == nil {
+		return nil, getError()
 	}
-	ext = ext[1:] // Remove leading dot
 
-	// Convert file path to C string (null-terminated)
-	cFilePath := append([]byte(filePath), 0)
+	return &VipsImage{
+		ptr:         out,
+		ImageFormat: img.ImageFormat,
+	}, nil
+}
 
-	var code int
-	switch ext {
-	case "jpg", "jpeg":
-		cQuality := append([]byte("Q"), 0)
-		code = vipsJpegSave(image.ptr, &cFilePath[0], &cQuality[0], quality, nil, 0, nil)
-	case "webp":
-		// Set Q for quality and lossless=0 for lossy compression
-		cQuality := append([]byte("Q"), 0)
-		cLossless := append([]byte("lossless"), 0)
-		code = vipsWebpSave(
-			image.ptr,
-			&cFilePath[0],
-			&cQuality[0], quality,
-			&cLossless[0], 0,
-			nil)
-	case "gif":
-		cQuality := append([]byte("Q"), 0)
-		code = vipsGifSave(image.ptr, &cFilePath[0], &cQuality[0], quality, nil, 0, nil)
+// BlurImage blurs the image with the gaussian blur of the given sigma.
+// The larger sigma results in more blurred image.
+//
+// Example:
+//
+//	blurredImg, err := vips.BlurImage(img, 5)
+//	if err != nil {
+//	    log.Fatalf("Failed to blur image: %v", err)
+//	}
+func BlurImage(img *VipsImage, sigma float64) (*VipsImage, error) {
+	if img == nil || img.ptr == nil {
+		return nil, fmt.Errorf("invalid image pointer")
+	}
+
+	if sigma <= 0 {
+		return nil, fmt.Errorf("invalid blur sigma: %f (must be positive)", sigma)
+	}
+
+	// Clear any previous errors
+	clearError()
+
+	var out unsafe.Pointer
+	result := vipsGaussblur(img.ptr, unsafe.Pointer(&out), sigma, nil)
+	if result != 0 || out == nil {
+		return nil, getError()
+	}
+
+	return &VipsImage{
+		ptr:         out,
+		ImageFormat: img.ImageFormat,
+	}, nil
+}
+
+// SharpenImage sharpens the image with the default libvips settings
+// that work well for the images that were downscaled for the screen.
+// The options are not exposed because they are doubles that can't be safely passed
+// as variadic arguments through purego on all platforms.
+//
+// Example:
+//
+//	sharpenedImg, err := vips.SharpenImage(img)
+//	if err != nil {
+//	    log.Fatalf("Failed to sharpen image: %v", err)
+//	}
+func SharpenImage(img *VipsImage) (*VipsImage, error) {
+	if img == nil || img.ptr == nil {
+		return nil, fmt.Errorf("invalid image pointer")
+	}
+
+	// Clear any previous errors
+	clearError()
+
+	var out unsafe.Pointer
+	result := vipsSharpen(img.ptr, unsafe.Pointer(&out), nil)
+	if result != 0 || out == nil {
+		return nil, getError()
+	}
+
+	return &VipsImage{
+		ptr:         out,
+		ImageFormat: img.ImageFormat,
+	}, nil
+}
+
+// RotateImage rotates the image clockwise by the multiple of 90 degrees, see VIPS_ANGLE_* constants.
+//
+// Example:
+//
+//	// Rotate by 90 degrees clockwise
+//	rotatedImg, err := vips.RotateImage(img, vips.VIPS_ANGLE_D90)
+//	if err != nil {
+//	    log.Fatalf("Failed to rotate image: %v", err)
+//	}
+func RotateImage(img *VipsImage, angle int) (*VipsImage, error) {
+	if img == nil || img.ptr == nil {
+		return nil, fmt.Errorf("invalid image pointer")
+	}
+
+	if angle < VIPS_ANGLE_D0 || angle > VIPS_ANGLE_D270 {
+		return nil, fmt.Errorf("invalid rotate angle: %d", angle)
+	}
+
+	// Clear any previous errors
+	clearError()
+
+	var out unsafe.Pointer
+	result := vipsRot(img.ptr, unsafe.Pointer(&out), angle, nil)
+	if result != 0 || out == nil {
+		return nil, getError()
+	}
+
+	return &VipsImage{
+		ptr:         out,
+		ImageFormat: img.ImageFormat,
+	}, nil
+}
+
+// FlipImage mirrors the image in the given direction, see VIPS_DIRECTION_* constants.
+// VIPS_DIRECTION_HORIZONTAL swaps the left and right side of the image,
+// VIPS_DIRECTION_VERTICAL swaps the top and bottom side of the image.
+//
+// Example:
+//
+//	flippedImg, err := vips.FlipImage(img, vips.VIPS_DIRECTION_VERTICAL)
+//	if err != nil {
+//	    log.Fatalf("Failed to flip image: %v", err)
+//	}
+func FlipImage(img *VipsImage, direction int) (*VipsImage, error) {
+	if img == nil || img.ptr == nil {
+		return nil, fmt.Errorf("invalid image pointer")
+	}
+
+	if direction != VIPS_DIRECTION_HORIZONTAL && direction != VIPS_DIRECTION_VERTICAL {
+		return nil, fmt.Errorf("invalid flip direction: %d", direction)
+	}
+
+	// Clear any previous errors
+	clearError()
+
+	var out unsafe.Pointer
+	result := vipsFlip(img.ptr, unsafe.Pointer(&out), direction, nil)
+	if result != 0 || out == nil {
+		return nil, getError()
+	}
+
+	return &VipsImage{
+		ptr:         out,
+		ImageFormat: img.ImageFormat,
+	}, nil
+}
+
+// ColourspaceImage converts the image to the given color space, see VIPS_INTERPRETATION_* constants.
+// The alpha channel is kept unchanged.
+//
+// Example:
+//
+//	// Convert to grayscale
+//	grayImg, err := vips.ColourspaceImage(img, vips.VIPS_INTERPRETATION_B_W)
+//	if err != nil {
+//	    log.Fatalf("Failed to convert image: %v", err)
+//	}
+func ColourspaceImage(img *VipsImage, interpretation int) (*VipsImage, error) {
+	if img == nil || img.ptr == nil {
+		return nil, fmt.Errorf("invalid image pointer")
+	}
+
+	// Clear any previous errors
+	clearError()
+
+	var out unsafe.Pointer
+	result := vipsColourspace(img.ptr, unsafe.Pointer(&out), interpretation, nil)
+	if result != 0 || out == nil {
+		return nil, getError()
+	}
+
+	return &VipsImage{
+		ptr:         out,
+		ImageFormat: img.ImageFormat,
+	}, nil
+}
+
+// LinearImage calculates out = in * a + b for each pixel and casts the result back to 8-bit values.
+// The a and b slices contain either one value for all bands or one value per each band of the image.
+//
+// Example:
+//
+//	// Make RGB image 20% brighter and keep its alpha channel unchanged
+//	brighterImg, err := vips.LinearImage(img, []float64{1.2, 1.2, 1.2, 1}, []float64{0, 0, 0, 0})
+//	if err != nil {
+//	    log.Fatalf("Failed to change image: %v", err)
+//	}
+func LinearImage(img *VipsImage, a []float64, b []float64) (*VipsImage, error) {
+	if img == nil || img.ptr == nil {
+		return nil, fmt.Errorf("invalid image pointer")
+	}
+
+	if len(a) == 0 || len(a) != len(b) {
+		return nil, fmt.Errorf("invalid linear coefficients: %d and %d values", len(a), len(b))
+	}
+
+	// Clear any previous errors
+	clearError()
+
+	var out unsafe.Pointer
+	result := vipsLinear(img.ptr, unsafe.Pointer(&out), &a[0], &b[0], len(a), "uchar", 1, nil)
+	if result != 0 || out == nil {
+		return nil, getError()
+	}
+
+	return &VipsImage{
+		ptr:         out,
+		ImageFormat: img.ImageFormat,
+	}, nil
+}
+
+// CompositeImage places the overlay image over the base image at the given offset
+// with the VIPS_BLEND_MODE_OVER blend mode, so the transparent parts of the overlay show the base image.
+// The output image always has the alpha channel.
+//
+// Example:
+//
+//	// Place the watermark to the top-left corner
+//	watermarkedImg, err := vips.CompositeImage(img, watermark, 10, 10)
+//	if err != nil {
+//	    log.Fatalf("Failed to composite image: %v", err)
+//	}
+func CompositeImage(base *VipsImage, overlay *VipsImage, x int, y int) (*VipsImage, error) {
+	if base == nil || base.ptr == nil || overlay == nil || overlay.ptr == nil {
+		return nil, fmt.Errorf("invalid image pointer")
+	}
+
+	// Clear any previous errors
+	clearError()
+
+	var out unsafe.Pointer
+	result := vipsComposite2(base.ptr, overlay.ptr, unsafe.Pointer(&out), VIPS_BLEND_MODE_OVER, "x", x, "y", y, nil)
+	if result != 0 || out == nil {
+		return nil, getError()
+	}
+
+	return &VipsImage{
+		ptr:         out,
+		ImageFormat: base.ImageFormat,
+	}, nil
+}
+
+// AddAlphaImage adds the fully opaque alpha channel to the image.
+// It always appends new band, so check the image doesn't have the alpha channel yet with ImageHasAlpha.
+func AddAlphaImage(img *VipsImage) (*VipsImage, error) {
+	if img == nil || img.ptr == nil {
+		return nil, fmt.Errorf("invalid image pointer")
+	}
+
+	// Clear any previous errors
+	clearError()
+
+	var out unsafe.Pointer
+	result := vipsAddalpha(img.ptr, unsafe.Pointer(&out), nil)
+	if result != 0 || out == nil {
+		return nil, getError()
+	}
+
+	return &VipsImage{
+		ptr:         out,
+		ImageFormat: img.ImageFormat,
+	}, nil
+}
+
+// GetImageBands returns the number of bands (channels) of the image including the alpha channel.
+// e.g. 3 for RGB, 4 for RGBA, 1 for grayscale.
+func GetImageBands(img *VipsImage) int {
+	if img == nil || img.ptr == nil {
+		return 0
+	}
+	return vipsImageGetBands(img.ptr)
+}
+
+// GetImageBandMeans returns the average value of each band of the image calculated by vips_stats,
+// e.g. the average red, green, blue and alpha values for RGBA image.
+//
+// Example:
+//
+//	means, err := vips.GetImageBandMeans(img)
+//	if err != nil {
+//	    log.Fatalf("Failed to get image stats: %v", err)
+//	}
+//	fmt.Printf("Average color: rgb(%.0f, %.0f, %.0f)", means[0], means[1], means[2])
+func GetImageBandMeans(img *VipsImage) ([]float64, error) {
+	if img == nil || img.ptr == nil {
+		return nil, fmt.Errorf("invalid image pointer")
+	}
+
+	// Clear any previous errors
+	clearError()
+
+	var stats unsafe.Pointer
+	result := vipsStats(img.ptr, unsafe.Pointer(&stats), nil)
+	if result != 0 || stats == nil {
+		return nil, getError()
+	}
+	defer Unref(stats)
+
+	// The first row of stats contains the values for all bands together,
+	// the following rows contain the values for each band.
+	bands := vipsImageGetBands(img.ptr)
+	means := make([]float64, bands)
+	for band := 0; band < bands; band++ {
+		var vector unsafe.Pointer
+		var n int32
+		result := vipsGetpoint(stats, unsafe.Pointer(&vector), unsafe.Pointer(&n), VIPS_STATS_MEAN, band+1, nil)
+		if result != 0 || vector == nil || n < 1 {
+			return nil, getError()
+		}
+		means[band] = *(*float64)(vector)
+		gFree(vector)
+	}
+
+	return means, nil
+}
+
+// LoadImageFromFile loads an image from a file path.
+// Supported formats: JPEG, WebP
+//
+// Example:
+//
+//	img, err := vips2.LoadImageFromFile("image.jpg")
+//	if err != nil {
+//	    log.Fatalf("Failed to load image: %v", err)
+//	}
+func LoadImageFromFile(filePath string) (*VipsImage, error) {
+	if filePath == "" {
+		return nil, fmt.Errorf("invalid empty file path")
+	}
+
+	// Check if file exists and is readable
+	fileInfo, err := os.Stat(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("error accessing file: %w", err)
+	}
+	if fileInfo.IsDir() {
+		return nil, fmt.Errorf("path is a directory, not a file")
+	}
+
+	// Clear any previous errors
+	clearError()
+
+	// Determine image type from file extension
+	ext := strings.ToLower(filepath.Ext(filePath))
+	if ext == "" {
+		return nil, fmt.Errorf("file has no extension, cannot determine image type")
+	}
+	ext = ext[1:] // Remove leading dot
+
+	imageFormat := StringToFormat(ext)
+
+	imagePtr := vipsImageNewFromFile(filePath, nil)
+	if imagePtr == nil {
+		return nil, getError()
+	}
+
+	image := &VipsImage{
+		ptr:         imagePtr,
+		ImageFormat: imageFormat,
+	}
+
+	return image, nil
+}
+
+// Names of the color spaces (interpretations) of the images.
+// See: https://www.libvips.org/API/current/enum.Interpretation.html
+var interpretationNames = map[int]string{
+	0:  "multiband",
+	1:  "b-w",
+	10: "histogram",
+	12: "xyz",
+	13: "lab",
+	15: "cmyk",
+	16: "labq",
+	17: "rgb",
+	18: "cmc",
+	19: "lch",
+	21: "labs",
+	22: "srgb",
+	23: "yxy",
+	24: "fourier",
+	25: "rgb16",
+	26: "grey16",
+	27: "matrix",
+	28: "scrgb",
+	29: "hsv",
+}
+
+// GetImageColourspace returns the name of the image color space, e.g. "srgb", "b-w" or "cmyk".
+func GetImageColourspace(img *VipsImage) string {
+	if img == nil || img.ptr == nil {
+		return ""
+	}
+	interpretation := vipsImageGetInterpretation(img.ptr)
+	if name, ok := interpretationNames[interpretation]; ok {
+		return name
+	}
+	return strconv.Itoa(interpretation)
+}
+
+// GetImageOrientation returns the EXIF orientation of the image in the range 1-8.
+// The images without the orientation tag return 1 (no rotation).
+// The orientations 5-8 mean the image is rotated by 90 or 270 degrees,
+// so its displayed width and height are swapped.
+func GetImageOrientation(img *VipsImage) int {
+	if img == nil || img.ptr == nil {
+		return 1
+	}
+
+	var orientation int32
+	if vipsImageGetInt(img.ptr, VIPS_META_ORIENTATION, unsafe.Pointer(&orientation)) != 0 {
+		clearError()
+		return 1
+	}
+	if orientation < 1 || orientation > 8 {
+		return 1
+	}
+	return int(orientation)
+}
+
+// GetImageField returns the string value of the image field such as EXIF tag,
+// or empty string if the image doesn't have it.
+// The EXIF tags have the "exif-ifd<N>-<Tag>" names and libvips formats their values like "Canon (Canon, ASCII, 6 components, 6 bytes)".
+//
+// Example:
+//
+//	make := vips.GetImageField(img, "exif-ifd0-Make")
+func GetImageField(img *VipsImage, name string) string {
+	if img == nil || img.ptr == nil {
+		return ""
+	}
+
+	var value unsafe.Pointer
+	if vipsImageGetString(img.ptr, name, unsafe.Pointer(&value)) != 0 || value == nil {
+		clearError()
+		return ""
+	}
+
+	// The string is owned by the image, so we need to copy it
+	length := 0
+	for *(*byte)(unsafe.Add(value, length)) != 0 {
+		length++
+	}
+	return string(unsafe.Slice((*byte)(value), length))
+}
+
+// GetImageLoader returns the name of the libvips loader for the image file detected from its content,
+// e.g. "VipsForeignLoadJpegFile", "VipsForeignLoadGifFile" or "VipsForeignLoadNsgifFile".
+// Returns empty string if the format is not supported.
+func GetImageLoader(filePath string) string {
+	// Clear any previous errors
+	clearError()
+	defer clearError()
+
+	return vipsForeignFindLoad(filePath)
+}
+
+// IsAnimatedLoader returns true if the loader supports images with multiple frames (pages),
+// such as animated GIF and WebP images.
+func IsAnimatedLoader(loader string) bool {
+	return strings.Contains(loader, "Gif") || strings.Contains(loader, "Webp")
+}
+
+// LoadImageFromFileWithPages loads the frames (pages) of animated GIF or WebP image from a file path.
+// The page is the index of the first frame to load and n is the number of frames to load, -1 loads all frames.
+// All frames are stacked vertically into single tall image, see GetImagePageHeight and GetImagePages.
+// The loader needs to support animated images, see IsAnimatedLoader.
+//
+// Example:
+//
+//	// Load all frames of animated GIF
+//	img, err := vips.LoadImageFromFileWithPages("image.gif", 0, -1)
+//	if err != nil {
+//	    log.Fatalf("Failed to load image: %v", err)
+//	}
+func LoadImageFromFileWithPages(filePath string, page int, n int) (*VipsImage, error) {
+	if filePath == "" {
+		return nil, fmt.Errorf("invalid empty file path")
+	}
+
+	if page < 0 || n == 0 || n < -1 {
+		return nil, fmt.Errorf("invalid pages: page=%d, n=%d", page, n)
+	}
+
+	// Clear any previous errors
+	clearError()
+
+	imagePtr := vipsImageNewFromFilePages(filePath, "page", page, "n", n, nil)
+	if imagePtr == nil {
+		return nil, getError()
+	}
+
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(filePath), "."))
+	return &VipsImage{
+		ptr:         imagePtr,
+		ImageFormat: StringToFormat(ext),
+	}, nil
+}
+
+// GetImageBufferLoader returns the name of the libvips loader for the image in memory, e.g. "VipsForeignLoadGifBuffer",
+// or empty string if the format is not supported. The format is detected from the magic bytes.
+func GetImageBufferLoader(data []byte) string {
+	if len(data) == 0 {
+		return ""
+	}
+	// Clear any previous errors
+	clearError()
+	defer clearError()
+
+	return vipsForeignFindLoadBuffer(unsafe.Pointer(&data[0]), len(data))
+}
+
+// LoadImageFromBufferWithPages loads the frames (pages) of animated image from memory.
+// The page is the index of the first frame to load and n is the number of frames, -1 loads all frames.
+// The frames are stacked vertically into single tall image with the page-height metadata.
+// Like LoadImageFromBuffer, the data needs to stay alive until the image is freed.
+//
+// Example:
+//
+//	// Load all frames of animated GIF
+//	img, err := vips.LoadImageFromBufferWithPages(data, 0, -1)
+//	if err != nil {
+//	    log.Fatalf("Failed to load image: %v", err)
+//	}
+func LoadImageFromBufferWithPages(data []byte, page int, n int) (*VipsImage, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("invalid empty image data")
+	}
+
+	clearError()
+
+	imagePtr := vipsImageNewFromBufferPages(unsafe.Pointer(&data[0]), len(data), loadOptions(), "page", page, "n", n, nil)
+	if imagePtr == nil {
+		return nil, getError()
+	}
+
+	return &VipsImage{
+		ptr:         imagePtr,
+		ImageFormat: GetImageFormat(data),
+	}, nil
+}
+
+// LoadHeifImageFromBuffer loads the HEIC/HEIF or AVIF image from memory with the heifload loader,
+// e.g. the photos uploaded from iPhone. It fails if the library was built without libheif.
+// Like LoadImageFromBuffer, the data needs to stay alive until the image is freed.
+func LoadHeifImageFromBuffer(data []byte) (*VipsImage, error) {
+	return loadImageFromBufferWith(data, HEIF, vipsHeifLoadBuffer)
+}
+
+// LoadJxlImageFromBuffer loads the JPEG XL image from memory with the jxlload loader.
+// It fails if the library was built without libjxl.
+// Like LoadImageFromBuffer, the data needs to stay alive until the image is freed.
+func LoadJxlImageFromBuffer(data []byte) (*VipsImage, error) {
+	return loadImageFromBufferWith(data, JXL, vipsJxlLoadBuffer)
+}
+
+// loadImageFromBufferWith loads the image from memory with the given optional loader.
+func loadImageFromBufferWith(data []byte, format ImageFormat, loader func(unsafe.Pointer, int, unsafe.Pointer, string, int, unsafe.Pointer) int) (*VipsImage, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("invalid empty image data")
+	}
+	if loader == nil || !supportedInputFormats[format] {
+		return nil, fmt.Errorf("%s images are not supported by the loaded libvips library", strings.ToUpper(string(format)))
+	}
+
+	clearError()
+
+	var ptr unsafe.Pointer
+	failOnName, failOnValue := failOnOption()
+	if loader(unsafe.Pointer(&data[0]), len(data), unsafe.Pointer(&ptr), failOnName, failOnValue, nil) != 0 || ptr == nil {
+		return nil, getError()
+	}
+
+	return &VipsImage{
+		ptr:         ptr,
+		ImageFormat: GetImageFormat(data),
+	}, nil
+}
+
+// The libvips operations that load and save the image formats from and to memory.
+// The operations available in the loaded library depend on how it was built.
+var (
+	inputFormatLoaders = map[ImageFormat]string{
+		JPEG: "jpegload_buffer",
+		PNG:  "pngload_buffer",
+		WEBP: "webpload_buffer",
+		GIF:  "gifload_buffer",
+		TIFF: "tiffload_buffer",
+		HEIF: "heifload_buffer",
+		AVIF: "heifload_buffer",
+		JXL:  "jxlload_buffer",
+		SVG:  "svgload_buffer",
+		PDF:  "pdfload_buffer",
+	}
+	outputFormatSavers = map[ImageFormat]string{
+		JPEG: "jpegsave_buffer",
+		PNG:  "pngsave_buffer",
+		WEBP: "webpsave_buffer",
+		GIF:  "gifsave_buffer",
+		AVIF: "heifsave_buffer",
+	}
+)
+
+// detectSupportedFormats finds the loaders and savers available in the loaded library.
+// The HEIF and JPEG XL loaders are supported only if we also registered their functions.
+func detectSupportedFormats() {
+	supportedInputFormats = map[ImageFormat]bool{}
+	supportedOutputFormats = map[ImageFormat]bool{}
+	for format, operation := range inputFormatLoaders {
+		supportedInputFormats[format] = vipsTypeFind("VipsOperation", operation) != 0
+	}
+	for format, operation := range outputFormatSavers {
+		supportedOutputFormats[format] = vipsTypeFind("VipsOperation", operation) != 0
+	}
+	supportedInputFormats[HEIF] = supportedInputFormats[HEIF] && vipsHeifLoadBuffer != nil
+	supportedInputFormats[AVIF] = supportedInputFormats[AVIF] && vipsHeifLoadBuffer != nil
+	supportedInputFormats[JXL] = supportedInputFormats[JXL] && vipsJxlLoadBuffer != nil
+}
+
+// SupportsInputFormat returns true if the loaded library can load the images of given format.
+func SupportsInputFormat(format ImageFormat) bool {
+	return supportedInputFormats[format]
+}
+
+// GetSupportedInputFormats returns the sorted formats the loaded library can load, e.g. [gif heif jpeg png webp]
+func GetSupportedInputFormats() []ImageFormat {
+	return sortedFormats(supportedInputFormats)
+}
+
+// GetSupportedOutputFormats returns the sorted formats the loaded library can save, e.g. [avif gif jpeg png webp]
+func GetSupportedOutputFormats() []ImageFormat {
+	return sortedFormats(supportedOutputFormats)
+}
+
+// sortedFormats returns the sorted formats that are set to true.
+func sortedFormats(formats map[ImageFormat]bool) []ImageFormat {
+	result := []ImageFormat{}
+	for format, supported := range formats {
+		if supported {
+			result = append(result, format)
+		}
+	}
+	slices.Sort(result)
+	return result
+}
+
+// hasSymbol returns true if the loaded library exports the function with given name.
+func hasSymbol(name string) bool {
+	_, err := purego.Dlsym(libvips, name)
+	return err == nil
+}
+
+// ImageHeader holds the dimensions of the image read from its header without decoding the pixels.
+type ImageHeader struct {
+	Width  int // Width of the image in pixels
+	Height int // Height of single frame (page) in pixels
+	Pages  int // Number of frames (pages) of animated image, 1 for the static images
+}
+
+// Pixels returns the number of pixels of single frame.
+func (h ImageHeader) Pixels() int64 {
+	return int64(h.Width) * int64(h.Height)
+}
+
+// GetImageHeaderFromBuffer reads the dimensions of the image in memory from its header
+// without decoding the pixels, so it can be used to reject decompression bombs
+// that declare enormous dimensions before they're fully loaded.
+//
+// Example:
+//
+//	header, err := vips.GetImageHeaderFromBuffer(data)
+//	if err == nil && header.Pixels() > 40_000_000 {
+//	    log.Fatalf("The image is too large: %dx%d", header.Width, header.Height)
+//	}
+func GetImageHeaderFromBuffer(data []byte) (ImageHeader, error) {
+	if len(data) == 0 {
+		return ImageHeader{}, fmt.Errorf("invalid empty image data")
+	}
+
+	clearError()
+
+	if format := GetImageFormat(data); format != UNKNOWN && !SupportsInputFormat(format) {
+		return ImageHeader{}, fmt.Errorf("%s images are not supported by the loaded libvips library", strings.ToUpper(string(format)))
+	}
+
+	// The sequential access tells the loader the pixels are read just once from top to bottom,
+	// so it doesn't prepare any random access cache. We only read the header fields anyway.
+	ptr := vipsImageNewFromBuffer(unsafe.Pointer(&data[0]), len(data), "access=sequential", nil)
+	if ptr == nil {
+		return ImageHeader{}, getError()
+	}
+	// The deferred calls run in reverse order,
+	// so the data stays alive until the image that reads from it is freed.
+	defer runtime.KeepAlive(data)
+	img := &VipsImage{ptr: ptr}
+	defer img.Free()
+
+	return ImageHeader{
+		Width:  GetImageWidth(img),
+		Height: GetImagePageHeight(img),
+		Pages:  GetImageFilePages(img),
+	}, nil
+}
+
+// The values of VipsFailOn enum for the fail_on load option.
+var failOnValues = map[string]int{
+	VIPS_FAIL_ON_NONE:      0,
+	VIPS_FAIL_ON_TRUNCATED: 1,
+	VIPS_FAIL_ON_ERROR:     2,
+	VIPS_FAIL_ON_WARNING:   3,
+}
+
+// failOnOption returns the name and value of the load option with the configured fail_on level.
+func failOnOption() (string, int) {
+	if supportsFailOn {
+		return "fail_on", failOnValues[failOn]
+	}
+	if failOn != VIPS_FAIL_ON_NONE {
+		return "fail", 1
+	}
+	return "fail", 0
+}
+
+// loadOptions returns the option string for the buffer loaders with the configured fail_on level.
+func loadOptions() string {
+	if supportsFailOn {
+		return "fail_on=" + failOn
+	}
+	if failOn != VIPS_FAIL_ON_NONE {
+		return "fail=true"
+	}
+	return ""
+}
+
+// The domains of the errors that libvips loaders return for the truncated or corrupt images,
+// e.g. "VipsJpeg: Premature end of input file" or "gifload_buffer: no frames in GIF"
+var decodeErrorDomains = regexp.MustCompile(`^(VipsForeignLoad\w*|VipsJpeg|\w+load(_buffer|_source)?|\w+2vips):`)
+
+// IsDecodeError returns true if the error was returned by the libvips loader while decoding the image,
+// e.g. because the image is truncated or corrupt.
+// The loaders decode the pixels lazily, so the decode errors are usually returned by the processing operations or savers.
+func IsDecodeError(err error) bool {
+	vipsErr, ok := err.(*Error)
+	if !ok {
+		return false
+	}
+	for _, line := range strings.Split(vipsErr.Message, "\n") {
+		if decodeErrorDomains.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetImageKill stops the evaluation of all pipelines that read the pixels of the image,
+// so the running processing or saving of the images created from it fails as soon as possible.
+// It can be called from any goroutine, e.g. when the processing takes too long.
+func SetImageKill(img *VipsImage, kill bool) {
+	if img == nil || img.ptr == nil {
+		return
+	}
+	killInt := 0
+	if kill {
+		killInt = 1
+	}
+	vipsImageSetKill(img.ptr, killInt)
+}
+
+// GetImagePageHeight returns the height of single frame (page) of animated image in pixels.
+// It's the same as the image height for the images with single frame.
+func GetImagePageHeight(img *VipsImage) int {
+	if img == nil || img.ptr == nil {
+		return 0
+	}
+	return vipsImageGetPageHeight(img.ptr)
+}
+
+// GetImagePages returns the number of frames (pages) of animated image.
+// It's 1 for the images with single frame.
+func GetImagePages(img *VipsImage) int {
+	if img == nil || img.ptr == nil {
+		return 0
+	}
+	pageHeight := vipsImageGetPageHeight(img.ptr)
+	if pageHeight <= 0 {
+		return 1
+	}
+	return max(1, vipsImageGetHeight(img.ptr)/pageHeight)
+}
+
+// GetImageFilePages returns the number of frames (pages) in the source file of the image.
+// Unlike GetImagePages, it doesn't depend on how many frames were loaded,
+// so it returns the total number of frames even for the image loaded with just the first frame.
+func GetImageFilePages(img *VipsImage) int {
+	if img == nil || img.ptr == nil {
+		return 0
+	}
+	var pages int32
+	if vipsImageGetInt(img.ptr, VIPS_META_N_PAGES, unsafe.Pointer(&pages)) != 0 {
+		clearError()
+		return GetImagePages(img)
+	}
+	return max(1, int(pages))
+}
+
+// GetImageFrame extracts single frame of animated image as standalone image with single page.
+// The other metadata such as frame delays and loop count are kept.
+//
+// Example:
+//
+//	// Extract the first frame of animated GIF as the poster image
+//	poster, err := vips.GetImageFrame(img, 0)
+//	if err != nil {
+//	    log.Fatalf("Failed to extract frame: %v", err)
+//	}
+func GetImageFrame(img *VipsImage, index int) (*VipsImage, error) {
+	if img == nil || img.ptr == nil {
+		return nil, fmt.Errorf("invalid image pointer")
+	}
+
+	pages := GetImagePages(img)
+	if index < 0 || index >= pages {
+		return nil, fmt.Errorf("invalid frame index: %d (image has %d frames)", index, pages)
+	}
+
+	pageHeight := vipsImageGetPageHeight(img.ptr)
+	frame, err := CropImage(img, 0, index*pageHeight, vipsImageGetWidth(img.ptr), pageHeight)
+	if err != nil {
+		return nil, err
+	}
+	defer frame.Free()
+
+	return setImagePages(frame, pageHeight, 1)
+}
+
+// JoinImageFrames stacks the frames of the same size vertically into single animated image.
+// The metadata such as frame delays and loop count are taken from the first frame.
+//
+// Example:
+//
+//	animatedImg, err := vips.JoinImageFrames([]*vips.VipsImage{frame1, frame2})
+//	if err != nil {
+//	    log.Fatalf("Failed to join frames: %v", err)
+//	}
+func JoinImageFrames(frames []*VipsImage) (*VipsImage, error) {
+	if len(frames) == 0 {
+		return nil, fmt.Errorf("no frames to join")
+	}
+
+	ptrs := make([]unsafe.Pointer, len(frames))
+	for i, frame := range frames {
+		if frame == nil || frame.ptr == nil {
+			return nil, fmt.Errorf("invalid frame pointer")
+		}
+		ptrs[i] = frame.ptr
+	}
+
+	// Clear any previous errors
+	clearError()
+
+	var out unsafe.Pointer
+	result := vipsArrayjoin(unsafe.Pointer(&ptrs[0]), unsafe.Pointer(&out), len(ptrs), "across", 1, nil)
+	if result != 0 || out == nil {
+		return nil, getError()
+	}
+	joined := &VipsImage{
+		ptr:         out,
+		ImageFormat: frames[0].ImageFormat,
+	}
+	defer joined.Free()
+
+	return setImagePages(joined, vipsImageGetHeight(frames[0].ptr), len(frames))
+}
+
+// setImagePages returns the copy of the image with updated page height and number of pages.
+// The metadata can't be changed on the image directly, because it can be shared by libvips operation cache.
+func setImagePages(img *VipsImage, pageHeight int, pages int) (*VipsImage, error) {
+	// Clear any previous errors
+	clearError()
+
+	var out unsafe.Pointer
+	result := vipsCopy(img.ptr, unsafe.Pointer(&out), nil)
+	if result != 0 || out == nil {
+		return nil, getError()
+	}
+	vipsImageSetInt(out, VIPS_META_PAGE_HEIGHT, pageHeight)
+	vipsImageSetInt(out, VIPS_META_N_PAGES, pages)
+
+	return &VipsImage{
+		ptr:         out,
+		ImageFormat: img.ImageFormat,
+	}, nil
+}
+
+// SaveImageToFile saves an image to a file path.
+// Supported formats: JPEG, WebP, GIF, PNG, AVIF
+// The keep flags control which metadata is kept in the saved image, see VIPS_FOREIGN_KEEP_* constants.
+//
+// Example:
+//
+//	err := vips2.SaveImageToFile(img, "output.jpg", 80, vips2.VIPS_FOREIGN_KEEP_NONE)
+//	if err != nil {
+//	    log.Fatalf("Failed to save image: %v", err)
+//	}
+func SaveImageToFile(image *VipsImage, filePath string, quality int, keep int) error {
+	if image == nil || image.ptr == nil {
+		return fmt.Errorf("invalid image pointer")
+	}
+
+	if filePath == "" {
+		return fmt.Errorf("invalid empty file path")
+	}
+
+	// Default quality if not specified
+	if quality <= 0 {
+		quality = 80 // Default quality
+	}
+
+	// Ensure quality is within reasonable limits
+	if quality > 100 {
+		quality = 100
+	}
+
+	// Clear any previous errors
+	clearError()
+
+	// Determine format from file extension
+	ext := strings.ToLower(filepath.Ext(filePath))
+	if ext == "" {
+		return fmt.Errorf("file has no extension, cannot determine image format")
+	}
+	ext = ext[1:] // Remove leading dot
+
+	// Convert file path to C string (null-terminated)
+	cFilePath := append([]byte(filePath), 0)
+
+	// Metadata option, e.g. keep=0 or strip=1 for older libvips versions
+	keepName, keepValue := metadataOption(keep)
+	cKeep := append([]byte(keepName), 0)
+
+	var code int
+	switch ext {
+	case "jpg", "jpeg":
+		cQuality := append([]byte("Q"), 0)
+		code = vipsJpegSave(image.ptr, &cFilePath[0], &cQuality[0], quality, &cKeep[0], keepValue, nil)
+	case "webp":
+		// Set Q for quality and lossless=0 for lossy compression
+		cQuality := append([]byte("Q"), 0)
+		cLossless := append([]byte("lossless"), 0)
+		code = vipsWebpSave(
+			image.ptr,
+			&cFilePath[0],
+			&cQuality[0], quality,
+			&cLossless[0], 0,
+			&cKeep[0], keepValue,
+			nil)
+	case "gif":
+		cQuality := append([]byte("Q"), 0)
+		code = vipsGifSave(image.ptr, &cFilePath[0], &cQuality[0], quality, &cKeep[0], keepValue, nil)
+	case "png":
+		// PNG is lossless, so quality is ignored
+		cCompression := append([]byte("compression"), 0)
+		cEffort := append([]byte("effort"), 0)
+		code = vipsPngSave(
+			image.ptr,
+			&cFilePath[0],
+			&cCompression[0], DefaultPngCompression,
+			&cEffort[0], DefaultPngEffort,
+			&cKeep[0], keepValue,
+			nil)
+	case "avif":
+		// AVIF is saved by heifsave with AV1 compression
+		cQuality := append([]byte("Q"), 0)
+		cCompression := append([]byte("compression"), 0)
+		cEffort := append([]byte("effort"), 0)
+		code = vipsHeifSave(
+			image.ptr,
+			&cFilePath[0],
+			&cQuality[0], quality,
+			&cCompression[0], VIPS_FOREIGN_HEIF_COMPRESSION_AV1,
+			&cEffort[0], DefaultAvifEffort,
+			&cKeep[0], keepValue,
+			nil)
 	default:
 		return fmt.Errorf("unsupported output format: %s", ext)
 	}
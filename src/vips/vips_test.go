@@ -1,8 +1,10 @@
 package vips
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
 
@@ -101,6 +103,17 @@ func TestImageFormatDetection(t *testing.T) {
 		assert.Equal(t, GIF, format)
 	})
 
+	t.Run("should detect HEIF and AVIF formats", func(t *testing.T) {
+		assert.Equal(t, HEIF, GetImageFormat([]byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00")))
+		assert.Equal(t, HEIF, GetImageFormat([]byte("\x00\x00\x00\x18ftypmif1\x00\x00\x00\x00")))
+		assert.Equal(t, AVIF, GetImageFormat([]byte("\x00\x00\x00\x1cftypavif\x00\x00\x00\x00")))
+		assert.Equal(t, UNKNOWN, GetImageFormat([]byte("\x00\x00\x00\x18ftypisom\x00\x00\x00\x00")))
+	})
+
+	t.Run("should detect JPEG XL format", func(t *testing.T) {
+		assert.Equal(t, JXL, GetImageFormat([]byte{0xFF, 0x0A, 0xFA, 0x7F, 0x01, 0x90, 0x08, 0x06, 0x01, 0x00, 0x48, 0x00}))
+	})
+
 	t.Run("should return UNKNOWN for invalid data", func(t *testing.T) {
 		format := GetImageFormat([]byte{0x00, 0x01, 0x02})
 		assert.Equal(t, UNKNOWN, format)
@@ -124,6 +137,7 @@ func TestStringToFormat(t *testing.T) {
 		{"webp", WEBP},
 		{"gif", GIF},
 		{"tiff", TIFF},
+		{"avif", AVIF},
 		{"unknown", UNKNOWN},
 		{"", UNKNOWN},
 		// Test that it's case-sensitive (uppercase should return UNKNOWN)
@@ -208,7 +222,7 @@ func TestImageOperations(t *testing.T) {
 		defer img.Free()
 
 		// Save to buffer
-		buffer, err := SaveImageToBuffer(img, "webp", 80)
+		buffer, err := SaveImageToBuffer(img, "webp", 80, VIPS_FOREIGN_KEEP_NONE)
 		assert.NoError(t, err, "should save image to buffer without error")
 		assert.Greater(t, len(buffer), 0)
 
@@ -221,6 +235,20 @@ func TestImageOperations(t *testing.T) {
 		assert.NotNil(t, img2.ptr)
 	})
 
+	t.Run("should save image buffer as PNG and AVIF", func(t *testing.T) {
+		img, err := LoadImageFromFile(testImagePath)
+		assert.NoError(t, err, "should load image from file without error")
+		defer img.Free()
+
+		pngBuffer, err := SaveImageToBuffer(img, "png", 80, VIPS_FOREIGN_KEEP_NONE)
+		assert.NoError(t, err, "should save image as PNG without error")
+		assert.Equal(t, PNG, GetImageFormat(pngBuffer))
+
+		avifBuffer, err := SaveImageToBuffer(img, "avif", 50, VIPS_FOREIGN_KEEP_NONE)
+		assert.NoError(t, err, "should save image as AVIF without error")
+		assert.Greater(t, len(avifBuffer), 0)
+	})
+
 	t.Run("should resize image", func(t *testing.T) {
 		img, err := LoadImageFromFile(testImagePath)
 		assert.NoError(t, err, "should load image from file without error")
@@ -243,6 +271,260 @@ func TestImageOperations(t *testing.T) {
 		t.Logf("Original: %dx%d, Resized: %dx%d", originalWidth, originalHeight, newWidth, newHeight)
 	})
 
+	t.Run("should resize image to exact dimensions", func(t *testing.T) {
+		img, err := LoadImageFromFile(testImagePath)
+		assert.NoError(t, err, "should load image from file without error")
+		defer img.Free()
+
+		thumbnail, err := ThumbnailImage(img, 40, 20, VIPS_SIZE_FORCE)
+		assert.NoError(t, err, "should resize image without error")
+		defer thumbnail.Free()
+
+		assert.Equal(t, 40, GetImageWidth(thumbnail))
+		assert.Equal(t, 20, GetImageHeight(thumbnail))
+	})
+
+	t.Run("should crop image", func(t *testing.T) {
+		img, err := LoadImageFromFile(testImagePath)
+		assert.NoError(t, err, "should load image from file without error")
+		defer img.Free()
+
+		cropped, err := CropImage(img, 10, 20, 50, 60)
+		assert.NoError(t, err, "should crop image without error")
+		defer cropped.Free()
+
+		assert.Equal(t, 50, GetImageWidth(cropped))
+		assert.Equal(t, 60, GetImageHeight(cropped))
+
+		_, err = CropImage(img, -1, 0, 50, 60)
+		assert.Error(t, err, "should reject negative offset")
+	})
+
+	t.Run("should smart crop image", func(t *testing.T) {
+		img, err := LoadImageFromFile(testImagePath)
+		assert.NoError(t, err, "should load image from file without error")
+		defer img.Free()
+
+		for _, interesting := range []int{VIPS_INTERESTING_ENTROPY, VIPS_INTERESTING_ATTENTION} {
+			cropped, err := SmartCropImage(img, 50, 50, interesting)
+			assert.NoError(t, err, "should smart crop image without error")
+			assert.Equal(t, 50, GetImageWidth(cropped))
+			assert.Equal(t, 50, GetImageHeight(cropped))
+			cropped.Free()
+		}
+	})
+
+	t.Run("should embed image", func(t *testing.T) {
+		img, err := LoadImageFromFile(testImagePath)
+		assert.NoError(t, err, "should load image from file without error")
+		defer img.Free()
+
+		width := GetImageWidth(img)
+		height := GetImageHeight(img)
+
+		embedded, err := EmbedImage(img, 10, 10, width+20, height+20, VIPS_EXTEND_BLACK)
+		assert.NoError(t, err, "should embed image without error")
+		defer embedded.Free()
+
+		assert.Equal(t, width+20, GetImageWidth(embedded))
+		assert.Equal(t, height+20, GetImageHeight(embedded))
+	})
+
+	t.Run("should auto rotate image by EXIF orientation", func(t *testing.T) {
+		// The fixture is 640x960 image with EXIF orientation 6 (rotate 90° clockwise)
+		img, err := LoadImageFromFile("mocks/static/pexels-exif-rotated.jpg")
+		require.NoError(t, err, "should load image from file without error")
+		defer img.Free()
+
+		assert.Equal(t, 640, GetImageWidth(img))
+		assert.Equal(t, 960, GetImageHeight(img))
+
+		rotated, err := AutoRotateImage(img)
+		require.NoError(t, err, "should rotate image without error")
+		defer rotated.Free()
+
+		assert.Equal(t, 960, GetImageWidth(rotated))
+		assert.Equal(t, 640, GetImageHeight(rotated))
+	})
+
+	t.Run("should transform ICC profile to sRGB", func(t *testing.T) {
+		img, err := LoadImageFromFile("mocks/static/pexels.jpg")
+		require.NoError(t, err, "should load image from file without error")
+		defer img.Free()
+		assert.True(t, ImageHasIccProfile(img))
+
+		srgb, err := TransformImageToSrgb(img)
+		require.NoError(t, err, "should transform image without error")
+		defer srgb.Free()
+
+		assert.Equal(t, GetImageWidth(img), GetImageWidth(srgb))
+		assert.Equal(t, GetImageHeight(img), GetImageHeight(srgb))
+	})
+
+	t.Run("should strip metadata on save", func(t *testing.T) {
+		img, err := LoadImageFromFile("mocks/static/pexels.jpg")
+		require.NoError(t, err, "should load image from file without error")
+		defer img.Free()
+
+		stripped, err := SaveImageToBuffer(img, "jpeg", 80, VIPS_FOREIGN_KEEP_NONE)
+		require.NoError(t, err)
+		strippedImg, err := LoadImageFromBuffer(stripped)
+		require.NoError(t, err)
+		defer strippedImg.Free()
+		assert.False(t, ImageHasIccProfile(strippedImg), "should strip ICC profile")
+
+		kept, err := SaveImageToBuffer(img, "jpeg", 80, VIPS_FOREIGN_KEEP_ALL)
+		require.NoError(t, err)
+		keptImg, err := LoadImageFromBuffer(kept)
+		require.NoError(t, err)
+		defer keptImg.Free()
+		assert.True(t, ImageHasIccProfile(keptImg), "should keep ICC profile")
+		assert.Greater(t, len(kept), len(stripped))
+	})
+
+	t.Run("should rotate and flip image", func(t *testing.T) {
+		img, err := LoadImageFromFile("mocks/static/pexels.jpg")
+		require.NoError(t, err, "should load image from file without error")
+		defer img.Free()
+
+		rotated, err := RotateImage(img, VIPS_ANGLE_D90)
+		require.NoError(t, err, "should rotate image without error")
+		defer rotated.Free()
+		assert.Equal(t, GetImageHeight(img), GetImageWidth(rotated))
+		assert.Equal(t, GetImageWidth(img), GetImageHeight(rotated))
+
+		flipped, err := FlipImage(img, VIPS_DIRECTION_VERTICAL)
+		require.NoError(t, err, "should flip image without error")
+		defer flipped.Free()
+		assert.Equal(t, GetImageWidth(img), GetImageWidth(flipped))
+
+		_, err = RotateImage(img, 45)
+		assert.Error(t, err, "should reject invalid angle")
+		_, err = FlipImage(img, 5)
+		assert.Error(t, err, "should reject invalid direction")
+	})
+
+	t.Run("should apply filters to image", func(t *testing.T) {
+		img, err := LoadImageFromFile(testImagePath)
+		require.NoError(t, err, "should load image from file without error")
+		defer img.Free()
+
+		blurred, err := BlurImage(img, 5)
+		require.NoError(t, err, "should blur image without error")
+		defer blurred.Free()
+
+		sharpened, err := SharpenImage(img)
+		require.NoError(t, err, "should sharpen image without error")
+		defer sharpened.Free()
+
+		gray, err := ColourspaceImage(img, VIPS_INTERPRETATION_B_W)
+		require.NoError(t, err, "should convert image to grayscale without error")
+		defer gray.Free()
+		assert.Less(t, GetImageBands(gray), GetImageBands(img))
+
+		bands := GetImageBands(img)
+		a := make([]float64, bands)
+		b := make([]float64, bands)
+		for i := range a {
+			a[i] = 1.2
+		}
+		brighter, err := LinearImage(img, a, b)
+		require.NoError(t, err, "should change image brightness without error")
+		defer brighter.Free()
+
+		_, err = SaveImageToBuffer(brighter, "webp", 80, VIPS_FOREIGN_KEEP_NONE)
+		assert.NoError(t, err, "should save filtered image without error")
+
+		_, err = BlurImage(img, 0)
+		assert.Error(t, err, "should reject invalid sigma")
+		_, err = LinearImage(img, []float64{1}, nil)
+		assert.Error(t, err, "should reject invalid coefficients")
+	})
+
+	t.Run("should return band means", func(t *testing.T) {
+		img, err := LoadImageFromFile("mocks/static/pexels.jpg")
+		require.NoError(t, err, "should load image from file without error")
+		defer img.Free()
+
+		means, err := GetImageBandMeans(img)
+		require.NoError(t, err, "should get band means without error")
+		assert.Len(t, means, GetImageBands(img))
+		for _, mean := range means {
+			assert.GreaterOrEqual(t, mean, 0.0)
+			assert.LessOrEqual(t, mean, 255.0)
+		}
+	})
+
+	t.Run("should load and join frames of animated image", func(t *testing.T) {
+		animatedPath := "mocks/static/animated.gif"
+		assert.True(t, IsAnimatedLoader(GetImageLoader(animatedPath)))
+		assert.False(t, IsAnimatedLoader(GetImageLoader("mocks/static/pexels.jpg")))
+
+		img, err := LoadImageFromFileWithPages(animatedPath, 0, -1)
+		require.NoError(t, err, "should load all frames without error")
+		defer img.Free()
+		assert.Equal(t, 3, GetImagePages(img))
+		assert.Equal(t, 30, GetImagePageHeight(img))
+		assert.Equal(t, 90, GetImageHeight(img))
+
+		frames := []*VipsImage{}
+		for i := 0; i < GetImagePages(img); i++ {
+			frame, err := GetImageFrame(img, i)
+			require.NoError(t, err, "should extract frame without error")
+			defer frame.Free()
+			assert.Equal(t, 1, GetImagePages(frame))
+			frames = append(frames, frame)
+		}
+		_, err = GetImageFrame(img, 3)
+		assert.Error(t, err, "should reject frame out of range")
+
+		joined, err := JoinImageFrames(frames)
+		require.NoError(t, err, "should join frames without error")
+		defer joined.Free()
+		assert.Equal(t, 3, GetImagePages(joined))
+
+		_, err = SaveImageToBuffer(joined, "webp", 80, VIPS_FOREIGN_KEEP_NONE)
+		assert.NoError(t, err, "should save animated image without error")
+
+		first, err := LoadImageFromFileWithPages(animatedPath, 0, 1)
+		require.NoError(t, err, "should load first frame without error")
+		defer first.Free()
+		assert.Equal(t, 1, GetImagePages(first))
+	})
+
+	t.Run("should load frames of animated image from buffer", func(t *testing.T) {
+		data, err := os.ReadFile("mocks/static/animated.gif")
+		require.NoError(t, err)
+		assert.True(t, IsAnimatedLoader(GetImageBufferLoader(data)))
+		assert.Empty(t, GetImageBufferLoader([]byte{0x00, 0x01, 0x02}))
+
+		img, err := LoadImageFromBufferWithPages(data, 0, -1)
+		require.NoError(t, err, "should load all frames without error")
+		defer img.Free()
+		assert.Equal(t, 3, GetImagePages(img))
+		assert.Equal(t, GIF, img.ImageFormat)
+
+		second, err := LoadImageFromBufferWithPages(data, 1, 1)
+		require.NoError(t, err, "should load single frame without error")
+		defer second.Free()
+		assert.Equal(t, 1, GetImagePages(second))
+		assert.Equal(t, 3, GetImageFilePages(second))
+		runtime.KeepAlive(data)
+	})
+
+	t.Run("should read image header from buffer", func(t *testing.T) {
+		data, err := os.ReadFile("mocks/static/animated.gif")
+		require.NoError(t, err)
+
+		header, err := GetImageHeaderFromBuffer(data)
+		require.NoError(t, err, "should read header without error")
+		assert.Equal(t, 3, header.Pages)
+		assert.Greater(t, header.Pixels(), int64(0))
+
+		_, err = GetImageHeaderFromBuffer([]byte{0x00, 0x01, 0x02})
+		assert.Error(t, err, "should handle invalid buffer data")
+	})
+
 	t.Run("should handle invalid file path", func(t *testing.T) {
 		_, err := LoadImageFromFile("nonexistent.jpg")
 		assert.Error(t, err, "should handle invalid file path")
@@ -262,7 +544,7 @@ func TestImageOperations(t *testing.T) {
 		jpegPath := "test_output.jpg"
 		defer os.Remove(jpegPath) // Clean up
 
-		err = SaveImageToFile(img, jpegPath, 80)
+		err = SaveImageToFile(img, jpegPath, 80, VIPS_FOREIGN_KEEP_NONE)
 		assert.NoError(t, err, "should save image as JPEG without error")
 
 		// Verify file was created and has content
@@ -274,13 +556,35 @@ func TestImageOperations(t *testing.T) {
 		webpPath := "test_output.webp"
 		defer os.Remove(webpPath) // Clean up
 
-		err = SaveImageToFile(img, webpPath, 90)
+		err = SaveImageToFile(img, webpPath, 90, VIPS_FOREIGN_KEEP_NONE)
 		assert.NoError(t, err, "should save image as WebP without error")
 
 		// Verify file was created and has content
 		info, err = os.Stat(webpPath)
 		assert.NoError(t, err, "saved WebP file should exist")
 		assert.Greater(t, info.Size(), int64(0), "saved WebP file should have content")
+
+		// Test saving as PNG
+		pngPath := "test_output.png"
+		defer os.Remove(pngPath) // Clean up
+
+		err = SaveImageToFile(img, pngPath, 80, VIPS_FOREIGN_KEEP_NONE)
+		assert.NoError(t, err, "should save image as PNG without error")
+
+		info, err = os.Stat(pngPath)
+		assert.NoError(t, err, "saved PNG file should exist")
+		assert.Greater(t, info.Size(), int64(0), "saved PNG file should have content")
+
+		// Test saving as AVIF
+		avifPath := "test_output.avif"
+		defer os.Remove(avifPath) // Clean up
+
+		err = SaveImageToFile(img, avifPath, 50, VIPS_FOREIGN_KEEP_NONE)
+		assert.NoError(t, err, "should save image as AVIF without error")
+
+		info, err = os.Stat(avifPath)
+		assert.NoError(t, err, "saved AVIF file should exist")
+		assert.Greater(t, info.Size(), int64(0), "saved AVIF file should have content")
 	})
 }
 
@@ -535,6 +839,49 @@ func TestErrorType(t *testing.T) {
 	})
 }
 
+func TestSupportedFormats(t *testing.T) {
+	cleanup := setupVips(t)
+	defer cleanup()
+
+	t.Run("should detect the standard loaders and savers", func(t *testing.T) {
+		for _, format := range []ImageFormat{JPEG, PNG, WEBP, GIF} {
+			assert.True(t, SupportsInputFormat(format), "should load %s", format)
+			assert.Contains(t, GetSupportedInputFormats(), format)
+			assert.Contains(t, GetSupportedOutputFormats(), format)
+		}
+		assert.False(t, SupportsInputFormat(UNKNOWN))
+	})
+
+	t.Run("should report the same support for HEIF and AVIF", func(t *testing.T) {
+		assert.Equal(t, SupportsInputFormat(HEIF), SupportsInputFormat(AVIF))
+	})
+
+	t.Run("should reject unsupported optional formats", func(t *testing.T) {
+		if SupportsInputFormat(JXL) {
+			t.Skip("JPEG XL is supported by the loaded libvips")
+		}
+		_, err := LoadImageFromBuffer([]byte{0xFF, 0x0A, 0xFA, 0x7F, 0x01, 0x90, 0x08, 0x06, 0x01, 0x00, 0x48, 0x00})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "JXL images are not supported")
+	})
+}
+
+func TestIsDecodeError(t *testing.T) {
+	t.Run("should detect errors of the loaders", func(t *testing.T) {
+		assert.True(t, IsDecodeError(&Error{Message: "VipsJpeg: Premature end of input file\n"}))
+		assert.True(t, IsDecodeError(&Error{Message: "gifload_buffer: no frames in GIF\n"}))
+		assert.True(t, IsDecodeError(&Error{Message: "linear: not enough bands\nwebp2vips: unable to read pixels\n"}))
+		assert.True(t, IsDecodeError(&Error{Message: "VipsForeignLoad: buffer is not in a known format\n"}))
+	})
+
+	t.Run("should ignore other errors", func(t *testing.T) {
+		assert.False(t, IsDecodeError(&Error{Message: "VipsRegion: killed for image \"temp-1\"\n"}))
+		assert.False(t, IsDecodeError(&Error{Message: "jpegsave_buffer: unable to write\n"}))
+		assert.False(t, IsDecodeError(fmt.Errorf("VipsJpeg: not vips error")))
+		assert.False(t, IsDecodeError(nil))
+	})
+}
+
 func TestLoadImageFromFileEdgeCases(t *testing.T) {
 	cleanup := setupVips(t)
 	defer cleanup()